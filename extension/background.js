@@ -15,22 +15,24 @@ chrome.runtime.onMessage.addListener((request, sender, sendResponse) => {
 
 async function handleDownload(url) {
   try {
-    const result = await chrome.storage.sync.get(['apiUrl']);
+    const result = await chrome.storage.sync.get(['apiUrl', 'apiToken', 'downloadOptions']);
     const apiUrl = result.apiUrl || 'http://localhost:18080';
+    const headers = { 'Content-Type': 'application/json' };
+    if (result.apiToken) {
+      headers['Authorization'] = `Bearer ${result.apiToken}`;
+    }
 
     const response = await fetch(`${apiUrl}/api/download`, {
       method: 'POST',
-      headers: {
-        'Content-Type': 'application/json',
-      },
-      body: JSON.stringify({ url, convert: false })
+      headers,
+      // 加上 popup 中保存的下載選項（轉檔、畫質、格式、資料夾等），由服務器驗證
+      body: JSON.stringify({ url, convert: false, ...(result.downloadOptions || {}) })
     });
 
+    const data = await response.json().catch(() => ({}));
     if (!response.ok) {
-      throw new Error(`HTTP ${response.status}`);
+      return { ...data, success: false, message: data.message || `HTTP ${response.status}` };
     }
-
-    const data = await response.json();
     return data;
   } catch (error) {
     throw new Error('無法連接到下載服務器');
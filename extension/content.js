@@ -40,27 +40,12 @@
         <span>正在發送...</span>
       `;
 
-      // 獲取 API 服務器地址
-      const result = await chrome.storage.sync.get(['apiUrl']);
-      const apiUrl = result.apiUrl || 'http://localhost:18080';
-
-      // 發送下載請求
-      const response = await fetch(`${apiUrl}/api/download`, {
-        method: 'POST',
-        headers: {
-          'Content-Type': 'application/json',
-        },
-        body: JSON.stringify({
-          url: videoUrl,
-          convert: false
-        })
-      });
-
-      if (!response.ok) {
-        throw new Error(`HTTP ${response.status}: ${response.statusText}`);
+      // 由 background 發送下載請求：頁面來源 (jable.tv) 不在服務器的 CORS 允許清單中，
+      // API token 也不會暴露給頁面
+      const data = await chrome.runtime.sendMessage({ action: 'download', url: videoUrl });
+      if (!data) {
+        throw new Error('無法連接到下載服務器');
       }
-
-      const data = await response.json();
       
       if (data.success) {
         // 成功
@@ -68,7 +53,7 @@
           <svg width="16" height="16" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2">
             <polyline points="20 6 9 17 4 12"></polyline>
           </svg>
-          <span>已加入下載隊列</span>
+          <span>${data.already_downloaded ? '已下載過' : '已加入下載隊列'}</span>
         `;
         button.style.backgroundColor = '#10b981';
 
@@ -86,7 +71,7 @@
           `;
         }, 3000);
       } else {
-        throw new Error(data.message || '下載失敗');
+        throw new Error(data.message || data.error || '下載失敗');
       }
     } catch (error) {
       // 顯示錯誤
@@ -96,7 +81,7 @@
           <line x1="15" y1="9" x2="9" y2="15"></line>
           <line x1="9" y1="9" x2="15" y2="15"></line>
         </svg>
-        <span>${error.message.includes('Failed to fetch') ? '服務器未啟動' : '下載失敗'}</span>
+        <span>${error.message.includes('無法連接到下載服務器') ? '服務器未啟動' : '下載失敗'}</span>
       `;
       button.style.backgroundColor = '#ef4444';
 
@@ -1,6 +1,7 @@
 // Popup script - 管理擴展設定和狀態
 document.addEventListener('DOMContentLoaded', async () => {
   const apiUrlInput = document.getElementById('apiUrl');
+  const apiTokenInput = document.getElementById('apiToken');
   const saveBtn = document.getElementById('saveBtn');
   const statusDot = document.getElementById('statusDot');
   const statusText = document.getElementById('statusText');
@@ -10,16 +11,61 @@ document.addEventListener('DOMContentLoaded', async () => {
   const queueList = document.getElementById('queueList');
   const queueCount = document.getElementById('queueCount');
   const clearCompletedBtn = document.getElementById('clearCompletedBtn');
+  const optionInputs = {
+    encode_mode: document.getElementById('encodeMode'),
+    quality: document.getElementById('quality'),
+    container: document.getElementById('container'),
+    output_dir: document.getElementById('outputDir'),
+    range: document.getElementById('range'),
+    cover: document.getElementById('cover'),
+    metadata: document.getElementById('metadata')
+  };
 
   let refreshInterval;
   let currentApiUrl;
+  let currentApiToken;
+  let eventSource = null;
+  let currentTasks = [];
 
   // 加載已保存的設定
-  const result = await chrome.storage.sync.get(['apiUrl']);
+  const result = await chrome.storage.sync.get(['apiUrl', 'apiToken', 'downloadOptions']);
   const savedApiUrl = result.apiUrl || 'http://localhost:18080';
   currentApiUrl = savedApiUrl;
+  currentApiToken = result.apiToken || '';
   apiUrlInput.value = savedApiUrl;
+  apiTokenInput.value = currentApiToken;
   apiAddress.textContent = savedApiUrl;
+  document.getElementById('extensionOrigin').value = location.origin;
+  loadDownloadOptions(result.downloadOptions || {});
+
+  // 下載選項，對應 POST /api/download 的欄位，由 background.js 加到每個下載請求
+  function loadDownloadOptions(options) {
+    for (const [key, input] of Object.entries(optionInputs)) {
+      if (options[key] === undefined) continue;
+      if (input.type === 'checkbox') {
+        input.checked = options[key];
+      } else {
+        input.value = options[key];
+      }
+    }
+  }
+
+  function readDownloadOptions() {
+    const options = {};
+    for (const [key, input] of Object.entries(optionInputs)) {
+      if (input.type === 'checkbox') {
+        options[key] = input.checked;
+      } else if (input.value.trim()) {
+        options[key] = input.value.trim();
+      }
+    }
+    return options;
+  }
+
+  // 服務器以 --token 啟動時需攜帶 API token
+  function authHeaders() {
+    return currentApiToken ? { 'Authorization': `Bearer ${currentApiToken}` } : {};
+  }
 
   // 檢查服務器狀態
   async function checkServerStatus() {
@@ -34,6 +80,11 @@ document.addEventListener('DOMContentLoaded', async () => {
         statusText.textContent = '在線';
         return true;
       }
+      if (response.status === 403) {
+        statusDot.classList.add('offline');
+        statusText.textContent = '來源未允許';
+        return false;
+      }
     } catch (error) {
       // Ignore error
     }
@@ -48,20 +99,59 @@ document.addEventListener('DOMContentLoaded', async () => {
     try {
       const response = await fetch(`${currentApiUrl}/api/tasks`, {
         method: 'GET',
+        headers: authHeaders(),
         signal: AbortSignal.timeout(5000)
       });
 
       if (response.ok) {
         const data = await response.json();
+        currentTasks = data.tasks || [];
         renderQueue(data);
         return true;
       }
+      if (response.status === 401) {
+        statusText.textContent = 'Token 錯誤';
+      }
     } catch (error) {
       console.error('Failed to fetch queue:', error);
     }
     return false;
   }
 
+  // 訂閱任務事件（SSE），即時更新隊列；連線中斷時改回定時刷新，重新連線後以 Last-Event-ID 補送
+  function connectEvents() {
+    if (eventSource) eventSource.close();
+    // EventSource 無法設定 header，token 以查詢參數傳送
+    const query = currentApiToken ? `?token=${encodeURIComponent(currentApiToken)}` : '';
+    eventSource = new EventSource(`${currentApiUrl}/api/events${query}`);
+
+    eventSource.onopen = () => stopAutoRefresh();
+    eventSource.onerror = () => {
+      if (!refreshInterval) startAutoRefresh();
+    };
+
+    ['created', 'status', 'finished', 'progress'].forEach(type => {
+      eventSource.addEventListener(type, (e) => applyTaskEvent(JSON.parse(e.data)));
+    });
+    eventSource.addEventListener('deleted', (e) => {
+      const { task_id } = JSON.parse(e.data);
+      currentTasks = currentTasks.filter(t => t.id !== task_id);
+      renderQueue({ tasks: currentTasks });
+    });
+    eventSource.addEventListener('resync', () => fetchQueue());
+  }
+
+  // 以事件中的任務快照更新隊列
+  function applyTaskEvent(event) {
+    const index = currentTasks.findIndex(t => t.id === event.task_id);
+    if (index >= 0) {
+      currentTasks[index] = event.task;
+    } else {
+      currentTasks.unshift(event.task);
+    }
+    renderQueue({ tasks: currentTasks });
+  }
+
   // 渲染隊列
   function renderQueue(data) {
     const tasks = data.tasks || [];
@@ -75,13 +165,13 @@ document.addEventListener('DOMContentLoaded', async () => {
     
     // 計算隊列中和下載中的任務數
     const activeCount = tasks.filter(t => 
-      t.status === 'queued' || t.status === 'downloading'
+      t.status === 'queued' || t.status === 'downloading' || t.status === 'paused'
     ).length;
     queueCount.textContent = activeCount;
 
     // 計算已完成的任務數，控制清除按鈕顯示
     const completedCount = tasks.filter(t => 
-      t.status === 'completed' || t.status === 'failed'
+      t.status === 'completed' || t.status === 'failed' || t.status === 'cancelled'
     ).length;
     clearCompletedBtn.style.display = completedCount > 0 ? 'block' : 'none';
 
@@ -102,24 +192,93 @@ document.addEventListener('DOMContentLoaded', async () => {
               <span class="queue-item-time">${time}</span>
             </div>
             <div class="queue-item-url" title="${task.url}">${url}</div>
+            ${task.status === 'downloading' ? `<div class="queue-item-progress">${formatProgress(task)}</div>` : ''}
             ${task.error ? `<div style="color: #fca5a5; font-size: 11px; margin-top: 5px;">${task.error}</div>` : ''}
+            ${renderActions(task)}
           </div>
         `;
       }).join('');
     }
   }
 
+  // 各狀態可用的操作，對應 POST /api/tasks/{id}/{action}
+  const taskActions = {
+    'queued': [['pause', '暫停'], ['cancel', '取消']],
+    'downloading': [['pause', '暫停'], ['cancel', '取消']],
+    'paused': [['resume', '繼續'], ['cancel', '取消']],
+    'failed': [['retry', '重試']],
+    'cancelled': [['retry', '重試']]
+  };
+
+  // 渲染任務操作按鈕
+  function renderActions(task) {
+    const actions = taskActions[task.status] || [];
+    if (actions.length === 0) return '';
+    return `
+      <div class="queue-item-actions">
+        ${actions.map(([action, label]) =>
+          `<button data-task="${task.id}" data-action="${action}">${label}</button>`
+        ).join('')}
+      </div>
+    `;
+  }
+
+  // 任務操作
+  queueList.addEventListener('click', async (event) => {
+    const button = event.target.closest('button[data-action]');
+    if (!button) return;
+
+    try {
+      const response = await fetch(`${currentApiUrl}/api/tasks/${button.dataset.task}/${button.dataset.action}`, {
+        method: 'POST',
+        headers: authHeaders(),
+        signal: AbortSignal.timeout(5000)
+      });
+      const data = await response.json();
+      showAlert(data.message, response.ok ? 'success' : 'error');
+      await fetchQueue();
+    } catch (error) {
+      console.error('Failed to update task:', error);
+      showAlert('操作失敗', 'error');
+    }
+  });
+
   // 獲取狀態文本
   function getStatusText(status) {
     const statusMap = {
       'queued': '⏳ 排隊中',
       'downloading': '⬇️ 下載中',
+      'paused': '⏸️ 已暫停',
+      'cancelled': '🚫 已取消',
       'completed': '✅ 已完成',
       'failed': '❌ 失敗'
     };
     return statusMap[status] || status;
   }
 
+  // 格式化處理進度，例如「下載片段 120/480 · 2.3 MB/s · 剩餘 3 分鐘」
+  function formatProgress(task) {
+    const stageMap = {
+      'resolving': '解析頁面',
+      'downloading': '下載片段',
+      'merging': '合成',
+      'encoding': '轉檔'
+    };
+    const parts = [stageMap[task.stage] || '準備中'];
+
+    if (task.stage === 'downloading' && task.segments_total) {
+      parts[0] += ` ${task.segments_done || 0}/${task.segments_total}`;
+      if (task.speed) parts.push(`${(task.speed / 1024 / 1024).toFixed(1)} MB/s`);
+    } else if (task.progress && task.progress.percent) {
+      parts[0] += ` ${task.progress.percent.toFixed(0)}%`;
+    }
+
+    if (task.eta) {
+      parts.push(task.eta < 60 ? `剩餘 ${Math.ceil(task.eta)} 秒` : `剩餘 ${Math.ceil(task.eta / 60)} 分鐘`);
+    }
+    return parts.join(' · ');
+  }
+
   // 提取視頻 ID
   function extractVideoId(url) {
     const match = url.match(/\/([^/]+)\/?$/);
@@ -169,6 +328,7 @@ document.addEventListener('DOMContentLoaded', async () => {
   // 保存設定
   saveBtn.addEventListener('click', async () => {
     const apiUrl = apiUrlInput.value.trim();
+    const apiToken = apiTokenInput.value.trim();
     
     if (!apiUrl) {
       showAlert('請輸入 API 地址', 'error');
@@ -180,8 +340,9 @@ document.addEventListener('DOMContentLoaded', async () => {
       new URL(apiUrl);
       
       // 保存到 storage
-      await chrome.storage.sync.set({ apiUrl });
+      await chrome.storage.sync.set({ apiUrl, apiToken, downloadOptions: readDownloadOptions() });
       currentApiUrl = apiUrl;
+      currentApiToken = apiToken;
       apiAddress.textContent = apiUrl;
       
       showAlert('設定已保存', 'success');
@@ -190,7 +351,7 @@ document.addEventListener('DOMContentLoaded', async () => {
       const isOnline = await checkServerStatus();
       if (isOnline) {
         await fetchQueue();
-        startAutoRefresh();
+        connectEvents();
       }
     } catch (error) {
       showAlert('無效的 URL 格式', 'error');
@@ -202,6 +363,7 @@ document.addEventListener('DOMContentLoaded', async () => {
     try {
       const response = await fetch(`${currentApiUrl}/api/tasks/clear-completed`, {
         method: 'DELETE',
+        headers: authHeaders(),
         signal: AbortSignal.timeout(5000)
       });
 
@@ -224,11 +386,12 @@ document.addEventListener('DOMContentLoaded', async () => {
   const isOnline = await checkServerStatus();
   if (isOnline) {
     await fetchQueue();
-    startAutoRefresh();
+    connectEvents();
   }
 
   // 清理
   window.addEventListener('beforeunload', () => {
     stopAutoRefresh();
+    if (eventSource) eventSource.close();
   });
 });
@@ -3,6 +3,16 @@ package config
 const (
 	UserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/78.0.3904.97 Safari/537.36"
 	MaxWorkers = 8
+	ServerWorkers = 2 // 服務器模式同時處理的任務數
+	DownloadDir = "download" // 預設下載資料夾，每部影片存放在以番號命名的子資料夾
+	DefaultContainer = "mp4" // 預設輸出封裝格式: mp4, mkv, ts, fmp4
+	ProfilesFile = "profiles.json" // 自訂轉檔設定檔，不存在時只使用內建設定
+	HooksFile = "hooks.json" // 各階段執行的使用者指令，不存在時不執行
+	TasksFile = "tasks.jsonl" // 服務器模式的任務記錄，重新啟動時恢復未完成的任務
+	MaxQueue = 1000 // 服務器模式排隊中任務數上限，超過時拒絕新的下載請求
+	ServerHost = "127.0.0.1" // 服務器模式預設只接受本機連線
+	AllowedOrigins = "" // 服務器模式允許的 CORS 來源，以逗號分隔；預設不允許，需指定擴展的 chrome-extension://<ID>
+	TokenEnv = "JABLE_API_TOKEN" // 未指定 --token 時讀取的環境變數
 )
 
 var Headers = map[string]string{
@@ -1,6 +1,7 @@
 package crawler
 
 import (
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"fmt"
@@ -12,35 +13,59 @@ import (
 	"time"
 
 	"github.com/jable-downloader-go/internal/config"
+	"github.com/jable-downloader-go/internal/hls"
 )
 
 type Crawler struct {
-	client      *http.Client
-	cipher      cipher.BlockMode
-	folderPath  string
-	downloadList []string
-	mu          sync.Mutex
-	progress    int
-	total       int
+	client       *http.Client
+	cipher       cipher.Block
+	iv           []byte
+	folderPath   string
+	initSection  *hls.Segment
+	downloadList []hls.Segment
+	mu           sync.Mutex
+	progress     int
+	total        int
+	limiter      Limiter
+	ctx          context.Context
+	onProgress   ProgressFunc
+	bytes        int64 // 本次下載的位元組數
+	fetched      int   // 本次下載的片段數（不含略過的片段）
+	started      time.Time
+	samples      []speedSample // 計算目前速度用
 }
 
 func NewCrawler(folderPath string, tsList []string, aesKey []byte, iv []byte) (*Crawler, error) {
+	pl := hls.NewPlaylist(tsList)
+	pl.Key = aesKey
+	pl.IV = iv
+	return NewPlaylistCrawler(folderPath, pl)
+}
+
+// NewPlaylistCrawler 依播放清單建立爬蟲，包含 fMP4 的初始化片段
+func NewPlaylistCrawler(folderPath string, pl *hls.Playlist) (*Crawler, error) {
 	c := &Crawler{
 		client:       &http.Client{Timeout: 30 * time.Second},
 		folderPath:   folderPath,
-		downloadList: make([]string, len(tsList)),
-		total:        len(tsList),
+		initSection:  pl.Map,
+		downloadList: make([]hls.Segment, len(pl.Segments)),
+		total:        len(pl.Segments),
+		ctx:          context.Background(),
 	}
 	
-	copy(c.downloadList, tsList)
+	copy(c.downloadList, pl.Segments)
 	
 	// 如果有 AES 金鑰，建立解密器
-	if len(aesKey) > 0 {
-		block, err := aes.NewCipher(aesKey)
+	if len(pl.Key) > 0 {
+		block, err := aes.NewCipher(pl.Key)
 		if err != nil {
 			return nil, fmt.Errorf("建立 AES cipher 失敗: %v", err)
 		}
-		c.cipher = cipher.NewCBCDecrypter(block, iv[:16])
+		if len(pl.IV) < aes.BlockSize {
+			return nil, fmt.Errorf("IV 長度錯誤: %d", len(pl.IV))
+		}
+		c.cipher = block
+		c.iv = pl.IV[:aes.BlockSize]
 	}
 	
 	return c, nil
@@ -48,11 +73,19 @@ func NewCrawler(folderPath string, tsList []string, aesKey []byte, iv []byte) (*
 
 func (c *Crawler) Download() error {
 	startTime := time.Now()
+	
+	// fMP4 串流需要先取得初始化片段
+	if c.initSection != nil {
+		if err := c.downloadInit(); err != nil {
+			return err
+		}
+	}
+	
 	fmt.Printf("開始下載 %d 個檔案..\n", c.total)
 	fmt.Printf("預計等待時間: %.2f 分鐘 (視影片長度與網路速度而定)\n", float64(c.total)/150)
 	
 	var wg sync.WaitGroup
-	jobs := make(chan string, c.total)
+	jobs := make(chan hls.Segment, c.total)
 	
 	// 啟動 worker pool
 	for i := 0; i < config.MaxWorkers; i++ {
@@ -61,103 +94,198 @@ func (c *Crawler) Download() error {
 	}
 	
 	// 發送任務
-	for _, url := range c.downloadList {
-		jobs <- url
+	for _, seg := range c.downloadList {
+		jobs <- seg
 	}
 	close(jobs)
 	
 	// 等待完成
 	wg.Wait()
 	
+	// 被取消時已下載的片段保留在資料夾，之後可以續傳
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+	
 	elapsed := time.Since(startTime)
 	fmt.Printf("\n花費 %.2f 分鐘爬取完成!\n", elapsed.Minutes())
 	
 	return nil
 }
 
-func (c *Crawler) worker(wg *sync.WaitGroup, jobs <-chan string) {
+func (c *Crawler) worker(wg *sync.WaitGroup, jobs <-chan hls.Segment) {
 	defer wg.Done()
 	
-	for url := range jobs {
-		c.downloadOne(url)
+	for seg := range jobs {
+		if c.ctx.Err() != nil {
+			continue // 取消後清空剩餘的工作
+		}
+		c.downloadOne(seg)
 	}
 }
 
-func (c *Crawler) downloadOne(url string) {
-	fileName := filepath.Base(url)
-	fileName = fileName[:len(fileName)-3] + ".mp4"
+// downloadInit 下載 EXT-X-MAP 初始化片段，缺少它後續片段無法播放
+func (c *Crawler) downloadInit() error {
+	savePath := filepath.Join(c.folderPath, c.initSection.FileName())
+	if _, err := os.Stat(savePath); err == nil {
+		return nil
+	}
+	
+	if _, err := c.save(*c.initSection, savePath); err != nil {
+		return fmt.Errorf("下載初始化片段失敗: %v", err)
+	}
+	fmt.Printf("初始化片段已下載: %s\n", c.initSection.FileName())
+	return nil
+}
+
+func (c *Crawler) downloadOne(seg hls.Segment) {
+	fileName := seg.FileName()
 	savePath := filepath.Join(c.folderPath, fileName)
 	
 	// 檢查是否已下載
 	if _, err := os.Stat(savePath); err == nil {
-		c.updateProgress(url, true)
+		c.updateProgress(fileName, true)
 		return
 	}
 	
-	// 下載
-	req, err := http.NewRequest("GET", url, nil)
+	n, err := c.save(seg, savePath)
 	if err != nil {
-		fmt.Printf("\n建立請求失敗 %s: %v\n", fileName, err)
+		if c.ctx.Err() != nil {
+			return
+		}
+		fmt.Printf("\n下載失敗 %s: %v\n", fileName, err)
 		return
 	}
 	
+	c.recordBytes(n)
+	c.updateProgress(fileName, false)
+}
+
+// SetContext 設定下載的 context，取消時停止發出新請求並中斷進行中的請求
+func (c *Crawler) SetContext(ctx context.Context) {
+	if ctx != nil {
+		c.ctx = ctx
+	}
+}
+
+// SetLimiter 與其他爬蟲共用連線數上限，例如服務器模式同時下載多部影片時
+func (c *Crawler) SetLimiter(l Limiter) {
+	c.limiter = l
+}
+
+// save 下載片段、解密後寫入 savePath，回傳下載的位元組數
+func (c *Crawler) save(seg hls.Segment, savePath string) (int, error) {
+	if err := c.limiter.AcquireContext(c.ctx); err != nil {
+		return 0, err
+	}
+	defer c.limiter.Release()
+	
+	req, err := http.NewRequestWithContext(c.ctx, "GET", seg.URL, nil)
+	if err != nil {
+		return 0, fmt.Errorf("建立請求失敗: %v", err)
+	}
+	
 	for k, v := range config.Headers {
 		req.Header.Set(k, v)
 	}
 	
+	// EXT-X-BYTERANGE 片段只請求需要的範圍
+	if seg.IsByteRange() {
+		req.Header.Set("Range", seg.RangeHeader())
+	}
+	
 	resp, err := c.client.Do(req)
 	if err != nil {
-		fmt.Printf("\n下載失敗 %s: %v\n", fileName, err)
-		return
+		return 0, err
 	}
 	defer resp.Body.Close()
 	
-	if resp.StatusCode != 200 {
-		fmt.Printf("\n下載失敗 %s: status code %d\n", fileName, resp.StatusCode)
-		return
+	if resp.StatusCode != 200 && !(seg.IsByteRange() && resp.StatusCode == http.StatusPartialContent) {
+		return 0, fmt.Errorf("status code %d", resp.StatusCode)
 	}
 	
 	// 讀取內容
 	content, err := io.ReadAll(resp.Body)
 	if err != nil {
-		fmt.Printf("\n讀取失敗 %s: %v\n", fileName, err)
-		return
+		return 0, fmt.Errorf("讀取失敗: %v", err)
+	}
+	size := len(content)
+	
+	if seg.IsByteRange() {
+		// 伺服器忽略 Range 時回傳整個檔案，自行截取
+		if resp.StatusCode == 200 {
+			if int64(len(content)) < seg.Offset+seg.Length {
+				return 0, fmt.Errorf("檔案長度不足: %d", len(content))
+			}
+			content = content[seg.Offset : seg.Offset+seg.Length]
+		} else if int64(len(content)) != seg.Length {
+			return 0, fmt.Errorf("範圍長度錯誤: 預期 %d, 實際 %d", seg.Length, len(content))
+		}
 	}
 	
 	// 解密
 	if c.cipher != nil {
-		decrypted := make([]byte, len(content))
-		c.cipher.CryptBlocks(decrypted, content)
-		content = decrypted
+		content, err = c.decrypt(content)
+		if err != nil {
+			return 0, err
+		}
 	}
 	
-	// 寫入檔案
-	file, err := os.Create(savePath)
-	if err != nil {
-		fmt.Printf("\n建立檔案失敗 %s: %v\n", fileName, err)
-		return
+	// 先寫入暫存檔再改名，中斷時不會留下不完整的片段，續傳時才能直接略過已存在的檔案
+	tempPath := savePath + ".part"
+	if err := os.WriteFile(tempPath, content, 0644); err != nil {
+		return 0, fmt.Errorf("寫入檔案失敗: %v", err)
 	}
-	defer file.Close()
-	
-	if _, err := file.Write(content); err != nil {
-		fmt.Printf("\n寫入檔案失敗 %s: %v\n", fileName, err)
-		return
+	if err := os.Rename(tempPath, savePath); err != nil {
+		os.Remove(tempPath)
+		return 0, fmt.Errorf("寫入檔案失敗: %v", err)
 	}
+	return size, nil
+}
+
+// decrypt 以 AES-128-CBC 解密並移除 PKCS#7 填充
+// 每個片段使用獨立的 BlockMode，避免 worker 之間共用 CBC 狀態
+func (c *Crawler) decrypt(content []byte) ([]byte, error) {
+	if len(content)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("加密內容長度錯誤: %d", len(content))
+	}
+	
+	decrypted := make([]byte, len(content))
+	cipher.NewCBCDecrypter(c.cipher, c.iv).CryptBlocks(decrypted, content)
 	
-	c.updateProgress(url, false)
+	// fMP4 片段需要直接串接，殘留的填充會破壞 box 結構
+	if n := len(decrypted); n > 0 {
+		padding := int(decrypted[n-1])
+		if padding > 0 && padding <= aes.BlockSize && padding <= n {
+			valid := true
+			for _, b := range decrypted[n-padding:] {
+				if int(b) != padding {
+					valid = false
+					break
+				}
+			}
+			if valid {
+				decrypted = decrypted[:n-padding]
+			}
+		}
+	}
+	return decrypted, nil
 }
 
-func (c *Crawler) updateProgress(url string, skipped bool) {
+func (c *Crawler) updateProgress(fileName string, skipped bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	
 	c.progress++
 	remaining := c.total - c.progress
 	
-	fileName := filepath.Base(url)
 	if skipped {
 		fmt.Printf("\r當前目標: %s 已下載, 故跳過...剩餘 %d 個", fileName, remaining)
 	} else {
 		fmt.Printf("\r當前下載: %s, 剩餘 %d 個", fileName, remaining)
 	}
+	
+	if c.onProgress != nil {
+		c.onProgress(c.snapshot())
+	}
 }
@@ -1,15 +1,21 @@
 package crawler
 
 import (
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/jable-downloader-go/internal/hls"
 )
 
 // testData 回傳一段可預測的測試資料（長度為 16 的倍數以符合 AES-CBC）
@@ -104,6 +110,9 @@ func TestDownload_Success(t *testing.T) {
 		if _, err := os.Stat(path); os.IsNotExist(err) {
 			t.Errorf("expected file %s was not created", f)
 		}
+		if _, err := os.Stat(path + ".part"); err == nil {
+			t.Errorf("temporary file %s.part should have been renamed", f)
+		}
 	}
 }
 
@@ -299,7 +308,7 @@ func TestProgressTracking(t *testing.T) {
 
 func TestUpdateProgress(t *testing.T) {
 	c := &Crawler{
-		downloadList: []string{"http://example.com/a.ts", "http://example.com/b.ts"},
+		downloadList: []hls.Segment{{URL: "http://example.com/a.ts"}, {URL: "http://example.com/b.ts"}},
 		total:        2,
 		progress:     0,
 	}
@@ -327,7 +336,7 @@ func TestDownloadOne_WritesCorrectContent(t *testing.T) {
 	dir := t.TempDir()
 	c, _ := NewCrawler(dir, []string{tsServer.URL + "/test.ts"}, nil, nil)
 
-	c.downloadOne(tsServer.URL + "/test.ts")
+	c.downloadOne(hls.Segment{URL: tsServer.URL + "/test.ts"})
 
 	content, err := os.ReadFile(filepath.Join(dir, "test.mp4"))
 	if err != nil {
@@ -337,3 +346,188 @@ func TestDownloadOne_WritesCorrectContent(t *testing.T) {
 		t.Errorf("content mismatch:\n got:  %q\n want: %q", string(content), string(expectedContent))
 	}
 }
+
+func TestDownload_FragmentedWithInit(t *testing.T) {
+	key := make([]byte, 16)
+	iv := make([]byte, 16)
+	rand.Read(key)
+	rand.Read(iv)
+
+	encrypt := func(plaintext []byte) []byte {
+		padded := pad(plaintext)
+		block, _ := aes.NewCipher(key)
+		out := make([]byte, len(padded))
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, padded)
+		return out
+	}
+
+	contents := map[string][]byte{
+		"/init.mp4": []byte("ftyp-moov-init-section"),
+		"/seg1.m4s": []byte("moof-mdat-fragment-1"),
+		"/seg2.m4s": []byte("moof-mdat-fragment-2"),
+	}
+
+	tsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write(encrypt(contents[r.URL.Path]))
+	}))
+	defer tsServer.Close()
+
+	dir := t.TempDir()
+	pl := &hls.Playlist{
+		Map:      &hls.Segment{URL: tsServer.URL + "/init.mp4", Name: hls.InitFileName},
+		Segments: []hls.Segment{{URL: tsServer.URL + "/seg1.m4s"}, {URL: tsServer.URL + "/seg2.m4s"}},
+		Key:      key,
+		IV:       iv,
+	}
+
+	c, err := NewPlaylistCrawler(dir, pl)
+	if err != nil {
+		t.Fatalf("NewPlaylistCrawler failed: %v", err)
+	}
+	if err := c.Download(); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	// 初始化片段與 .m4s 片段都應解密並移除填充，才能直接串接
+	for path, name := range map[string]string{"/init.mp4": hls.InitFileName, "/seg1.m4s": "seg1.m4s", "/seg2.m4s": "seg2.m4s"} {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("expected file %s: %v", name, err)
+		}
+		if string(got) != string(contents[path]) {
+			t.Errorf("%s content mismatch:\n got:  %q\n want: %q", name, got, contents[path])
+		}
+	}
+}
+
+func TestDownload_InitSectionFailure(t *testing.T) {
+	tsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer tsServer.Close()
+
+	pl := &hls.Playlist{
+		Map:      &hls.Segment{URL: tsServer.URL + "/init.mp4", Name: hls.InitFileName},
+		Segments: []hls.Segment{{URL: tsServer.URL + "/seg1.m4s"}},
+	}
+
+	c, _ := NewPlaylistCrawler(t.TempDir(), pl)
+	if err := c.Download(); err == nil {
+		t.Error("expected error when init section cannot be downloaded")
+	}
+}
+
+func TestDownloadOne_ByteRangeIgnoredByServer(t *testing.T) {
+	// 伺服器不支援 Range 時回傳整個檔案，爬蟲應自行截取範圍
+	tsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("aaaaBBBBcccc"))
+	}))
+	defer tsServer.Close()
+
+	dir := t.TempDir()
+	seg := hls.Segment{URL: tsServer.URL + "/video.ts", Name: "video_00001.mp4", Offset: 4, Length: 4}
+	c, _ := NewPlaylistCrawler(dir, &hls.Playlist{Segments: []hls.Segment{seg}})
+
+	c.downloadOne(seg)
+
+	content, err := os.ReadFile(filepath.Join(dir, "video_00001.mp4"))
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	if string(content) != "BBBB" {
+		t.Errorf("expected 'BBBB', got %q", content)
+	}
+}
+
+func TestDownload_Cancelled(t *testing.T) {
+	var requests int32
+	tsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte("mock-ts-content"))
+	}))
+	defer tsServer.Close()
+
+	dir := t.TempDir()
+	c, err := NewCrawler(dir, []string{tsServer.URL + "/seg1.ts", tsServer.URL + "/seg2.ts"}, nil, nil)
+	if err != nil {
+		t.Fatalf("NewCrawler failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.SetContext(ctx)
+
+	if err := c.Download(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 0 {
+		t.Errorf("expected no requests after cancel, got %d", n)
+	}
+}
+
+func TestDownload_ReportsProgress(t *testing.T) {
+	tsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("0123456789"))
+	}))
+	defer tsServer.Close()
+
+	dir := t.TempDir()
+	// seg1 已存在，續傳時略過
+	if err := os.WriteFile(filepath.Join(dir, "seg1.mp4"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewCrawler(dir, []string{tsServer.URL + "/seg1.ts", tsServer.URL + "/seg2.ts", tsServer.URL + "/seg3.ts"}, nil, nil)
+	if err != nil {
+		t.Fatalf("NewCrawler failed: %v", err)
+	}
+
+	var mu sync.Mutex
+	var last Progress
+	calls := 0
+	c.SetProgressFunc(func(p Progress) {
+		mu.Lock()
+		defer mu.Unlock()
+		last = p
+		calls++
+	})
+
+	if err := c.Download(); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	if calls != 3 {
+		t.Errorf("expected 3 progress calls, got %d", calls)
+	}
+	if last.Done != 3 || last.Total != 3 {
+		t.Errorf("expected 3/3 segments, got %d/%d", last.Done, last.Total)
+	}
+	if last.Bytes != 20 {
+		t.Errorf("expected 20 bytes downloaded (skipped segment excluded), got %d", last.Bytes)
+	}
+	if last.ETA != 0 {
+		t.Errorf("expected ETA 0 when finished, got %v", last.ETA)
+	}
+}
+
+func TestSnapshot_SpeedAndETA(t *testing.T) {
+	start := time.Now()
+	c := &Crawler{
+		total:    10,
+		progress: 4,
+		bytes:    4000,
+		fetched:  4,
+		samples:  []speedSample{{at: start, bytes: 0}, {at: start.Add(2 * time.Second), bytes: 4000}},
+	}
+
+	p := c.snapshot()
+	if p.Speed != 2000 {
+		t.Errorf("expected speed 2000 B/s, got %v", p.Speed)
+	}
+	// 剩餘 6 個片段，平均 1000 bytes，每秒 2000 bytes
+	if p.ETA != 3 {
+		t.Errorf("expected ETA 3s, got %v", p.ETA)
+	}
+}
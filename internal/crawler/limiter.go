@@ -0,0 +1,46 @@
+package crawler
+
+import "context"
+
+// Limiter 多個爬蟲共用的連線數上限，nil 表示不限制
+type Limiter chan struct{}
+
+// NewLimiter 建立最多 n 個同時連線的 Limiter，n <= 0 時不限制
+func NewLimiter(n int) Limiter {
+	if n <= 0 {
+		return nil
+	}
+	return make(Limiter, n)
+}
+
+// Acquire 取得一個連線名額，已滿時等待
+func (l Limiter) Acquire() {
+	if l != nil {
+		l <- struct{}{}
+	}
+}
+
+// AcquireContext 取得一個連線名額，ctx 在等待期間取消時回傳 ctx.Err()
+func (l Limiter) AcquireContext(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release 釋放連線名額
+func (l Limiter) Release() {
+	if l != nil {
+		<-l
+	}
+}
+
+// InUse 目前使用中的連線數
+func (l Limiter) InUse() int {
+	return len(l)
+}
@@ -0,0 +1,44 @@
+package crawler
+
+import "testing"
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(2)
+	l.Acquire()
+	l.Acquire()
+	if l.InUse() != 2 {
+		t.Errorf("expected 2 in use, got %d", l.InUse())
+	}
+
+	// 額度用完時 Acquire 會阻塞直到有人 Release
+	acquired := make(chan struct{})
+	go func() {
+		l.Acquire()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("Acquire should block when the limiter is full")
+	default:
+	}
+
+	l.Release()
+	<-acquired
+	l.Release()
+	l.Release()
+	if l.InUse() != 0 {
+		t.Errorf("expected 0 in use, got %d", l.InUse())
+	}
+}
+
+func TestLimiter_Nil(t *testing.T) {
+	var l Limiter
+	l.Acquire()
+	l.Release()
+	if l.InUse() != 0 {
+		t.Errorf("expected 0 in use, got %d", l.InUse())
+	}
+	if NewLimiter(0) != nil {
+		t.Error("NewLimiter(0) should return nil")
+	}
+}
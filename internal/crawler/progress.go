@@ -0,0 +1,70 @@
+package crawler
+
+import "time"
+
+// speedWindow 計算目前速度的時間範圍
+const speedWindow = 5 * time.Second
+
+// Progress 片段下載進度
+type Progress struct {
+	Done  int     `json:"done"`  // 已完成的片段數（包含先前已下載而略過的片段）
+	Total int     `json:"total"` // 片段總數
+	Bytes int64   `json:"bytes"` // 本次下載的位元組數
+	Speed float64 `json:"speed"` // 最近幾秒的下載速度 (bytes/s)
+	ETA   float64 `json:"eta"`   // 預估剩餘秒數，無法估計時為 0
+}
+
+// ProgressFunc 每完成一個片段呼叫一次
+type ProgressFunc func(Progress)
+
+// speedSample 某個時間點累計下載的位元組數
+type speedSample struct {
+	at    time.Time
+	bytes int64
+}
+
+// SetProgressFunc 設定片段下載進度的回報函數
+func (c *Crawler) SetProgressFunc(fn ProgressFunc) {
+	c.onProgress = fn
+}
+
+// recordBytes 記錄一個下載完成的片段大小
+func (c *Crawler) recordBytes(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if c.started.IsZero() {
+		c.started = now
+		c.samples = append(c.samples, speedSample{at: now})
+	}
+	c.bytes += int64(n)
+	c.fetched++
+	c.samples = append(c.samples, speedSample{at: now, bytes: c.bytes})
+
+	// 只保留速度計算範圍內的樣本，另外保留一個範圍外的樣本作為起點
+	i := 0
+	for i < len(c.samples)-2 && now.Sub(c.samples[i+1].at) > speedWindow {
+		i++
+	}
+	c.samples = c.samples[i:]
+}
+
+// snapshot 回傳目前的進度，呼叫者需持有 c.mu
+func (c *Crawler) snapshot() Progress {
+	p := Progress{Done: c.progress, Total: c.total, Bytes: c.bytes}
+
+	if n := len(c.samples); n >= 2 {
+		first, last := c.samples[0], c.samples[n-1]
+		if elapsed := last.at.Sub(first.at).Seconds(); elapsed > 0 {
+			p.Speed = float64(last.bytes-first.bytes) / elapsed
+		}
+	}
+
+	// 以本次下載片段的平均大小估計剩餘的位元組數
+	if p.Speed > 0 && c.fetched > 0 {
+		remaining := float64(c.total - c.progress)
+		p.ETA = remaining * float64(c.bytes) / float64(c.fetched) / p.Speed
+	}
+	return p
+}
@@ -1,8 +1,10 @@
 package downloader
 
 import (
+	"bytes"
 	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -13,28 +15,71 @@ import (
 
 	"github.com/chromedp/chromedp"
 	"github.com/grafov/m3u8"
+	"github.com/jable-downloader-go/internal/config"
 	"github.com/jable-downloader-go/internal/crawler"
 	"github.com/jable-downloader-go/internal/encoder"
+	"github.com/jable-downloader-go/internal/ffmpeg"
+	"github.com/jable-downloader-go/internal/hls"
+	"github.com/jable-downloader-go/internal/hooks"
 	"github.com/jable-downloader-go/internal/merger"
 	"github.com/jable-downloader-go/pkg/utils"
 )
 
+// 處理階段，進入時呼叫 OnStage
+const (
+	StageResolving   = "resolving"   // 取得 M3U8 網址與影片資訊
+	StageDownloading = "downloading" // 下載片段
+	StageMerging     = "merging"     // 合成影片
+	StageEncoding    = "encoding"    // 轉檔、寫入標籤與其他後處理
+)
+
 type Downloader struct {
 	URL        string
 	DirName    string
 	FolderPath string
 	AutoMode   bool // 自動模式（服務器模式使用）
 	EncodeMode encoder.EncodeMode // 指定轉檔模式
+	AdFilter   hls.AdFilter // 移除疑似廣告的 discontinuity 群組
+	Container  merger.Container // 輸出封裝格式
+	Split      merger.SplitOptions // 依大小或長度分段輸出
+	Profile    string // 指定轉檔設定名稱，優先於 EncodeMode
+	OnProgress ffmpeg.ProgressFunc // FFmpeg 合成與轉檔進度，nil 時顯示在終端機
+	Info       *utils.VideoInfo // 從影片頁面解析的標題、演員、標籤與日期
+	Previews   encoder.PreviewOptions // 合成後產生縮圖總覽與預覽短片
+	Loudness   encoder.LoudnessOptions // EBU R128 響度正規化
+	Warnings   []string // 失敗的後處理步驟，影片本身已保留
+	Hooks      *hooks.Pipeline // 各階段執行的使用者指令
+	TaskID     string // 服務器模式的任務 ID，傳給 hook
+	Limiter    crawler.Limiter // 與其他下載共用的連線數上限，nil 表示不限制
+	Context    context.Context // 取消時停止下載與 FFmpeg，已下載的片段保留供續傳；nil 表示不可取消
+	OnStage    func(stage string) // 進入新的處理階段時呼叫
+	OnSegments crawler.ProgressFunc // 片段下載進度，每完成一個片段呼叫一次
+	Force      bool // 影片已存在時仍重新下載並覆寫
+	Quality    string // 主播放清單的畫質: best、worst 或最高解析度（例如 720p），空字串為 best
+	Range      hls.TimeRange // 只下載影片的一段，精確度為片段
+	NoCover    bool // 不下載與嵌入封面
+	NoMetadata bool // 不寫入標題、演員等標籤
 }
 
-func NewDownloader(url string) (*Downloader, error) {
+// VideoCode 從影片網址取得番號，忽略查詢參數、錨點與結尾的 /
+func VideoCode(url string) (string, error) {
+	if i := strings.IndexAny(url, "?#"); i >= 0 {
+		url = url[:i]
+	}
 	parts := strings.Split(strings.TrimRight(url, "/"), "/")
 	if len(parts) < 2 {
-		return nil, fmt.Errorf("無效的 URL 格式")
+		return "", fmt.Errorf("無效的 URL 格式")
+	}
+	return parts[len(parts)-1], nil
+}
+
+func NewDownloader(url string) (*Downloader, error) {
+	dirName, err := VideoCode(url)
+	if err != nil {
+		return nil, err
 	}
 	
-	dirName := parts[len(parts)-1]
-	folderPath := filepath.Join("download", dirName)
+	folderPath := filepath.Join(config.DownloadDir, dirName)
 	
 	return &Downloader{
 		URL:        url,
@@ -42,35 +87,82 @@ func NewDownloader(url string) (*Downloader, error) {
 		FolderPath: folderPath,
 		AutoMode:   false,
 		EncodeMode: encoder.NoEncode, // 默認不轉檔
+		Container:  merger.Container(config.DefaultContainer),
 	}, nil
 }
 
 func (d *Downloader) Download() error {
-	// 自動模式或詢問是否轉檔
-	var encodeMode encoder.EncodeMode
-	if d.AutoMode {
-		encodeMode = d.EncodeMode // 使用預設的轉檔模式
-		if encodeMode != encoder.NoEncode {
-			fmt.Printf("使用轉檔模式: %d (自動模式)\n", encodeMode)
+	return d.withHooks(d.download)
+}
+
+// withHooks 執行 fn，hook 要求略過後續階段時視為成功，失敗時執行 on_failure hook
+// 被取消（暫停或取消任務）不視為失敗
+func (d *Downloader) withHooks(fn func() error) error {
+	err := fn()
+	if errors.Is(err, hooks.ErrSkip) {
+		fmt.Println("已依 hook 要求略過後續階段")
+		return nil
+	}
+	if err != nil && d.ctx().Err() != nil {
+		fmt.Println("已取消")
+		return d.ctx().Err()
+	}
+	if err != nil {
+		payload := d.hookPayload("failed")
+		payload.Error = err.Error()
+		if hookErr := d.Hooks.Run(d.ctx(), hooks.EventFailed, payload); hookErr != nil {
+			fmt.Printf("%v\n", hookErr)
 		}
-	} else {
-		encodeMode = d.askEncodeMode() // 互動模式詢問
 	}
+	return err
+}
+
+// runHook 執行 event 的 hook，status 為目前的任務狀態，任務被暫停或取消時終止 hook
+func (d *Downloader) runHook(event hooks.Event, status string) error {
+	return d.Hooks.Run(d.ctx(), event, d.hookPayload(status))
+}
+
+func (d *Downloader) hookPayload(status string) hooks.Payload {
+	payload := hooks.Payload{
+		TaskID:  d.TaskID,
+		Code:    d.DirName,
+		URL:     d.URL,
+		Status:  status,
+		Folder:  d.FolderPath,
+		Outputs: merger.ExistingOutputs(d.FolderPath, d.Container),
+	}
+	if d.Info != nil {
+		payload.Title = d.Info.Title
+	}
+	return payload
+}
+
+func (d *Downloader) download() error {
+	profile := d.encodeProfile()
 	
 	fmt.Printf("正在下載影片: %s\n", d.URL)
 	
 	// 檢查是否已存在
-	finalPath := filepath.Join(d.FolderPath, d.DirName+".mp4")
-	if utils.FileExists(finalPath) {
+	if d.Downloaded() && !d.Force {
 		fmt.Println("番號資料夾已存在, 跳過...")
 		return nil
 	}
 	
+	// 下載前確認 FFmpeg 與轉檔編碼器可用，避免下載完才失敗
+	if err := encoder.CheckFFmpeg(); err != nil {
+		return err
+	}
+	if err := encoder.CheckProfile(profile); err != nil {
+		return err
+	}
+	
 	// 建立資料夾
 	if err := utils.EnsureDir(d.FolderPath); err != nil {
 		return fmt.Errorf("建立資料夾失敗: %v", err)
 	}
 	
+	d.setStage(StageResolving)
+	
 	// 使用 ChromeDP 獲取 M3U8 URL
 	m3u8URL, htmlContent, err := d.getM3U8URL()
 	if err != nil {
@@ -79,43 +171,254 @@ func (d *Downloader) Download() error {
 	
 	fmt.Printf("m3u8url: %s\n", m3u8URL)
 	
+	// 解析影片資訊，寫入影片標籤用
+	if info, err := utils.ParseVideoInfo(htmlContent); err != nil {
+		fmt.Printf("解析影片資訊失敗: %v\n", err)
+	} else {
+		d.Info = info
+	}
+	
 	// 解析 M3U8
-	tsList, aesKey, iv, err := d.parseM3U8(m3u8URL)
+	pl, err := d.parseM3U8(m3u8URL)
 	if err != nil {
 		return fmt.Errorf("解析 M3U8 失敗: %v", err)
 	}
 	
+	// 移除插入的廣告片段
+	if dropped := pl.DropAds(d.AdFilter); dropped > 0 {
+		fmt.Printf("已移除 %d 個疑似廣告的片段\n", dropped)
+	}
+	
+	// 只保留指定範圍內的片段
+	if d.Range.Enabled() {
+		dropped := pl.Clip(d.Range)
+		if len(pl.Segments) == 0 {
+			return fmt.Errorf("時間範圍 %s 超出影片長度", d.Range)
+		}
+		fmt.Printf("只下載 %s, 略過 %d 個片段\n", d.Range, dropped)
+	}
+	
+	if err := d.runHook(hooks.EventResolved, "resolved"); err != nil {
+		return err
+	}
+	
+	// 保存片段順序，合成失敗時可用 merge 指令離線重建
+	manifest := &merger.Manifest{URL: d.URL, M3U8URL: m3u8URL, Info: d.Info, Playlist: *pl}
+	if err := merger.SaveManifest(d.FolderPath, manifest); err != nil {
+		fmt.Printf("保存片段清單失敗: %v\n", err)
+	}
+	
+	// 下載封面（先於合成，讓重新合成時不需要網路）
+	if d.NoCover {
+		fmt.Println("不下載封面, 跳過...")
+	} else if err := utils.DownloadCover(htmlContent, d.FolderPath); err != nil {
+		fmt.Printf("下載封面失敗: %v\n", err)
+	}
+	
 	// 下載 TS 片段
-	c, err := crawler.NewCrawler(d.FolderPath, tsList, aesKey, iv)
+	c, err := crawler.NewPlaylistCrawler(d.FolderPath, pl)
 	if err != nil {
 		return fmt.Errorf("建立爬蟲失敗: %v", err)
 	}
+	c.SetLimiter(d.Limiter)
+	c.SetContext(d.ctx())
+	c.SetProgressFunc(d.OnSegments)
+	
+	d.setStage(StageDownloading)
 	
 	if err := c.Download(); err != nil {
 		return fmt.Errorf("下載失敗: %v", err)
 	}
 	
-	// 合併 MP4
-	if err := merger.MergeTSFiles(d.FolderPath, tsList); err != nil {
-		return fmt.Errorf("合併失敗: %v", err)
+	if err := d.runHook(hooks.EventDownloaded, "downloaded"); err != nil {
+		return err
 	}
 	
-	// 清理臨時檔案
-	utils.DeleteFiles(d.FolderPath, d.DirName+".mp4")
+	// 強制重新下載時移除舊的輸出，避免 FFmpeg 詢問是否覆寫
+	if d.Force {
+		if err := merger.RemoveOutputs(d.FolderPath, d.Container); err != nil {
+			return err
+		}
+	}
 	
-	// 下載封面
-	if err := utils.DownloadCover(htmlContent, d.FolderPath); err != nil {
-		fmt.Printf("下載封面失敗: %v\n", err)
+	return d.finalize(pl, profile)
+}
+
+// SetOutputDir 將番號資料夾放在 dir 之下，空字串時使用 config.DownloadDir
+func (d *Downloader) SetOutputDir(dir string) {
+	if dir == "" {
+		dir = config.DownloadDir
 	}
+	d.FolderPath = filepath.Join(dir, d.DirName)
+}
+
+// Downloaded 回傳影片是否已合成在番號資料夾中
+func (d *Downloader) Downloaded() bool {
+	return len(merger.ExistingOutputs(d.FolderPath, d.Container)) > 0
+}
+
+// finalize 合成片段、轉檔後清理暫存檔，下載與重新合成共用
+// 後處理失敗或有步驟失敗時保留片段，可用 merge 指令重新處理
+func (d *Downloader) finalize(pl *hls.Playlist, profile string) error {
+	d.setStage(StageMerging)
 	
-	// 轉檔
-	if err := encoder.FFmpegEncode(d.FolderPath, d.DirName, encodeMode); err != nil {
-		fmt.Printf("轉檔失敗: %v\n", err)
+	// 合併影片
+	if _, err := merger.MergePartsContext(d.ctx(), d.FolderPath, pl, d.Container, d.Split, d.ffmpegProgress(StageMerging, "合成")); err != nil {
+		return fmt.Errorf("合併失敗: %v", err)
+	}
+	
+	if err := d.runHook(hooks.EventMerged, "merged"); err != nil {
+		return err
 	}
 	
+	if err := d.postProcess(profile); err != nil {
+		return err
+	}
+	if len(d.Warnings) > 0 {
+		fmt.Println("已保留片段, 可用 merge 指令重新處理")
+		return nil
+	}
+	
+	d.cleanup()
 	return nil
 }
 
+// cleanup 清理臨時檔案，保留影片、封面、片段清單（重新轉檔時寫入標籤）與後處理產生的檔案
+func (d *Downloader) cleanup() {
+	keep := append([]string{d.DirName + ".jpg", merger.ManifestFile}, encoder.GeneratedFiles(d.FolderPath)...)
+	for _, output := range merger.ExistingOutputs(d.FolderPath, d.Container) {
+		keep = append(keep, filepath.Base(output))
+	}
+	utils.DeleteFiles(d.FolderPath, keep...)
+}
+
+// postProcess 轉檔並寫入封面等中繼資料，分段輸出時每個分段各自處理
+func (d *Downloader) postProcess(profile string) error {
+	coverPath := filepath.Join(d.FolderPath, d.DirName+".jpg")
+	if d.NoCover {
+		coverPath = ""
+	} else if !utils.FileExists(coverPath) {
+		fmt.Println("找不到封面, 跳過...")
+		coverPath = ""
+	}
+	
+	d.setStage(StageEncoding)
+	
+	ctx := d.ctx()
+	for _, output := range merger.ExistingOutputs(d.FolderPath, d.Container) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(filepath.Base(output), d.Container.Ext())
+		
+		// 分段輸出時複製封面給每個分段
+		partCover := coverPath
+		if coverPath != "" && name != d.DirName {
+			partCover = filepath.Join(d.FolderPath, name+".jpg")
+			if err := utils.CopyFile(coverPath, partCover); err != nil {
+				fmt.Printf("複製封面失敗: %v\n", err)
+				partCover = ""
+			}
+		}
+		
+		// 轉檔，響度正規化在同一次處理中重新編碼聲音（未轉檔時影像直接複製）
+		if err := encoder.EncodeContext(ctx, d.FolderPath, name, profile, d.Container, d.Loudness, d.ffmpegProgress(StageEncoding, "轉檔")); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			step := "轉檔"
+			if profile == "" {
+				step = "響度正規化"
+			}
+			d.warn(step, name, err)
+		}
+		
+		// 寫入封面與標籤（需在轉檔之後，轉檔不會保留封面）
+		if metadata := d.metadata(name); partCover != "" || len(metadata) > 0 {
+			if err := encoder.EmbedMetadata(output, partCover, d.Container, metadata); err != nil {
+				d.warn("寫入標籤", name, err)
+			}
+		}
+		
+		// 縮圖總覽與預覽短片
+		if _, err := encoder.GeneratePreviews(output, d.Previews); err != nil {
+			d.warn("產生預覽", name, err)
+		}
+	}
+	
+	if len(d.Warnings) > 0 {
+		fmt.Printf("有 %d 個後處理步驟失敗, 已下載的影片已保留\n", len(d.Warnings))
+	}
+	return d.runHook(hooks.EventEncoded, "encoded")
+}
+
+// warn 記錄失敗的後處理步驟，每個步驟失敗時影片維持上一個步驟的結果
+func (d *Downloader) warn(step, name string, err error) {
+	msg := fmt.Sprintf("%s %s 失敗: %v", name, step, err)
+	fmt.Println(msg)
+	d.Warnings = append(d.Warnings, msg)
+}
+
+// metadata 回傳寫入影片的標籤，分段輸出時標題加上分段名稱，NoMetadata 時回傳 nil
+func (d *Downloader) metadata(name string) map[string]string {
+	if d.NoMetadata {
+		return nil
+	}
+	metadata := d.Info.Metadata(d.URL)
+	switch {
+	case metadata["title"] == "":
+		metadata["title"] = name
+	case name != d.DirName:
+		metadata["title"] += " (" + strings.TrimPrefix(name, d.DirName+"-") + ")"
+	}
+	return metadata
+}
+
+// setStage 回報目前的處理階段
+func (d *Downloader) setStage(stage string) {
+	if d.OnStage != nil {
+		d.OnStage(stage)
+	}
+}
+
+// ctx 回傳下載使用的 context，未設定 Context 時不可取消
+func (d *Downloader) ctx() context.Context {
+	if d.Context == nil {
+		return context.Background()
+	}
+	return d.Context
+}
+
+// ffmpegProgress 回傳標記階段的進度回報函數，未設定 OnProgress 時在終端機顯示 label 與進度
+func (d *Downloader) ffmpegProgress(stage, label string) ffmpeg.ProgressFunc {
+	if d.OnProgress == nil {
+		return ffmpeg.PrintProgress(label)
+	}
+	
+	return func(p ffmpeg.Progress) {
+		p.Stage = stage
+		d.OnProgress(p)
+	}
+}
+
+// encodeProfile 回傳要使用的轉檔設定名稱，空字串表示不轉檔
+// 有指定 Profile 時直接使用，自動模式使用預設的轉檔模式，否則詢問使用者
+func (d *Downloader) encodeProfile() string {
+	if d.Profile != "" {
+		fmt.Printf("使用轉檔設定: %s\n", d.Profile)
+		return d.Profile
+	}
+	
+	if !d.AutoMode {
+		return d.askEncodeMode().ProfileName() // 互動模式詢問
+	}
+	
+	if d.EncodeMode != encoder.NoEncode {
+		fmt.Printf("使用轉檔模式: %d (自動模式)\n", d.EncodeMode)
+	}
+	return d.EncodeMode.ProfileName()
+}
+
 func (d *Downloader) getM3U8URL() (string, string, error) {
 	// 檢測是否在容器環境中運行
 	isContainer := utils.IsRunningInContainer()
@@ -139,7 +442,7 @@ func (d *Downloader) getM3U8URL() (string, string, error) {
 		fmt.Println("檢測到容器環境，使用容器優化配置")
 	}
 	
-	allocCtx, cancel := chromedp.NewExecAllocator(context.Background(), opts...)
+	allocCtx, cancel := chromedp.NewExecAllocator(d.ctx(), opts...)
 	defer cancel()
 	
 	ctx, cancel := chromedp.NewContext(allocCtx)
@@ -171,66 +474,138 @@ func (d *Downloader) getM3U8URL() (string, string, error) {
 	return matches[0], htmlContent, nil
 }
 
-func (d *Downloader) parseM3U8(m3u8URL string) ([]string, []byte, []byte, error) {
+// parseM3U8 解析 M3U8，主播放清單依 Quality 選擇畫質後解析對應的子播放清單
+func (d *Downloader) parseM3U8(m3u8URL string) (*hls.Playlist, error) {
+	return d.parsePlaylist(m3u8URL, true)
+}
+
+func (d *Downloader) parsePlaylist(m3u8URL string, allowMaster bool) (*hls.Playlist, error) {
 	// 下載 M3U8 檔案
 	resp, err := http.Get(m3u8URL)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, err
 	}
 	defer resp.Body.Close()
 	
-	playlist, listType, err := m3u8.DecodeFrom(resp.Body, true)
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	
+	playlist, listType, err := m3u8.Decode(*bytes.NewBuffer(raw), true)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, err
+	}
+	
+	// 取得基礎 URL
+	baseURL := m3u8URL[:strings.LastIndex(m3u8URL, "/")]
+	
+	if listType == m3u8.MASTER && allowMaster {
+		variant, err := selectVariant(playlist.(*m3u8.MasterPlaylist).Variants, d.Quality)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("選擇畫質: %s\n", describeVariant(variant))
+		return d.parsePlaylist(resolveURI(baseURL, variant.URI), false)
 	}
 	
 	if listType != m3u8.MEDIA {
-		return nil, nil, nil, fmt.Errorf("不支援的 M3U8 類型")
+		return nil, fmt.Errorf("不支援的 M3U8 類型")
 	}
 	
 	mediapl := playlist.(*m3u8.MediaPlaylist)
 	
-	// 取得基礎 URL
-	baseURL := m3u8URL[:strings.LastIndex(m3u8URL, "/")]
+	pl := &hls.Playlist{}
 	
 	// 收集 TS URLs
-	var tsList []string
+	explicitOffsets := byteRangeOffsets(raw)
+	rangeIndex := 0
 	for _, segment := range mediapl.Segments {
-		if segment != nil && segment.URI != "" {
-			tsURL := baseURL + "/" + segment.URI
-			tsList = append(tsList, tsURL)
+		if segment == nil || segment.URI == "" {
+			continue
 		}
+		
+		seg := hls.Segment{
+			URL:           resolveURI(baseURL, segment.URI),
+			Duration:      segment.Duration,
+			Discontinuity: segment.Discontinuity,
+		}
+		
+		// EXT-X-BYTERANGE: 省略 @offset 時接續同一個檔案上一段的結尾
+		if segment.Limit > 0 {
+			seg.Length = segment.Limit
+			seg.Offset = segment.Offset
+			hasOffset := rangeIndex < len(explicitOffsets) && explicitOffsets[rangeIndex]
+			if n := len(pl.Segments); !hasOffset && n > 0 {
+				prev := pl.Segments[n-1]
+				if prev.IsByteRange() && prev.URL == seg.URL {
+					seg.Offset = prev.Offset + prev.Length
+				}
+			}
+			seg.Name = hls.ByteRangeFileName(seg.URL, len(pl.Segments))
+			rangeIndex++
+		}
+		
+		pl.Segments = append(pl.Segments, seg)
 	}
 	
-	// 處理加密
-	var aesKey []byte
-	var iv []byte
+	// fMP4/CMAF 初始化片段
+	if mediapl.Map != nil && mediapl.Map.URI != "" {
+		pl.Map = &hls.Segment{
+			URL:    resolveURI(baseURL, mediapl.Map.URI),
+			Name:   hls.InitFileName,
+			Offset: mediapl.Map.Offset,
+			Length: mediapl.Map.Limit,
+		}
+	}
 	
+	// 處理加密
 	if mediapl.Key != nil && mediapl.Key.URI != "" {
-		keyURL := baseURL + "/" + mediapl.Key.URI
+		keyURL := resolveURI(baseURL, mediapl.Key.URI)
 		
 		resp, err := http.Get(keyURL)
 		if err != nil {
-			return nil, nil, nil, fmt.Errorf("獲取金鑰失敗: %v", err)
+			return nil, fmt.Errorf("獲取金鑰失敗: %v", err)
 		}
 		defer resp.Body.Close()
 		
-		aesKey, err = io.ReadAll(resp.Body)
+		pl.Key, err = io.ReadAll(resp.Body)
 		if err != nil {
-			return nil, nil, nil, fmt.Errorf("讀取金鑰失敗: %v", err)
+			return nil, fmt.Errorf("讀取金鑰失敗: %v", err)
 		}
 		
 		// 處理 IV
 		if mediapl.Key.IV != "" {
 			ivStr := strings.TrimPrefix(mediapl.Key.IV, "0x")
-			iv, err = hex.DecodeString(ivStr)
+			pl.IV, err = hex.DecodeString(ivStr)
 			if err != nil {
-				return nil, nil, nil, fmt.Errorf("解析 IV 失敗: %v", err)
+				return nil, fmt.Errorf("解析 IV 失敗: %v", err)
 			}
 		}
 	}
 	
-	return tsList, aesKey, iv, nil
+	return pl, nil
+}
+
+// byteRangeOffsets 依序記錄每個 EXT-X-BYTERANGE 是否明確指定 @offset
+// m3u8 套件在省略 offset 時會回傳 0，無法與明確的 @0 區分
+func byteRangeOffsets(raw []byte) []bool {
+	var offsets []bool
+	for _, line := range strings.Split(string(raw), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#EXT-X-BYTERANGE:") {
+			offsets = append(offsets, strings.Contains(line, "@"))
+		}
+	}
+	return offsets
+}
+
+// resolveURI 將播放清單中的相對路徑轉為完整 URL，絕對 URL 維持不變
+func resolveURI(baseURL, uri string) string {
+	if strings.HasPrefix(uri, "http://") || strings.HasPrefix(uri, "https://") {
+		return uri
+	}
+	return baseURL + "/" + uri
 }
 
 func (d *Downloader) askEncodeMode() encoder.EncodeMode {
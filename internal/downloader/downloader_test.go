@@ -1,16 +1,27 @@
 package downloader
 
 import (
+	"bytes"
+	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"os/exec"
 	"path/filepath"
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/jable-downloader-go/internal/crawler"
 	"github.com/jable-downloader-go/internal/encoder"
+	"github.com/jable-downloader-go/internal/hls"
+	"github.com/jable-downloader-go/internal/hooks"
+	"github.com/jable-downloader-go/internal/merger"
+	"github.com/jable-downloader-go/pkg/utils"
 )
 
 func TestNewDownloader_ValidURL(t *testing.T) {
@@ -44,6 +55,9 @@ func TestNewDownloader_ValidURL(t *testing.T) {
 			if d.EncodeMode != encoder.NoEncode {
 				t.Errorf("expected EncodeMode=NoEncode(%d), got %d", encoder.NoEncode, d.EncodeMode)
 			}
+			if d.Container != merger.ContainerMP4 {
+				t.Errorf("expected Container=mp4, got %q", d.Container)
+			}
 		})
 	}
 }
@@ -135,6 +149,15 @@ func TestM3U8Regex(t *testing.T) {
 	}
 }
 
+// parseM3U8Parts 將 parseM3U8 的結果拆成片段 URL、金鑰與 IV，方便比對
+func parseM3U8Parts(d *Downloader, m3u8URL string) ([]string, []byte, []byte, error) {
+	pl, err := d.parseM3U8(m3u8URL)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return pl.URLs(), pl.Key, pl.IV, nil
+}
+
 // testM3U8Playlist 產生測試用的 M3U8 播放清單
 func testM3U8Playlist(hasKey bool) string {
 	playlist := `#EXTM3U
@@ -168,7 +191,7 @@ func TestParseM3U8_NoEncryption(t *testing.T) {
 
 	m3u8URL := m3u8Server.URL + "/playlist.m3u8"
 	d, _ := NewDownloader("https://jable.tv/videos/test-123/")
-	tsList, aesKey, iv, err := d.parseM3U8(m3u8URL)
+	tsList, aesKey, iv, err := parseM3U8Parts(d, m3u8URL)
 	if err != nil {
 		t.Fatalf("parseM3U8 failed: %v", err)
 	}
@@ -215,7 +238,7 @@ func TestParseM3U8_WithEncryption(t *testing.T) {
 
 	m3u8URL := m3u8Server.URL + "/playlist.m3u8"
 	d, _ := NewDownloader("https://jable.tv/videos/test-123/")
-	tsList, gotKey, gotIV, err := d.parseM3U8(m3u8URL)
+	tsList, gotKey, gotIV, err := parseM3U8Parts(d, m3u8URL)
 	if err != nil {
 		t.Fatalf("parseM3U8 failed: %v", err)
 	}
@@ -238,7 +261,7 @@ func TestParseM3U8_WithEncryption(t *testing.T) {
 
 func TestParseM3U8_InvalidURL(t *testing.T) {
 	d, _ := NewDownloader("https://jable.tv/videos/test-123/")
-	_, _, _, err := d.parseM3U8("http://invalid-url-that-does-not-exist.example/playlist.m3u8")
+	_, _, _, err := parseM3U8Parts(d, "http://invalid-url-that-does-not-exist.example/playlist.m3u8")
 	if err == nil {
 		t.Error("expected error for invalid URL")
 	}
@@ -253,31 +276,58 @@ func TestParseM3U8_InvalidContent(t *testing.T) {
 	defer m3u8Server.Close()
 
 	d, _ := NewDownloader("https://jable.tv/videos/test-123/")
-	_, _, _, err := d.parseM3U8(m3u8Server.URL + "/invalid.m3u8")
+	_, _, _, err := parseM3U8Parts(d, m3u8Server.URL + "/invalid.m3u8")
 	if err == nil {
 		t.Error("expected error for invalid M3U8 content")
 	}
 }
 
-func TestParseM3U8_NonMediaPlaylist(t *testing.T) {
-	// 主播放清單（MASTER），不是 MEDIA
+func TestParseM3U8_MasterPlaylist(t *testing.T) {
+	// 主播放清單（MASTER）依畫質選擇子播放清單
 	masterPlaylist := `#EXTM3U
 #EXT-X-STREAM-INF:BANDWIDTH=1280000,RESOLUTION=1920x1080
-https://cdn.example.com/high.m3u8
+high.m3u8
 #EXT-X-STREAM-INF:BANDWIDTH=640000,RESOLUTION=1280x720
-https://cdn.example.com/low.m3u8`
+low.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=320000,RESOLUTION=854x480
+nested.m3u8`
 
 	m3u8Server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(masterPlaylist))
+		switch r.URL.Path {
+		case "/master.m3u8", "/nested.m3u8":
+			w.Write([]byte(masterPlaylist))
+		default:
+			w.Write([]byte(strings.ReplaceAll(testM3U8Playlist(false), "segment", strings.TrimSuffix(r.URL.Path[1:], ".m3u8")+"-")))
+		}
 	}))
 	defer m3u8Server.Close()
 
+	tests := []struct {
+		quality string
+		first   string
+	}{
+		{"", "/high-1.ts"},
+		{"best", "/high-1.ts"},
+		{"720p", "/low-1.ts"},
+	}
+	for _, tt := range tests {
+		d, _ := NewDownloader("https://jable.tv/videos/test-123/")
+		d.Quality = tt.quality
+		tsList, _, _, err := parseM3U8Parts(d, m3u8Server.URL+"/master.m3u8")
+		if err != nil {
+			t.Fatalf("quality %q: parseM3U8 failed: %v", tt.quality, err)
+		}
+		if len(tsList) != 3 || tsList[0] != m3u8Server.URL+tt.first {
+			t.Errorf("quality %q: expected first segment %s, got %v", tt.quality, tt.first, tsList)
+		}
+	}
+
+	// 子播放清單仍是主播放清單時不再展開
 	d, _ := NewDownloader("https://jable.tv/videos/test-123/")
-	_, _, _, err := d.parseM3U8(m3u8Server.URL + "/master.m3u8")
-	if err == nil {
-		t.Error("expected error for MASTER playlist (not MEDIA)")
+	d.Quality = "worst"
+	if _, _, _, err := parseM3U8Parts(d, m3u8Server.URL+"/master.m3u8"); err == nil {
+		t.Error("expected error for nested MASTER playlist")
 	}
 }
 
@@ -300,7 +350,7 @@ func TestParseM3U8_KeyFetchFailure(t *testing.T) {
 	defer m3u8Server.Close()
 
 	d, _ := NewDownloader("https://jable.tv/videos/test-123/")
-	tsList, aesKey, iv, err := d.parseM3U8(m3u8Server.URL + "/playlist.m3u8")
+	tsList, aesKey, iv, err := parseM3U8Parts(d, m3u8Server.URL + "/playlist.m3u8")
 	if err != nil {
 		t.Fatalf("parseM3U8 failed: %v", err)
 	}
@@ -340,7 +390,7 @@ seg1.ts
 	defer m3u8Server.Close()
 
 	d, _ := NewDownloader("https://jable.tv/videos/test-123/")
-	_, _, _, err := d.parseM3U8(m3u8Server.URL + "/playlist.m3u8")
+	_, _, _, err := parseM3U8Parts(d, m3u8Server.URL + "/playlist.m3u8")
 	if err != nil {
 		t.Logf("parseM3U8 returned error (expected if key URL unreachable): %v", err)
 	} else {
@@ -377,7 +427,7 @@ seg1.ts
 	defer m3u8Server.Close()
 
 	d, _ := NewDownloader("https://jable.tv/videos/test-123/")
-	_, gotKey, _, err := d.parseM3U8(m3u8Server.URL + "/playlist.m3u8")
+	_, gotKey, _, err := parseM3U8Parts(d, m3u8Server.URL + "/playlist.m3u8")
 	if err != nil {
 		t.Fatalf("parseM3U8 failed: %v", err)
 	}
@@ -400,3 +450,333 @@ func TestEncodeModeConstants(t *testing.T) {
 		t.Errorf("expected CPUEncode=3, got %d", encoder.CPUEncode)
 	}
 }
+
+func TestParseM3U8_FragmentedMP4(t *testing.T) {
+	m3u8Content := `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-TARGETDURATION:6
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-MAP:URI="init-v1.mp4"
+#EXTINF:6.000,
+seg1.m4s
+#EXTINF:6.000,
+seg2.m4s
+#EXT-X-ENDLIST`
+
+	m3u8Server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(m3u8Content))
+	}))
+	defer m3u8Server.Close()
+
+	d, _ := NewDownloader("https://jable.tv/videos/test-123/")
+	pl, err := d.parseM3U8(m3u8Server.URL + "/playlist.m3u8")
+	if err != nil {
+		t.Fatalf("parseM3U8 failed: %v", err)
+	}
+
+	if !pl.IsFragmented() {
+		t.Fatal("expected fragmented playlist with EXT-X-MAP")
+	}
+	if pl.Map.URL != m3u8Server.URL+"/init-v1.mp4" {
+		t.Errorf("expected init URL %q, got %q", m3u8Server.URL+"/init-v1.mp4", pl.Map.URL)
+	}
+	if pl.Map.FileName() != hls.InitFileName {
+		t.Errorf("expected init file name %q, got %q", hls.InitFileName, pl.Map.FileName())
+	}
+	if len(pl.Segments) != 2 {
+		t.Fatalf("expected 2 segments, got %d", len(pl.Segments))
+	}
+	if pl.Segments[0].FileName() != "seg1.m4s" {
+		t.Errorf("expected segment file name 'seg1.m4s', got %q", pl.Segments[0].FileName())
+	}
+}
+
+func TestParseM3U8_ByteRange(t *testing.T) {
+	// 整部影片為單一檔案，片段以位元組範圍定位；第二、三段省略 @offset
+	video := []byte(strings.Repeat("0123456789", 10)) // 100 bytes
+
+	m3u8Content := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-TARGETDURATION:10
+#EXT-X-MEDIA-SEQUENCE:0
+#EXTINF:10.000,
+#EXT-X-BYTERANGE:40@0
+video.ts
+#EXTINF:10.000,
+#EXT-X-BYTERANGE:30
+video.ts
+#EXTINF:10.000,
+#EXT-X-BYTERANGE:30
+video.ts
+#EXT-X-ENDLIST`
+
+	m3u8Server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "video.ts") {
+			http.ServeContent(w, r, "video.ts", time.Time{}, bytes.NewReader(video))
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		w.Write([]byte(m3u8Content))
+	}))
+	defer m3u8Server.Close()
+
+	d, _ := NewDownloader("https://jable.tv/videos/test-123/")
+	pl, err := d.parseM3U8(m3u8Server.URL + "/playlist.m3u8")
+	if err != nil {
+		t.Fatalf("parseM3U8 failed: %v", err)
+	}
+
+	want := []struct {
+		offset, length int64
+		name           string
+	}{
+		{0, 40, "video_00000.mp4"},
+		{40, 30, "video_00001.mp4"},
+		{70, 30, "video_00002.mp4"},
+	}
+	if len(pl.Segments) != len(want) {
+		t.Fatalf("expected %d segments, got %d", len(want), len(pl.Segments))
+	}
+	for i, w := range want {
+		seg := pl.Segments[i]
+		if seg.Offset != w.offset || seg.Length != w.length {
+			t.Errorf("segment %d: expected range %d+%d, got %d+%d", i, w.offset, w.length, seg.Offset, seg.Length)
+		}
+		if seg.FileName() != w.name {
+			t.Errorf("segment %d: expected file name %q, got %q", i, w.name, seg.FileName())
+		}
+	}
+
+	// 以 Range 請求下載後，依序串接應還原原始檔案
+	dir := t.TempDir()
+	c, err := crawler.NewPlaylistCrawler(dir, pl)
+	if err != nil {
+		t.Fatalf("NewPlaylistCrawler failed: %v", err)
+	}
+	if err := c.Download(); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	var merged []byte
+	for _, seg := range pl.Segments {
+		data, err := os.ReadFile(filepath.Join(dir, seg.FileName()))
+		if err != nil {
+			t.Fatalf("expected segment file %s: %v", seg.FileName(), err)
+		}
+		merged = append(merged, data...)
+	}
+	if !bytes.Equal(merged, video) {
+		t.Errorf("merged content mismatch:\n got:  %q\n want: %q", merged, video)
+	}
+}
+
+func TestParseM3U8_ByteRangeExplicitZeroOffset(t *testing.T) {
+	// 明確的 @0 不應被視為接續上一段
+	m3u8Content := `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-TARGETDURATION:10
+#EXTINF:10.000,
+#EXT-X-BYTERANGE:40@0
+a.ts
+#EXTINF:10.000,
+#EXT-X-BYTERANGE:40@0
+a.ts
+#EXT-X-ENDLIST`
+
+	m3u8Server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(m3u8Content))
+	}))
+	defer m3u8Server.Close()
+
+	d, _ := NewDownloader("https://jable.tv/videos/test-123/")
+	pl, err := d.parseM3U8(m3u8Server.URL + "/playlist.m3u8")
+	if err != nil {
+		t.Fatalf("parseM3U8 failed: %v", err)
+	}
+	if len(pl.Segments) != 2 || pl.Segments[1].Offset != 0 {
+		t.Errorf("expected explicit @0 offset to be kept, got %+v", pl.Segments)
+	}
+}
+
+func TestParseM3U8_Discontinuity(t *testing.T) {
+	m3u8Content := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:10
+#EXTINF:10.000,
+main1.ts
+#EXT-X-DISCONTINUITY
+#EXTINF:5.000,
+https://ads.example.net/ad1.ts
+#EXT-X-DISCONTINUITY
+#EXTINF:10.000,
+main2.ts
+#EXTINF:10.000,
+main3.ts
+#EXT-X-ENDLIST`
+
+	m3u8Server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(m3u8Content))
+	}))
+	defer m3u8Server.Close()
+
+	d, _ := NewDownloader("https://jable.tv/videos/test-123/")
+	pl, err := d.parseM3U8(m3u8Server.URL + "/playlist.m3u8")
+	if err != nil {
+		t.Fatalf("parseM3U8 failed: %v", err)
+	}
+
+	if !pl.HasDiscontinuity() {
+		t.Fatal("expected discontinuity markers to be kept")
+	}
+	if groups := pl.Groups(); len(groups) != 3 {
+		t.Errorf("expected 3 discontinuity groups, got %d", len(groups))
+	}
+	if pl.Segments[1].URL != "https://ads.example.net/ad1.ts" {
+		t.Errorf("absolute segment URI should be kept, got %q", pl.Segments[1].URL)
+	}
+	if pl.Segments[1].Duration != 5 {
+		t.Errorf("expected duration 5, got %v", pl.Segments[1].Duration)
+	}
+
+	if dropped := pl.DropAds(hls.AdFilter{ForeignHost: true}); dropped != 1 {
+		t.Errorf("expected 1 ad segment dropped, got %d", dropped)
+	}
+}
+
+func TestDownloaderMetadata(t *testing.T) {
+	d, _ := NewDownloader("https://jable.tv/videos/abc-123/")
+	d.Info = &utils.VideoInfo{Title: "ABC-123 標題", Actresses: []string{"演員"}}
+
+	if got := d.metadata("abc-123"); got["title"] != "ABC-123 標題" || got["artist"] != "演員" || got["comment"] != d.URL {
+		t.Errorf("unexpected metadata: %v", got)
+	}
+	if got := d.metadata("abc-123-part2"); got["title"] != "ABC-123 標題 (part2)" {
+		t.Errorf("expected part suffix in title, got %q", got["title"])
+	}
+
+	// 沒有影片資訊時以番號為標題
+	d.Info = nil
+	if got := d.metadata("abc-123"); got["title"] != "abc-123" {
+		t.Errorf("expected folder name as title, got %q", got["title"])
+	}
+}
+
+func TestPostProcess_RecordsWarnings(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "abc-123")
+	os.MkdirAll(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "abc-123.mp4"), []byte("not a video"), 0644)
+
+	d, _ := NewDownloaderFromFolder(dir)
+	d.postProcess(encoder.ProfileCPU)
+
+	if len(d.Warnings) == 0 {
+		t.Error("expected post-processing warnings for an invalid video")
+	}
+	// 後處理失敗時影片必須保留
+	if data, _ := os.ReadFile(filepath.Join(dir, "abc-123.mp4")); string(data) != "not a video" {
+		t.Errorf("video should be kept after failed post-processing, got %q", data)
+	}
+}
+
+func TestWithHooks(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	marker := filepath.Join(t.TempDir(), "failed.txt")
+
+	d, _ := NewDownloader("https://jable.tv/videos/abc-123/")
+	d.Hooks = &hooks.Pipeline{Hooks: []hooks.Hook{{
+		Event:   hooks.EventFailed,
+		Command: []string{"sh", "-c", `echo "$JABLE_ERROR" > "$0"`, marker},
+	}}}
+
+	// hook 要求略過後續階段時視為成功
+	if err := d.withHooks(func() error { return hooks.ErrSkip }); err != nil {
+		t.Errorf("skip should not be an error, got %v", err)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Error("on_failure hook should not run when skipping")
+	}
+
+	// 失敗時執行 on_failure hook 並保留原本的錯誤
+	err := d.withHooks(func() error { return fmt.Errorf("下載失敗: boom") })
+	if err == nil || err.Error() != "下載失敗: boom" {
+		t.Errorf("expected original error, got %v", err)
+	}
+	if data, _ := os.ReadFile(marker); strings.TrimSpace(string(data)) != "下載失敗: boom" {
+		t.Errorf("on_failure hook should receive the error, got %q", data)
+	}
+}
+
+func TestWithHooks_Cancelled(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	marker := filepath.Join(t.TempDir(), "failed.txt")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	d, _ := NewDownloader("https://jable.tv/videos/abc-123/")
+	d.Context = ctx
+	d.Hooks = &hooks.Pipeline{Hooks: []hooks.Hook{{
+		Event:   hooks.EventFailed,
+		Command: []string{"sh", "-c", `touch "$0"`, marker},
+	}}}
+
+	// 被取消時回傳 context.Canceled，不視為失敗
+	err := d.withHooks(func() error { return fmt.Errorf("下載失敗: %v", ctx.Err()) })
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Error("on_failure hook should not run when cancelled")
+	}
+}
+
+func TestVideoCode(t *testing.T) {
+	tests := []struct {
+		url  string
+		code string
+	}{
+		{"https://jable.tv/videos/ipx-486/", "ipx-486"},
+		{"https://jable.tv/videos/ipx-486", "ipx-486"},
+		{"https://jable.tv/videos/ipx-486/?lang=en", "ipx-486"},
+		{"https://jable.tv/videos/ipx-486#player", "ipx-486"},
+	}
+	for _, tt := range tests {
+		code, err := VideoCode(tt.url)
+		if err != nil || code != tt.code {
+			t.Errorf("VideoCode(%q) = %q, %v; want %q", tt.url, code, err, tt.code)
+		}
+	}
+	if _, err := VideoCode("not-a-url"); err == nil {
+		t.Error("expected error for invalid URL")
+	}
+}
+
+func TestSetOutputDir(t *testing.T) {
+	d, _ := NewDownloader("https://jable.tv/videos/abc-123/")
+
+	d.SetOutputDir(filepath.Join("library", "new"))
+	if want := filepath.Join("library", "new", "abc-123"); d.FolderPath != want {
+		t.Errorf("expected FolderPath=%q, got %q", want, d.FolderPath)
+	}
+	d.SetOutputDir("")
+	if want := filepath.Join("download", "abc-123"); d.FolderPath != want {
+		t.Errorf("expected FolderPath=%q, got %q", want, d.FolderPath)
+	}
+}
+
+func TestMetadata_NoMetadata(t *testing.T) {
+	d, _ := NewDownloader("https://jable.tv/videos/abc-123/")
+	if d.metadata("abc-123")["title"] != "abc-123" {
+		t.Error("expected title to default to the video code")
+	}
+	d.NoMetadata = true
+	if metadata := d.metadata("abc-123"); metadata != nil {
+		t.Errorf("expected no metadata, got %v", metadata)
+	}
+}
@@ -0,0 +1,67 @@
+package downloader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jable-downloader-go/internal/config"
+	"github.com/jable-downloader-go/internal/encoder"
+	"github.com/jable-downloader-go/internal/merger"
+)
+
+// NewDownloaderFromFolder 以既有的番號資料夾建立 Downloader，供 merge 指令使用
+func NewDownloaderFromFolder(folderPath string) (*Downloader, error) {
+	info, err := os.Stat(folderPath)
+	if err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("找不到資料夾: %s", folderPath)
+	}
+
+	folderPath = filepath.Clean(folderPath)
+	d := &Downloader{
+		DirName:    filepath.Base(folderPath),
+		FolderPath: folderPath,
+		AutoMode:   false,
+		EncodeMode: encoder.NoEncode,
+		Container:  merger.Container(config.DefaultContainer),
+	}
+
+	if m, err := merger.LoadManifest(folderPath); err == nil {
+		d.URL = m.URL
+		d.Info = m.Info
+	}
+	return d, nil
+}
+
+// Remerge 以資料夾內已下載的片段重新合成影片，不需要網路
+func (d *Downloader) Remerge() error {
+	return d.withHooks(d.remerge)
+}
+
+func (d *Downloader) remerge() error {
+	profile := d.encodeProfile()
+	if err := encoder.CheckProfile(profile); err != nil {
+		return err
+	}
+	m, err := merger.LoadManifest(d.FolderPath)
+	if err != nil || !m.HasSegments(d.FolderPath) {
+		// 片段已清理但影片已合成，僅重新轉檔（片段清單保留的影片資訊仍會寫入標籤）
+		if len(merger.ExistingOutputs(d.FolderPath, d.Container)) > 0 {
+			fmt.Println("找不到片段, 僅重新執行轉檔...")
+			return d.postProcess(profile)
+		}
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("資料夾內沒有已下載的片段: %s", d.FolderPath)
+	}
+
+	fmt.Printf("正在重新合成影片: %s (%d 個片段)\n", d.DirName, len(m.Segments))
+
+	// 移除上次失敗留下的不完整輸出，避免 FFmpeg 詢問是否覆寫
+	if err := merger.RemoveOutputs(d.FolderPath, d.Container); err != nil {
+		return err
+	}
+
+	return d.finalize(&m.Playlist, profile)
+}
@@ -0,0 +1,126 @@
+package downloader
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jable-downloader-go/internal/encoder"
+	"github.com/jable-downloader-go/internal/hls"
+	"github.com/jable-downloader-go/internal/merger"
+)
+
+func TestNewDownloaderFromFolder(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "abc-123")
+	os.MkdirAll(dir, 0755)
+
+	merger.SaveManifest(dir, &merger.Manifest{
+		URL:      "https://jable.tv/videos/abc-123/",
+		Playlist: *hls.NewPlaylist([]string{"https://cdn.example.com/seg1.ts"}),
+	})
+
+	d, err := NewDownloaderFromFolder(dir + "/")
+	if err != nil {
+		t.Fatalf("NewDownloaderFromFolder failed: %v", err)
+	}
+	if d.DirName != "abc-123" {
+		t.Errorf("expected DirName 'abc-123', got %q", d.DirName)
+	}
+	if d.FolderPath != dir {
+		t.Errorf("expected FolderPath %q, got %q", dir, d.FolderPath)
+	}
+	if d.URL != "https://jable.tv/videos/abc-123/" {
+		t.Errorf("expected URL from manifest, got %q", d.URL)
+	}
+}
+
+func TestNewDownloaderFromFolder_Missing(t *testing.T) {
+	if _, err := NewDownloaderFromFolder(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected error for non-existent folder")
+	}
+}
+
+func TestRemerge_NoManifestNoVideo(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "abc-123")
+	os.MkdirAll(dir, 0755)
+
+	d, _ := NewDownloaderFromFolder(dir)
+	d.AutoMode = true
+
+	if err := d.Remerge(); err == nil {
+		t.Error("expected error when neither manifest nor video exists")
+	}
+}
+
+func TestRemerge_UsesManifestOrder(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "abc-123")
+	os.MkdirAll(dir, 0755)
+
+	os.WriteFile(filepath.Join(dir, "seg1.mp4"), []byte("data"), 0644)
+	os.WriteFile(filepath.Join(dir, "seg2.mp4"), []byte("data"), 0644)
+	// 上次失敗留下的不完整輸出
+	os.WriteFile(filepath.Join(dir, "abc-123.mp4"), []byte("partial"), 0644)
+
+	merger.SaveManifest(dir, &merger.Manifest{
+		Playlist: *hls.NewPlaylist([]string{"https://cdn.example.com/seg1.ts", "https://cdn.example.com/seg2.ts"}),
+	})
+
+	d, _ := NewDownloaderFromFolder(dir)
+	d.AutoMode = true
+	d.EncodeMode = encoder.NoEncode
+
+	err := d.Remerge()
+	if err == nil {
+		t.Log("FFmpeg succeeded unexpectedly (segments were not valid video)")
+		return
+	}
+	if !strings.Contains(err.Error(), "合併失敗") {
+		t.Errorf("expected merge error, got: %v", err)
+	}
+
+	// 合成失敗時片段與清單必須保留，供下次重試
+	for _, f := range []string{"seg1.mp4", "seg2.mp4", merger.ManifestFile} {
+		if _, statErr := os.Stat(filepath.Join(dir, f)); os.IsNotExist(statErr) {
+			t.Errorf("%s should not be deleted after failed merge", f)
+		}
+	}
+}
+
+func TestRemerge_SegmentsCleaned(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "abc-123")
+	os.MkdirAll(dir, 0755)
+
+	// 片段已清理，只剩片段清單
+	merger.SaveManifest(dir, &merger.Manifest{
+		Playlist: *hls.NewPlaylist([]string{"https://cdn.example.com/seg1.ts"}),
+	})
+
+	d, _ := NewDownloaderFromFolder(dir)
+	d.AutoMode = true
+
+	err := d.Remerge()
+	if err == nil || !strings.Contains(err.Error(), "沒有已下載的片段") {
+		t.Errorf("expected missing segments error, got %v", err)
+	}
+}
+
+func TestCleanup_KeepsManifest(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "abc-123")
+	os.MkdirAll(dir, 0755)
+	for _, f := range []string{"seg1.ts", "abc-123.mp4", "abc-123.jpg", merger.ManifestFile} {
+		os.WriteFile(filepath.Join(dir, f), []byte("data"), 0644)
+	}
+
+	d, _ := NewDownloaderFromFolder(dir)
+	d.cleanup()
+
+	if _, err := os.Stat(filepath.Join(dir, "seg1.ts")); !os.IsNotExist(err) {
+		t.Error("segments should be deleted")
+	}
+	for _, f := range []string{"abc-123.mp4", "abc-123.jpg", merger.ManifestFile} {
+		if _, err := os.Stat(filepath.Join(dir, f)); err != nil {
+			t.Errorf("%s should be kept: %v", f, err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package downloader
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/grafov/m3u8"
+)
+
+// 主播放清單的畫質選擇
+const (
+	QualityBest  = "best"  // 頻寬最高的畫質（預設）
+	QualityWorst = "worst" // 頻寬最低的畫質
+)
+
+// ParseQuality 檢查並正規化畫質設定: best、worst 或最高解析度，例如 720p
+// 空字串視為 best
+func ParseQuality(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch s {
+	case "":
+		return QualityBest, nil
+	case QualityBest, QualityWorst:
+		return s, nil
+	}
+	if height, err := strconv.Atoi(strings.TrimSuffix(s, "p")); err == nil && height > 0 {
+		return strconv.Itoa(height) + "p", nil
+	}
+	return "", fmt.Errorf("無效的畫質: %s (可用: best, worst 或解析度, 例如 720p)", s)
+}
+
+// selectVariant 依畫質設定從主播放清單選擇一個子播放清單
+// 指定解析度時選擇不超過該高度中頻寬最高的畫質，都超過時選擇最低的畫質
+func selectVariant(variants []*m3u8.Variant, quality string) (*m3u8.Variant, error) {
+	quality, err := ParseQuality(quality)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []*m3u8.Variant
+	for _, v := range variants {
+		if v != nil && v.URI != "" && !v.Iframe {
+			candidates = append(candidates, v)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("主播放清單中沒有可用的畫質")
+	}
+
+	best, worst := candidates[0], candidates[0]
+	for _, v := range candidates[1:] {
+		if v.Bandwidth > best.Bandwidth {
+			best = v
+		}
+		if v.Bandwidth < worst.Bandwidth {
+			worst = v
+		}
+	}
+
+	switch quality {
+	case QualityBest:
+		return best, nil
+	case QualityWorst:
+		return worst, nil
+	}
+
+	maxHeight, _ := strconv.Atoi(strings.TrimSuffix(quality, "p"))
+	var chosen, lowest *m3u8.Variant
+	for _, v := range candidates {
+		height := variantHeight(v)
+		if lowest == nil || height < variantHeight(lowest) {
+			lowest = v
+		}
+		if height <= maxHeight && (chosen == nil || v.Bandwidth > chosen.Bandwidth) {
+			chosen = v
+		}
+	}
+	if chosen == nil {
+		chosen = lowest
+	}
+	return chosen, nil
+}
+
+// variantHeight 從 RESOLUTION (例如 1920x1080) 取得畫面高度，未標示時回傳 0
+func variantHeight(v *m3u8.Variant) int {
+	_, h, ok := strings.Cut(v.Resolution, "x")
+	if !ok {
+		return 0
+	}
+	height, _ := strconv.Atoi(h)
+	return height
+}
+
+// describeVariant 回傳畫質說明，例如 1920x1080 (1280 kbps)
+func describeVariant(v *m3u8.Variant) string {
+	if v.Resolution == "" {
+		return fmt.Sprintf("%d kbps", v.Bandwidth/1000)
+	}
+	return fmt.Sprintf("%s (%d kbps)", v.Resolution, v.Bandwidth/1000)
+}
@@ -0,0 +1,56 @@
+package downloader
+
+import (
+	"testing"
+
+	"github.com/grafov/m3u8"
+)
+
+func testVariants() []*m3u8.Variant {
+	variant := func(uri string, bandwidth uint32, resolution string) *m3u8.Variant {
+		return &m3u8.Variant{URI: uri, VariantParams: m3u8.VariantParams{Bandwidth: bandwidth, Resolution: resolution}}
+	}
+	return []*m3u8.Variant{
+		variant("720.m3u8", 2000000, "1280x720"),
+		variant("1080.m3u8", 5000000, "1920x1080"),
+		variant("480.m3u8", 800000, "854x480"),
+		{URI: "iframe.m3u8", VariantParams: m3u8.VariantParams{Bandwidth: 9000000, Iframe: true}},
+	}
+}
+
+func TestSelectVariant(t *testing.T) {
+	tests := []struct {
+		quality string
+		want    string
+	}{
+		{"", "1080.m3u8"},
+		{"best", "1080.m3u8"},
+		{"worst", "480.m3u8"},
+		{"720p", "720.m3u8"},
+		{"1000", "720.m3u8"},
+		{"360p", "480.m3u8"}, // 都超過時選擇最低的畫質
+	}
+	for _, tt := range tests {
+		v, err := selectVariant(testVariants(), tt.quality)
+		if err != nil || v.URI != tt.want {
+			t.Errorf("selectVariant(%q) = %v, %v; want %s", tt.quality, v, err, tt.want)
+		}
+	}
+
+	if _, err := selectVariant(nil, "best"); err == nil {
+		t.Error("expected error for empty master playlist")
+	}
+}
+
+func TestParseQuality(t *testing.T) {
+	for in, want := range map[string]string{"": "best", "BEST": "best", "worst": "worst", "720": "720p", "1080p": "1080p"} {
+		if got, err := ParseQuality(in); err != nil || got != want {
+			t.Errorf("ParseQuality(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"hd", "0p", "-720p"} {
+		if _, err := ParseQuality(in); err == nil {
+			t.Errorf("ParseQuality(%q) should fail", in)
+		}
+	}
+}
@@ -0,0 +1,386 @@
+package encoder
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Capabilities 本機 FFmpeg 支援的編碼器、硬體加速方式與濾鏡
+type Capabilities struct {
+	Encoders map[string]bool
+	HWAccels map[string]bool
+	Filters  map[string]bool // 例如 libvmaf
+	FFprobe  bool            // 目標大小與品質模式需要 ffprobe 取得影片長度
+
+	// testEncode 試編碼一個畫面確認編碼器可以在本機執行，nil 時只依編碼器清單判斷
+	testEncode func(codec string) error
+
+	mu     sync.Mutex
+	tested map[string]bool // 試編碼結果
+}
+
+// encoderFallbacks 硬體編碼器不可用時依序嘗試的替代編碼器，最後一個為 CPU 編碼器
+var encoderFallbacks = map[string][]string{
+	"h264_nvenc": {"h264_nvenc", "h264_vaapi", "h264_qsv", "libx264"},
+	"hevc_nvenc": {"hevc_nvenc", "hevc_vaapi", "hevc_qsv", "libx265"},
+}
+
+// encoderHWAccels 硬體編碼器需要的硬體加速方式
+var encoderHWAccels = map[string]string{
+	"nvenc": "cuda",
+	"vaapi": "vaapi",
+	"qsv":   "qsv",
+}
+
+// VAAPIDevice VAAPI 編碼使用的 DRM 裝置
+const VAAPIDevice = "/dev/dri/renderD128"
+
+var (
+	capsOnce sync.Once
+	caps     *Capabilities
+	capsErr  error
+)
+
+// testEncodeTimeout 單一編碼器試編碼的時間上限
+const testEncodeTimeout = 30 * time.Second
+
+// ProbeCapabilities 執行 ffmpeg -encoders、-hwaccels 與 -filters 並確認 ffprobe，結果只偵測一次並快取
+// 編碼器實際使用前會再試編碼一個畫面，結果同樣快取
+func ProbeCapabilities() (*Capabilities, error) {
+	capsOnce.Do(func() {
+		caps, capsErr = probeCapabilities()
+	})
+	return caps, capsErr
+}
+
+func probeCapabilities() (*Capabilities, error) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return nil, fmt.Errorf("找不到 FFmpeg，請先安裝並加入 PATH: %v", err)
+	}
+
+	encoders, err := exec.Command("ffmpeg", "-hide_banner", "-encoders").Output()
+	if err != nil {
+		return nil, fmt.Errorf("無法取得 FFmpeg 編碼器清單: %v", err)
+	}
+	hwaccels, err := exec.Command("ffmpeg", "-hide_banner", "-hwaccels").Output()
+	if err != nil {
+		return nil, fmt.Errorf("無法取得 FFmpeg 硬體加速清單: %v", err)
+	}
+	filters, err := exec.Command("ffmpeg", "-hide_banner", "-filters").Output()
+	if err != nil {
+		return nil, fmt.Errorf("無法取得 FFmpeg 濾鏡清單: %v", err)
+	}
+	_, ffprobeErr := exec.LookPath("ffprobe")
+
+	return &Capabilities{
+		Encoders:   parseEncoders(string(encoders)),
+		HWAccels:   parseHWAccels(string(hwaccels)),
+		Filters:    parseFilters(string(filters)),
+		FFprobe:    ffprobeErr == nil,
+		testEncode: testEncode,
+	}, nil
+}
+
+// testEncode 以 nullsrc 產生一個畫面交給編碼器編碼
+// -encoders 只列出 FFmpeg 編譯時包含的編碼器，例如靜態編譯含 nvenc 的 FFmpeg
+// 在沒有 NVIDIA GPU 的主機上也會列出，必須實際編碼才知道能否使用
+func testEncode(codec string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), testEncodeTimeout)
+	defer cancel()
+
+	p := Profile{Name: "probe", VideoCodec: codec}.withEncoder(codec)
+	args := append([]string{"-hide_banner", "-v", "error"}, p.InputArgs...)
+	// NVENC 有最小解析度限制，畫面太小會誤判為不可用
+	args = append(args, "-f", "lavfi", "-i", "nullsrc=s=256x256", "-frames:v", "1")
+	args = append(args, p.Args()...)
+	args = append(args, "-f", "null", "-")
+
+	out, err := exec.CommandContext(ctx, "ffmpeg", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// parseEncoders 解析 ffmpeg -encoders 輸出，例如 " V....D libx264  libx264 H.264 ..."
+func parseEncoders(output string) map[string]bool {
+	encoders := make(map[string]bool)
+	started := false
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "---") {
+			started = true
+			continue
+		}
+		fields := strings.Fields(line)
+		if !started || len(fields) < 2 {
+			continue
+		}
+		encoders[fields[1]] = true
+	}
+	return encoders
+}
+
+// parseHWAccels 解析 ffmpeg -hwaccels 輸出
+func parseHWAccels(output string) map[string]bool {
+	hwaccels := make(map[string]bool)
+	started := false
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "Hardware acceleration methods") {
+			started = true
+			continue
+		}
+		if started && line != "" {
+			hwaccels[line] = true
+		}
+	}
+	return hwaccels
+}
+
+// parseFilters 解析 ffmpeg -filters 輸出，例如 " ... libvmaf  VV->V  Calculate the VMAF ..."
+func parseFilters(output string) map[string]bool {
+	filters := make(map[string]bool)
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// 說明行為 "T.. = Timeline support" 或 "A = Audio input/output"
+		if len(fields) < 3 || len(fields[0]) != 3 || fields[1] == "=" {
+			continue
+		}
+		if strings.Trim(fields[0], "TSC.") != "" {
+			continue
+		}
+		filters[fields[1]] = true
+	}
+	return filters
+}
+
+// Supports 編碼器是否可用，硬體編碼器同時需要對應的硬體加速方式
+// 清單中有的編碼器會再試編碼一個畫面，結果快取
+func (c *Capabilities) Supports(encoder string) bool {
+	if encoder == "copy" {
+		return true
+	}
+	if !c.Encoders[encoder] {
+		return false
+	}
+	for suffix, hwaccel := range encoderHWAccels {
+		if strings.HasSuffix(encoder, "_"+suffix) && !c.HWAccels[hwaccel] {
+			return false
+		}
+	}
+	return c.works(encoder)
+}
+
+// works 回傳試編碼是否成功，每個編碼器只試一次
+func (c *Capabilities) works(encoder string) bool {
+	if c.testEncode == nil {
+		return true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if ok, done := c.tested[encoder]; done {
+		return ok
+	}
+	err := c.testEncode(encoder)
+	if err != nil {
+		fmt.Printf("編碼器 %s 試編碼失敗，改用其他編碼器: %v\n", encoder, err)
+	}
+	if c.tested == nil {
+		c.tested = make(map[string]bool)
+	}
+	c.tested[encoder] = err == nil
+	return err == nil
+}
+
+// HasFilter 回傳 FFmpeg 是否包含指定的濾鏡
+func (c *Capabilities) HasFilter(name string) bool {
+	return c.Filters[name]
+}
+
+// Resolve 依本機能力調整轉檔設定，硬體編碼器不可用時改用替代編碼器
+func (c *Capabilities) Resolve(p Profile) (Profile, error) {
+	if err := c.CheckRequirements(p); err != nil {
+		return p, err
+	}
+
+	candidates := encoderCandidates(p.VideoCodec)
+	for _, codec := range candidates {
+		if !c.Supports(codec) {
+			continue
+		}
+		if codec != p.VideoCodec {
+			p = p.withEncoder(codec)
+		}
+		return p, nil
+	}
+	return p, fmt.Errorf("轉檔設定 %s 找不到可用的編碼器 (嘗試: %s)", p.Name, strings.Join(candidates, ", "))
+}
+
+// encoderCandidates 回傳依序嘗試的編碼器，沒有替代編碼器時只有 codec 本身
+func encoderCandidates(codec string) []string {
+	if candidates, ok := encoderFallbacks[codec]; ok {
+		return candidates
+	}
+	return []string{codec}
+}
+
+// CheckRequirements 確認轉檔設定需要的 FFmpeg 功能
+// 目標大小與品質模式需要 ffprobe 取得影片長度，品質模式以 VMAF 為目標時需要 libvmaf
+func (c *Capabilities) CheckRequirements(p Profile) error {
+	if (p.IsTargetSize() || p.IsTargetQuality()) && !c.FFprobe {
+		return fmt.Errorf("轉檔設定 %s 需要 ffprobe 取得影片長度，請安裝完整的 FFmpeg", p.Name)
+	}
+	if p.TargetVMAF > 0 && !c.HasFilter("libvmaf") {
+		return fmt.Errorf("轉檔設定 %s 以 VMAF 為目標，但 FFmpeg 不包含 libvmaf 濾鏡 (可改用 target_ssim)", p.Name)
+	}
+	return nil
+}
+
+// CheckProfileRequirements 在下載前確認轉檔設定需要的 FFmpeg 功能，避免下載完成後才無法轉檔
+// 只有需要 ffprobe 或額外濾鏡的設定才偵測本機能力
+func CheckProfileRequirements(name string) error {
+	p, err := GetProfile(name)
+	if err != nil {
+		return err
+	}
+	if !p.IsTargetSize() && !p.IsTargetQuality() {
+		return nil
+	}
+
+	c, err := ProbeCapabilities()
+	if err != nil {
+		return err
+	}
+	return c.CheckRequirements(p)
+}
+
+// nvencPresets NVENC 的 p1-p7 對應的 x264、x265 與 QSV preset
+var nvencPresets = map[string]string{
+	"p1": "veryfast",
+	"p2": "faster",
+	"p3": "fast",
+	"p4": "medium",
+	"p5": "slow",
+	"p6": "slower",
+	"p7": "veryslow",
+}
+
+// fallbackPreset 將 preset 轉換為替代編碼器可用的名稱，沒有對應名稱時回傳空字串（使用編碼器預設）
+func fallbackPreset(preset, codec string) string {
+	if strings.HasSuffix(codec, "_vaapi") {
+		return "" // VAAPI 編碼器沒有 preset
+	}
+	if mapped, ok := nvencPresets[preset]; ok {
+		return mapped
+	}
+	switch preset {
+	case "veryfast", "faster", "fast", "medium", "slow", "slower", "veryslow":
+		return preset
+	case "ultrafast", "superfast", "placebo":
+		if strings.HasPrefix(codec, "lib") {
+			return preset // QSV 沒有這幾個 preset
+		}
+	}
+	return ""
+}
+
+// withEncoder 回傳改用其他編碼器的轉檔設定，preset 轉換為新編碼器可用的名稱
+func (p Profile) withEncoder(codec string) Profile {
+	if codec != p.VideoCodec {
+		p.Preset = fallbackPreset(p.Preset, codec)
+	}
+	p.VideoCodec = codec
+	if strings.HasSuffix(codec, "_vaapi") {
+		p.InputArgs = append([]string{"-vaapi_device", VAAPIDevice}, p.InputArgs...)
+	}
+	return p
+}
+
+// Report 回傳 codec 的候選編碼器與偵測結果摘要，例如 "編碼器: h264_nvenc (不可用), libx264; 硬體加速: 無; ffprobe: 有; libvmaf: 無"
+// 只列出到第一個可用的候選編碼器，這些編碼器在 Resolve 時已試編碼過，不會再執行 FFmpeg
+func (c *Capabilities) Report(codec string) string {
+	var encoders []string
+	for _, candidate := range encoderCandidates(codec) {
+		if c.Supports(candidate) {
+			encoders = append(encoders, candidate)
+			break
+		}
+		encoders = append(encoders, candidate+" (不可用)")
+	}
+	var hwaccels []string
+	for name := range c.HWAccels {
+		hwaccels = append(hwaccels, name)
+	}
+	sort.Strings(hwaccels)
+
+	if len(hwaccels) == 0 {
+		hwaccels = []string{"無"}
+	}
+	return fmt.Sprintf("編碼器: %s; 硬體加速: %s; ffprobe: %s; libvmaf: %s",
+		strings.Join(encoders, ", "), strings.Join(hwaccels, ", "), yesNo(c.FFprobe), yesNo(c.HasFilter("libvmaf")))
+}
+
+// yesNo 將偵測結果轉為 有/無
+func yesNo(ok bool) string {
+	if ok {
+		return "有"
+	}
+	return "無"
+}
+
+// ResolveProfile 依名稱取得轉檔設定並依本機能力選擇實際使用的編碼器
+func ResolveProfile(name string) (Profile, error) {
+	p, err := GetProfile(name)
+	if err != nil {
+		return p, err
+	}
+
+	c, err := ProbeCapabilities()
+	if err != nil {
+		return p, err
+	}
+	return c.Resolve(p)
+}
+
+// CheckProfile 在下載前確認轉檔設定可以執行，並顯示實際使用的編碼器
+// profileName 為空字串時不轉檔，不做任何檢查
+func CheckProfile(profileName string) error {
+	if profileName == "" {
+		return nil
+	}
+
+	requested, err := GetProfile(profileName)
+	if err != nil {
+		return err
+	}
+	p, err := ResolveProfile(profileName)
+	if err != nil {
+		return err
+	}
+
+	c, _ := ProbeCapabilities()
+	fmt.Println(c.Report(requested.VideoCodec))
+	fmt.Printf("轉檔設定 %s 使用編碼器: %s\n", p.Name, p.VideoCodec)
+	return nil
+}
+
+// CheckFFmpeg 確認本機已安裝 FFmpeg，合成影片一定需要
+func CheckFFmpeg() error {
+	_, err := ProbeCapabilities()
+	return err
+}
@@ -0,0 +1,267 @@
+package encoder
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const sampleEncoders = `Encoders:
+ V..... = Video
+ A..... = Audio
+ ------
+ V....D libx264              libx264 H.264 / AVC / MPEG-4 AVC / MPEG-4 part 10 (codec h264)
+ V....D h264_nvenc           NVIDIA NVENC H.264 encoder (codec h264)
+ V....D h264_vaapi           H.264/AVC (VAAPI) (codec h264)
+ A....D aac                  AAC (Advanced Audio Coding)
+`
+
+const sampleFilters = `Filters:
+  T.. = Timeline support
+  .S. = Slice threading
+  A = Audio input/output
+  | = Source or sink filter
+ ... abench            A->A       Benchmark part of a filter graph.
+ TS. libvmaf           VV->V      Calculate the VMAF between two video streams.
+ ..C loudnorm          A->A       EBU R128 loudness normalization
+`
+
+const sampleHWAccels = `Hardware acceleration methods:
+vdpau
+vaapi
+
+`
+
+func TestParseEncoders(t *testing.T) {
+	got := parseEncoders(sampleEncoders)
+	for _, name := range []string{"libx264", "h264_nvenc", "h264_vaapi", "aac"} {
+		if !got[name] {
+			t.Errorf("expected encoder %s", name)
+		}
+	}
+	if got["="] || got["Video"] {
+		t.Errorf("legend lines should be ignored: %v", got)
+	}
+}
+
+func TestParseHWAccels(t *testing.T) {
+	got := parseHWAccels(sampleHWAccels)
+	want := map[string]bool{"vdpau": true, "vaapi": true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseHWAccels() = %v, want %v", got, want)
+	}
+}
+
+func TestParseFilters(t *testing.T) {
+	got := parseFilters(sampleFilters)
+	want := map[string]bool{"abench": true, "libvmaf": true, "loudnorm": true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseFilters() = %v, want %v", got, want)
+	}
+}
+
+func TestCapabilitiesResolve_TestEncodeFails(t *testing.T) {
+	// 靜態編譯的 FFmpeg 列出 nvenc 與 CUDA，但主機沒有 NVIDIA GPU
+	calls := map[string]int{}
+	c := &Capabilities{
+		Encoders: map[string]bool{"h264_nvenc": true, "libx264": true},
+		HWAccels: map[string]bool{"cuda": true},
+		FFprobe:  true,
+		testEncode: func(codec string) error {
+			calls[codec]++
+			if codec == "h264_nvenc" {
+				return errors.New("No NVENC capable devices found")
+			}
+			return nil
+		},
+	}
+
+	gpu, _ := GetProfile(ProfileGPU)
+	for i := 0; i < 2; i++ {
+		p, err := c.Resolve(gpu)
+		if err != nil {
+			t.Fatalf("Resolve failed: %v", err)
+		}
+		if p.VideoCodec != "libx264" {
+			t.Errorf("expected libx264 after nvenc test encode failed, got %s", p.VideoCodec)
+		}
+	}
+	if calls["h264_nvenc"] != 1 || calls["libx264"] != 1 {
+		t.Errorf("expected each encoder to be tested once, got %v", calls)
+	}
+}
+
+func TestCapabilitiesResolve_NoFFprobe(t *testing.T) {
+	c := &Capabilities{Encoders: map[string]bool{"libx264": true}, HWAccels: map[string]bool{}}
+
+	// 一般轉檔不需要 ffprobe，目標大小與品質模式需要影片長度
+	cpu, _ := GetProfile(ProfileCPU)
+	if _, err := c.Resolve(cpu); err != nil {
+		t.Errorf("plain profile should not need ffprobe, got %v", err)
+	}
+	for _, p := range []Profile{
+		{Name: "size-test", VideoCodec: "libx264", TargetSize: "700M"},
+		{Name: "ssim-test", VideoCodec: "libx264", TargetSSIM: 0.98},
+	} {
+		if _, err := c.Resolve(p); err == nil || !strings.Contains(err.Error(), "ffprobe") {
+			t.Errorf("%s: expected ffprobe error, got %v", p.Name, err)
+		}
+	}
+}
+
+func TestCapabilitiesResolve_TranslatesPreset(t *testing.T) {
+	c := &Capabilities{Encoders: map[string]bool{"libx264": true}, HWAccels: map[string]bool{}, FFprobe: true}
+
+	for preset, want := range map[string]string{"p4": "medium", "p7": "veryslow", "slow": "slow", "ll": ""} {
+		p, err := c.Resolve(Profile{Name: "nvenc-test", VideoCodec: "h264_nvenc", Preset: preset})
+		if err != nil {
+			t.Fatalf("Resolve failed: %v", err)
+		}
+		if p.VideoCodec != "libx264" || p.Preset != want {
+			t.Errorf("preset %s: expected libx264 with %q, got %s with %q", preset, want, p.VideoCodec, p.Preset)
+		}
+	}
+
+	// VAAPI 沒有 preset
+	c = &Capabilities{Encoders: parseEncoders(sampleEncoders), HWAccels: parseHWAccels(sampleHWAccels), FFprobe: true}
+	p, _ := c.Resolve(Profile{Name: "nvenc-test", VideoCodec: "h264_nvenc", Preset: "p4"})
+	if p.VideoCodec != "h264_vaapi" || p.Preset != "" {
+		t.Errorf("expected h264_vaapi without preset, got %s with %q", p.VideoCodec, p.Preset)
+	}
+}
+
+func TestCapabilitiesResolve_FallsBackToVAAPI(t *testing.T) {
+	// 有 nvenc 編碼器但沒有 CUDA，應改用 VAAPI
+	c := &Capabilities{Encoders: parseEncoders(sampleEncoders), HWAccels: parseHWAccels(sampleHWAccels), FFprobe: true}
+
+	gpu, _ := GetProfile(ProfileGPU)
+	p, err := c.Resolve(gpu)
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if p.VideoCodec != "h264_vaapi" {
+		t.Errorf("expected h264_vaapi, got %s", p.VideoCodec)
+	}
+	if !reflect.DeepEqual(p.InputArgs, []string{"-vaapi_device", VAAPIDevice}) {
+		t.Errorf("unexpected InputArgs: %v", p.InputArgs)
+	}
+	if !strings.Contains(strings.Join(p.Args(), " "), "format=nv12,hwupload") {
+		t.Errorf("VAAPI args should upload frames: %v", p.Args())
+	}
+}
+
+func TestCapabilitiesResolve_FallsBackToCPU(t *testing.T) {
+	c := &Capabilities{Encoders: map[string]bool{"libx264": true}, HWAccels: map[string]bool{}, FFprobe: true}
+
+	gpu, _ := GetProfile(ProfileGPU)
+	p, err := c.Resolve(gpu)
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if p.VideoCodec != "libx264" {
+		t.Errorf("expected libx264, got %s", p.VideoCodec)
+	}
+}
+
+func TestCapabilitiesResolve_PrefersNVENC(t *testing.T) {
+	c := &Capabilities{
+		Encoders: map[string]bool{"h264_nvenc": true, "libx264": true},
+		HWAccels: map[string]bool{"cuda": true},
+		FFprobe:  true,
+	}
+
+	gpu, _ := GetProfile(ProfileGPU)
+	p, err := c.Resolve(gpu)
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if !reflect.DeepEqual(p, gpu) {
+		t.Errorf("profile should be unchanged, got %+v", p)
+	}
+}
+
+func TestCapabilitiesResolve_NoEncoder(t *testing.T) {
+	c := &Capabilities{Encoders: map[string]bool{}, HWAccels: map[string]bool{}, FFprobe: true}
+
+	cpu, _ := GetProfile(ProfileCPU)
+	if _, err := c.Resolve(cpu); err == nil {
+		t.Error("expected error when libx264 is unavailable")
+	}
+
+	// 重新封裝不需要編碼器
+	fast, _ := GetProfile(ProfileFast)
+	if _, err := c.Resolve(fast); err != nil {
+		t.Errorf("copy profile should always resolve, got: %v", err)
+	}
+}
+
+func TestCapabilitiesReport(t *testing.T) {
+	tested := map[string]int{}
+	c := &Capabilities{
+		Encoders: map[string]bool{"h264_nvenc": true, "libx264": true, "libx265": true},
+		HWAccels: map[string]bool{"cuda": true},
+		FFprobe:  true,
+		testEncode: func(codec string) error {
+			tested[codec]++
+			if codec == "h264_nvenc" {
+				return errors.New("no device")
+			}
+			return nil
+		},
+	}
+
+	report := c.Report("h264_nvenc")
+	if !strings.Contains(report, "編碼器: h264_nvenc (不可用), h264_vaapi (不可用), h264_qsv (不可用), libx264;") ||
+		!strings.Contains(report, "硬體加速: cuda") || !strings.Contains(report, "libvmaf: 無") {
+		t.Errorf("unexpected report: %s", report)
+	}
+
+	// 只試編碼候選清單中的編碼器，每個編碼器只試一次
+	c.Report("h264_nvenc")
+	if len(tested) != 2 || tested["h264_nvenc"] != 1 || tested["libx264"] != 1 {
+		t.Errorf("expected only the candidate chain to be tested once, got %v", tested)
+	}
+
+	// 重新封裝不試編碼
+	if report := c.Report("copy"); !strings.HasPrefix(report, "編碼器: copy;") {
+		t.Errorf("unexpected report for copy: %s", report)
+	}
+	if len(tested) != 2 {
+		t.Errorf("copy should not run a test encode, got %v", tested)
+	}
+}
+
+func TestCheckProfile_Empty(t *testing.T) {
+	if err := CheckProfile(""); err != nil {
+		t.Errorf("empty profile should not be checked, got: %v", err)
+	}
+}
+
+func TestCapabilitiesResolve_VMAFWithoutLibvmaf(t *testing.T) {
+	c := &Capabilities{Encoders: map[string]bool{"libx264": true}, HWAccels: map[string]bool{}, FFprobe: true}
+	vmaf := Profile{Name: "vmaf-test", VideoCodec: "libx264", TargetVMAF: 93}
+	ssim := Profile{Name: "ssim-test", VideoCodec: "libx264", TargetSSIM: 0.98}
+
+	if _, err := c.Resolve(vmaf); err == nil || !strings.Contains(err.Error(), "libvmaf") {
+		t.Errorf("expected libvmaf error, got %v", err)
+	}
+	if _, err := c.Resolve(ssim); err != nil {
+		t.Errorf("SSIM target should not need libvmaf, got %v", err)
+	}
+
+	c.Filters = map[string]bool{"libvmaf": true}
+	if _, err := c.Resolve(vmaf); err != nil {
+		t.Errorf("expected VMAF profile to resolve with libvmaf, got %v", err)
+	}
+}
+
+func TestCheckProfileRequirements(t *testing.T) {
+	// 不需要額外濾鏡的設定不偵測 FFmpeg
+	if err := CheckProfileRequirements(ProfileCPU); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := CheckProfileRequirements("no-such-profile"); err == nil {
+		t.Error("expected error for unknown profile")
+	}
+}
@@ -1,10 +1,13 @@
 package encoder
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+
+	"github.com/jable-downloader-go/internal/ffmpeg"
+	"github.com/jable-downloader-go/internal/merger"
 )
 
 type EncodeMode int
@@ -17,65 +20,112 @@ const (
 )
 
 func FFmpegEncode(folderPath, fileName string, mode EncodeMode) error {
+	return FFmpegEncodeContainer(folderPath, fileName, mode, merger.ContainerMP4)
+}
+
+// FFmpegEncodeContainer 轉檔 folderPath/fileName 加上封裝格式副檔名的影片，並寫回原路徑
+func FFmpegEncodeContainer(folderPath, fileName string, mode EncodeMode, container merger.Container) error {
 	if mode == NoEncode {
 		return nil
 	}
 	
-	originalPath := filepath.Join(folderPath, fileName+".mp4")
-	tempPath := filepath.Join(folderPath, "f_"+fileName+".mp4")
-	
-	var cmd *exec.Cmd
-	
-	switch mode {
-	case FastEncode:
-		// 快速無損轉檔
-		cmd = exec.Command("ffmpeg",
-			"-i", originalPath,
-			"-c", "copy",
-			"-bsf:a", "aac_adtstoasc",
-			"-movflags", "+faststart",
-			tempPath,
-		)
-	case GPUEncode:
-		// NVIDIA GPU 轉檔
-		cmd = exec.Command("ffmpeg",
-			"-i", originalPath,
-			"-c:v", "h264_nvenc",
-			"-b:v", "10000K",
-			"-threads", "5",
-			tempPath,
-		)
-	case CPUEncode:
-		// CPU 轉檔
-		cmd = exec.Command("ffmpeg",
-			"-i", originalPath,
-			"-c:v", "libx264",
-			"-b:v", "3M",
-			"-threads", "5",
-			"-preset", "superfast",
-			tempPath,
-		)
-	default:
+	name := mode.ProfileName()
+	if name == "" {
 		return fmt.Errorf("不支援的轉檔模式")
 	}
+	return EncodeProfile(folderPath, fileName, name, container, nil)
+}
+
+// EncodeProfile 依轉檔設定名稱轉檔，profileName 為空字串時不轉檔
+// progress 不為 nil 時回報 FFmpeg 進度，總長度以 ffprobe 取得
+func EncodeProfile(folderPath, fileName, profileName string, container merger.Container, progress ffmpeg.ProgressFunc) error {
+	return EncodeProfileContext(context.Background(), folderPath, fileName, profileName, container, progress)
+}
+
+// EncodeProfileContext 與 EncodeProfile 相同，ctx 取消時終止 FFmpeg 並保留原始檔案
+func EncodeProfileContext(ctx context.Context, folderPath, fileName, profileName string, container merger.Container, progress ffmpeg.ProgressFunc) error {
+	return EncodeContext(ctx, folderPath, fileName, profileName, container, LoudnessOptions{}, progress)
+}
+
+// EncodeContext 依轉檔設定轉檔，啟用響度正規化時在同一次 FFmpeg 處理中加上 loudnorm 濾鏡
+// 未指定轉檔設定時以 fast 設定處理（影像直接複製，只重新編碼聲音），兩者都未啟用時不做任何事
+func EncodeContext(ctx context.Context, folderPath, fileName, profileName string, container merger.Container, loudness LoudnessOptions, progress ffmpeg.ProgressFunc) error {
+	if profileName == "" {
+		if !loudness.Enabled {
+			return nil
+		}
+		profileName = ProfileFast
+	}
 	
-	fmt.Printf("開始轉檔 (模式: %d)...\n", mode)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	// 依本機能力選擇編碼器，例如沒有 NVIDIA GPU 時改用 VAAPI、QSV 或 CPU
+	profile, err := ResolveProfile(profileName)
+	if err != nil {
+		return err
+	}
 	
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("轉檔失敗: %v", err)
+	originalPath := filepath.Join(folderPath, fileName+container.Ext())
+	tempPath := filepath.Join(folderPath, "f_"+fileName+container.Ext())
+	
+	var report *LoudnessReport
+	if loudness.Enabled {
+		if profile, report, err = applyLoudness(ctx, profile, originalPath, loudness); err != nil {
+			return err
+		}
 	}
 	
-	// 刪除原始檔案並重命名
-	if err := os.Remove(originalPath); err != nil {
-		return fmt.Errorf("無法刪除原始檔案: %v", err)
+	fmt.Printf("開始轉檔 (設定: %s, 編碼器: %s)...\n", profile.Name, profile.VideoCodec)
+	if err := encodeFile(ctx, profile, originalPath, tempPath, folderPath, container.OutputArgs(), progress); err != nil {
+		os.Remove(tempPath)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("轉檔失敗: %v", err)
 	}
 	
-	if err := os.Rename(tempPath, originalPath); err != nil {
-		return fmt.Errorf("無法重命名檔案: %v", err)
+	// 驗證轉檔結果後取代原始檔案，失敗時保留原始檔案
+	if err := replaceFile(tempPath, originalPath); err != nil {
+		return err
+	}
+	if report != nil {
+		if err := saveLoudnessReport(originalPath, report); err != nil {
+			return err
+		}
 	}
 	
 	fmt.Println("轉檔成功!")
 	return nil
 }
+
+// encodeFile 依轉檔設定將 inputPath 編碼到 outputPath，workDir 存放兩階段記錄與取樣片段
+func encodeFile(ctx context.Context, profile Profile, inputPath, outputPath, workDir string, outputArgs []string, progress ffmpeg.ProgressFunc) error {
+	if profile.IsTargetSize() {
+		return encodeTargetSize(ctx, profile, inputPath, outputPath, outputArgs, progress)
+	}
+	
+	if profile.IsTargetQuality() {
+		crf, err := chooseCRF(ctx, profile, inputPath, workDir)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("選擇 CRF %d\n", crf)
+		profile.CRF = crf
+	}
+	
+	var duration float64
+	if progress != nil {
+		// 取得不到長度時仍會回報已處理秒數與速度
+		duration, _ = ffmpeg.ProbeDuration(inputPath)
+	}
+	return ffmpeg.RunContext(ctx, encodeArgs(profile, inputPath, outputPath, outputArgs), duration, progress)
+}
+
+// encodeArgs 回傳單次編碼的 FFmpeg 參數
+// 加上 -y 覆寫上次中斷留下的暫存檔，否則 FFmpeg 會詢問是否覆寫並因讀不到回答而失敗
+func encodeArgs(profile Profile, inputPath, outputPath string, outputArgs []string) []string {
+	args := append(append([]string{"-y"}, profile.InputArgs...), "-i", inputPath)
+	args = append(args, profile.Args()...)
+	
+	// 依封裝格式加上輸出參數，例如 mp4 的 aac_adtstoasc 與 +faststart
+	args = append(args, outputArgs...)
+	return append(args, outputPath)
+}
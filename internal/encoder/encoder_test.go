@@ -4,6 +4,8 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/jable-downloader-go/internal/merger"
 )
 
 func TestFFmpegEncode_NoEncode(t *testing.T) {
@@ -161,3 +163,47 @@ func (m EncodeMode) String() string {
 		return "Unknown"
 	}
 }
+
+func TestFFmpegEncodeContainer_UsesContainerExt(t *testing.T) {
+	dir := t.TempDir()
+	fileName := "mkv-test"
+
+	srcPath := filepath.Join(dir, fileName+".mkv")
+	os.WriteFile(srcPath, []byte("dummy"), 0644)
+
+	err := FFmpegEncodeContainer(dir, fileName, FastEncode, merger.ContainerMKV)
+	if err != nil {
+		// FFmpeg 失敗時 .mkv 原始檔必須保留
+		if _, statErr := os.Stat(srcPath); statErr != nil {
+			t.Errorf("source .mkv should still exist after failed encode: %v", statErr)
+		}
+	}
+}
+
+func TestAttachToMKV_KeepsOriginalOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	videoPath := filepath.Join(dir, "abc-123.mkv")
+	os.WriteFile(videoPath, []byte("not a real mkv"), 0644)
+
+	err := AttachToMKV(videoPath, "", map[string]string{"title": "abc-123"})
+	if err == nil {
+		t.Log("FFmpeg succeeded unexpectedly")
+		return
+	}
+	if _, statErr := os.Stat(videoPath); statErr != nil {
+		t.Errorf("original video should be kept: %v", statErr)
+	}
+	if _, statErr := os.Stat(filepath.Join(dir, "f_abc-123.mkv")); statErr == nil {
+		t.Error("temporary output should be removed")
+	}
+}
+
+func TestEncodeArgs_Overwrite(t *testing.T) {
+	p := Profile{Name: "test", VideoCodec: "libx264", CRF: 23}
+	args := encodeArgs(p, "in.mp4", "f_in.mp4", []string{"-movflags", "+faststart"})
+
+	// 上次中斷留下的暫存檔必須直接覆寫
+	if args[0] != "-y" || args[len(args)-1] != "f_in.mp4" {
+		t.Errorf("expected -y first and output last, got %v", args)
+	}
+}
@@ -0,0 +1,138 @@
+package encoder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// loudnessSuffix 響度量測結果的檔名後綴，例如 abc-123.loudnorm.json
+const loudnessSuffix = ".loudnorm.json"
+
+// EBU R128 建議值
+const (
+	DefaultLoudnessTarget = -23.0 // 整合響度 (LUFS)
+	defaultTruePeak       = -1.0  // 真峰值 (dBTP)
+	defaultLoudnessRange  = 7.0   // 響度範圍 (LU)
+	loudnormAudioBitrate  = "192k"
+)
+
+// LoudnessOptions 響度正規化設定
+type LoudnessOptions struct {
+	Enabled  bool
+	Target   float64 // 整合響度目標 (LUFS)，預設 -23
+	TruePeak float64 // 真峰值上限 (dBTP)，預設 -1
+	Range    float64 // 響度範圍目標 (LU)，預設 7
+}
+
+func (o LoudnessOptions) withDefaults() LoudnessOptions {
+	if o.Target == 0 {
+		o.Target = DefaultLoudnessTarget
+	}
+	if o.TruePeak == 0 {
+		o.TruePeak = defaultTruePeak
+	}
+	if o.Range == 0 {
+		o.Range = defaultLoudnessRange
+	}
+	return o
+}
+
+// Loudness loudnorm 第一階段的量測結果（FFmpeg 以字串輸出數值）
+type Loudness struct {
+	InputI       string `json:"input_i"`
+	InputTP      string `json:"input_tp"`
+	InputLRA     string `json:"input_lra"`
+	InputThresh  string `json:"input_thresh"`
+	TargetOffset string `json:"target_offset"`
+}
+
+// LoudnessReport 保存在影片旁的量測結果
+type LoudnessReport struct {
+	Target   float64   `json:"target"`
+	TruePeak float64   `json:"true_peak"`
+	Range    float64   `json:"range"`
+	Measured *Loudness `json:"measured"`
+}
+
+// LoudnessPath 回傳影片的響度量測結果路徑
+func LoudnessPath(videoPath string) string {
+	return strings.TrimSuffix(videoPath, filepath.Ext(videoPath)) + loudnessSuffix
+}
+
+// applyLoudness 以 EBU R128 loudnorm 量測響度，回傳加上第二階段濾鏡的轉檔設定與量測結果
+// 第二階段以量測值做線性調整，併入轉檔的同一次 FFmpeg 處理；影像設定不變，fast 設定仍直接複製影像
+func applyLoudness(ctx context.Context, p Profile, videoPath string, opts LoudnessOptions) (Profile, *LoudnessReport, error) {
+	opts = opts.withDefaults()
+
+	fmt.Println("量測響度...")
+	measured, err := measureLoudness(ctx, videoPath, opts)
+	if err != nil {
+		return p, nil, err
+	}
+	fmt.Printf("輸入響度: %s LUFS, 真峰值: %s dBTP, 響度範圍: %s LU\n", measured.InputI, measured.InputTP, measured.InputLRA)
+
+	report := &LoudnessReport{Target: opts.Target, TruePeak: opts.TruePeak, Range: opts.Range, Measured: measured}
+	return p.withLoudnorm(loudnormFilter(opts, measured)), report, nil
+}
+
+// withLoudnorm 回傳加上 loudnorm 濾鏡的轉檔設定，原本複製聲音或使用預設編碼器時改為 AAC
+func (p Profile) withLoudnorm(filter string) Profile {
+	if p.AudioCodec == "" || p.AudioCodec == "copy" {
+		p.AudioCodec = "aac"
+		p.AudioBitrate = loudnormAudioBitrate
+	}
+	p.AudioFilter = filter
+	return p
+}
+
+// saveLoudnessReport 將量測結果保存在影片旁
+func saveLoudnessReport(videoPath string, report *LoudnessReport) error {
+	data, _ := json.MarshalIndent(report, "", "  ")
+	if err := os.WriteFile(LoudnessPath(videoPath), data, 0644); err != nil {
+		return fmt.Errorf("無法保存響度量測結果: %v", err)
+	}
+	return nil
+}
+
+// loudnormFilter 回傳 loudnorm 濾鏡參數，measured 為 nil 時為第一階段量測
+func loudnormFilter(opts LoudnessOptions, measured *Loudness) string {
+	filter := fmt.Sprintf("loudnorm=I=%g:TP=%g:LRA=%g", opts.Target, opts.TruePeak, opts.Range)
+	if measured == nil {
+		return filter + ":print_format=json"
+	}
+	return filter + fmt.Sprintf(":measured_I=%s:measured_TP=%s:measured_LRA=%s:measured_thresh=%s:offset=%s:linear=true",
+		measured.InputI, measured.InputTP, measured.InputLRA, measured.InputThresh, measured.TargetOffset)
+}
+
+func measureLoudness(ctx context.Context, videoPath string, opts LoudnessOptions) (*Loudness, error) {
+	out, err := exec.CommandContext(ctx, "ffmpeg", "-hide_banner", "-i", videoPath,
+		"-vn", "-af", loudnormFilter(opts, nil), "-f", "null", "-").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("響度量測失敗: %v", err)
+	}
+	return parseLoudness(string(out))
+}
+
+// parseLoudness 取出 loudnorm 在輸出最後印出的 JSON 區塊
+func parseLoudness(output string) (*Loudness, error) {
+	start := strings.LastIndex(output, "{")
+	end := strings.LastIndex(output, "}")
+	if start < 0 || end < start {
+		return nil, errors.New("找不到響度量測結果")
+	}
+
+	var l Loudness
+	if err := json.Unmarshal([]byte(output[start:end+1]), &l); err != nil {
+		return nil, fmt.Errorf("無法解析響度量測結果: %v", err)
+	}
+	if l.InputI == "" {
+		return nil, errors.New("找不到響度量測結果")
+	}
+	return &l, nil
+}
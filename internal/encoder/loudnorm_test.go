@@ -0,0 +1,85 @@
+package encoder
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const sampleLoudnormOutput = `Input #0, mov,mp4,m4a,3gp,3g2,mj2, from 'abc-123.mp4':
+[Parsed_loudnorm_0 @ 0x55d5c8a0] 
+{
+	"input_i" : "-16.52",
+	"input_tp" : "-0.31",
+	"input_lra" : "9.80",
+	"input_thresh" : "-27.03",
+	"output_i" : "-23.05",
+	"output_tp" : "-6.90",
+	"output_lra" : "8.20",
+	"output_thresh" : "-33.51",
+	"normalization_type" : "dynamic",
+	"target_offset" : "0.05"
+}
+`
+
+func TestParseLoudness(t *testing.T) {
+	l, err := parseLoudness(sampleLoudnormOutput)
+	if err != nil {
+		t.Fatalf("parseLoudness failed: %v", err)
+	}
+
+	want := Loudness{InputI: "-16.52", InputTP: "-0.31", InputLRA: "9.80", InputThresh: "-27.03", TargetOffset: "0.05"}
+	if *l != want {
+		t.Errorf("parseLoudness() = %+v, want %+v", *l, want)
+	}
+
+	if _, err := parseLoudness("no json here"); err == nil {
+		t.Error("expected error when loudnorm output is missing")
+	}
+}
+
+func TestLoudnormFilter(t *testing.T) {
+	opts := LoudnessOptions{Enabled: true}.withDefaults()
+
+	if got := loudnormFilter(opts, nil); got != "loudnorm=I=-23:TP=-1:LRA=7:print_format=json" {
+		t.Errorf("unexpected first pass filter: %s", got)
+	}
+
+	l, _ := parseLoudness(sampleLoudnormOutput)
+	want := "loudnorm=I=-23:TP=-1:LRA=7:measured_I=-16.52:measured_TP=-0.31:measured_LRA=9.80:measured_thresh=-27.03:offset=0.05:linear=true"
+	if got := loudnormFilter(opts, l); got != want {
+		t.Errorf("second pass filter = %s, want %s", got, want)
+	}
+}
+
+func TestLoudnessPath(t *testing.T) {
+	got := LoudnessPath(filepath.Join("download", "abc-123", "abc-123.mkv"))
+	if got != filepath.Join("download", "abc-123", "abc-123.loudnorm.json") {
+		t.Errorf("unexpected loudness path: %s", got)
+	}
+}
+
+func TestEncodeContext_LoudnessDisabled(t *testing.T) {
+	if err := EncodeContext(context.Background(), "/nonexistent", "video", "", "mp4", LoudnessOptions{}, nil); err != nil {
+		t.Errorf("no profile and disabled normalization should do nothing, got: %v", err)
+	}
+}
+
+func TestWithLoudnorm(t *testing.T) {
+	const filter = "loudnorm=I=-23:TP=-1:LRA=7:measured_I=-16.52"
+
+	// 重新封裝時影像仍直接複製，只重新編碼聲音
+	fast, _ := GetProfile(ProfileFast)
+	want := []string{"-c:v", "copy", "-c:a", "aac", "-b:a", "192k", "-af", filter, "-ar", "48000"}
+	if got := fast.withLoudnorm(filter).Args(); !reflect.DeepEqual(got, want) {
+		t.Errorf("fast profile args = %v, want %v", got, want)
+	}
+
+	// 已重新編碼聲音的設定保留原本的編碼器與位元率
+	custom := Profile{Name: "custom", VideoCodec: "libx264", CRF: 23, AudioCodec: "libopus", AudioBitrate: "96k"}
+	want = []string{"-c:v", "libx264", "-crf", "23", "-c:a", "libopus", "-b:a", "96k", "-af", filter, "-ar", "48000"}
+	if got := custom.withLoudnorm(filter).Args(); !reflect.DeepEqual(got, want) {
+		t.Errorf("custom profile args = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,104 @@
+package encoder
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+
+	"github.com/jable-downloader-go/internal/merger"
+)
+
+// EmbedMetadata 以重新封裝（不重新編碼）將封面與標籤寫入影片
+// MP4 以 attached picture 保存封面，MKV 以附件保存；fMP4 只寫入標籤，MPEG-TS 不支援
+func EmbedMetadata(videoPath, coverPath string, container merger.Container, metadata map[string]string) error {
+	switch container {
+	case merger.ContainerMKV:
+		return AttachToMKV(videoPath, coverPath, metadata)
+	case merger.ContainerTS:
+		fmt.Println("MPEG-TS 不支援封面與標籤, 跳過...")
+		return nil
+	}
+
+	args := []string{"-i", videoPath}
+	if coverPath != "" && container == merger.ContainerMP4 {
+		args = append(args, "-i", coverPath, "-map", "0", "-map", "1", "-c", "copy", "-disposition:v:1", "attached_pic")
+	} else {
+		args = append(args, "-map", "0", "-c", "copy")
+	}
+	args = append(args, metadataArgs(metadata)...)
+
+	// 原始檔已是正確的封裝格式，只需保留 moov 位置或 fragment 設定
+	if container == merger.ContainerFMP4 {
+		args = append(args, "-movflags", "+frag_keyframe+empty_moov+default_base_moof")
+	} else {
+		args = append(args, "-movflags", "+faststart")
+	}
+
+	if err := remux(videoPath, append(args, "-f", "mp4")); err != nil {
+		return fmt.Errorf("寫入封面與標籤失敗: %v", err)
+	}
+
+	fmt.Println("封面與中繼資料已寫入 MP4")
+	return nil
+}
+
+// AttachToMKV 將封面以附件、番號與來源網址以標籤寫入 MKV
+func AttachToMKV(videoPath, coverPath string, metadata map[string]string) error {
+	args := []string{"-i", videoPath, "-map", "0", "-c", "copy"}
+
+	if coverPath != "" {
+		args = append(args,
+			"-attach", coverPath,
+			"-metadata:s:t", "mimetype=image/jpeg",
+			"-metadata:s:t", "filename=cover.jpg",
+		)
+	}
+	args = append(args, metadataArgs(metadata)...)
+
+	if err := remux(videoPath, append(args, "-f", "matroska")); err != nil {
+		return fmt.Errorf("寫入 MKV 附件失敗: %v", err)
+	}
+
+	fmt.Println("封面與中繼資料已寫入 MKV")
+	return nil
+}
+
+// metadataArgs 依鍵排序產生 -metadata 參數，確保每次輸出一致
+func metadataArgs(metadata map[string]string) []string {
+	keys := make([]string, 0, len(metadata))
+	for k := range metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var args []string
+	for _, k := range keys {
+		args = append(args, "-metadata", fmt.Sprintf("%s=%s", k, metadata[k]))
+	}
+	return args
+}
+
+// remux 將 FFmpeg 輸出寫到暫存檔，驗證成功後取代 videoPath，失敗時保留原始檔案
+func remux(videoPath string, args []string) error {
+	return remuxContext(context.Background(), videoPath, args)
+}
+
+// remuxContext 與 remux 相同，ctx 取消時終止 FFmpeg
+// 以 -y 覆寫上次中斷留下的暫存檔
+func remuxContext(ctx context.Context, videoPath string, args []string) error {
+	tempPath := filepath.Join(filepath.Dir(videoPath), "f_"+filepath.Base(videoPath))
+
+	args = append(append([]string{"-y"}, args...), tempPath)
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	return replaceFile(tempPath, videoPath)
+}
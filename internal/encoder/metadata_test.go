@@ -0,0 +1,14 @@
+package encoder
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMetadataArgs_Sorted(t *testing.T) {
+	got := metadataArgs(map[string]string{"title": "T", "artist": "A", "comment": "u"})
+	want := []string{"-metadata", "artist=A", "-metadata", "comment=u", "-metadata", "title=T"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("metadataArgs() = %v, want %v", got, want)
+	}
+}
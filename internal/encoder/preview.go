@@ -0,0 +1,223 @@
+package encoder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jable-downloader-go/internal/ffmpeg"
+)
+
+// 預覽格式
+const (
+	PreviewNone = ""
+	PreviewWebP = "webp" // 動態 WebP，可直接在瀏覽器或檔案總管預覽
+	PreviewMP4  = "mp4"  // 無聲 H.264 短片
+)
+
+// 縮圖與預覽檔的檔名後綴，例如 abc-123-sheet.jpg、abc-123-preview.webp
+const (
+	sheetSuffix   = "-sheet.jpg"
+	previewSuffix = "-preview"
+)
+
+// PreviewOptions 合成後產生縮圖總覽與預覽短片的設定
+type PreviewOptions struct {
+	Sheet   bool   // 產生 <番號>-sheet.jpg 縮圖總覽
+	Columns int    // 縮圖欄數，預設 4
+	Rows    int    // 縮圖列數，預設 4
+	Width   int    // 每張縮圖寬度，預設 320
+	Preview string // 預覽短片格式: webp、mp4，空字串表示不產生
+
+	Clips       int     // 預覽短片由幾段組成，預設 5
+	ClipSeconds float64 // 每段秒數，預設 2
+}
+
+// Enabled 是否需要產生任何預覽檔
+func (o PreviewOptions) Enabled() bool {
+	return o.Sheet || o.Preview != PreviewNone
+}
+
+// ParsePreviewFormat 解析預覽格式名稱
+func ParsePreviewFormat(name string) (string, error) {
+	switch name = strings.ToLower(strings.TrimSpace(name)); name {
+	case PreviewNone, PreviewWebP, PreviewMP4:
+		return name, nil
+	}
+	return "", fmt.Errorf("不支援的預覽格式: %s (可用: webp, mp4)", name)
+}
+
+// ParseGrid 解析縮圖排列，例如 "4x4"
+func ParseGrid(s string) (columns, rows int, err error) {
+	c, r, ok := strings.Cut(strings.ToLower(s), "x")
+	if ok {
+		columns, err = strconv.Atoi(c)
+		if err == nil {
+			rows, err = strconv.Atoi(r)
+		}
+	}
+	if !ok || err != nil || columns <= 0 || rows <= 0 {
+		return 0, 0, fmt.Errorf("無效的縮圖排列: %s (例如 4x4)", s)
+	}
+	return columns, rows, nil
+}
+
+func (o PreviewOptions) withDefaults() PreviewOptions {
+	if o.Columns == 0 {
+		o.Columns = 4
+	}
+	if o.Rows == 0 {
+		o.Rows = 4
+	}
+	if o.Width == 0 {
+		o.Width = 320
+	}
+	if o.Clips == 0 {
+		o.Clips = 5
+	}
+	if o.ClipSeconds == 0 {
+		o.ClipSeconds = 2
+	}
+	return o
+}
+
+// SheetPath 回傳影片的縮圖總覽路徑，例如 download/abc-123/abc-123-sheet.jpg
+func SheetPath(videoPath string) string {
+	return strings.TrimSuffix(videoPath, filepath.Ext(videoPath)) + sheetSuffix
+}
+
+// PreviewPath 回傳影片的預覽短片路徑，例如 download/abc-123/abc-123-preview.webp
+func PreviewPath(videoPath, format string) string {
+	return strings.TrimSuffix(videoPath, filepath.Ext(videoPath)) + previewSuffix + "." + format
+}
+
+// generatedSuffixes 後處理產生、清理暫存檔時必須保留的檔案後綴
+var generatedSuffixes = []string{
+	sheetSuffix,
+	previewSuffix + "." + PreviewWebP,
+	previewSuffix + "." + PreviewMP4,
+	loudnessSuffix,
+}
+
+// IsGeneratedFile 檔名是否為後處理產生的檔案（縮圖總覽、預覽短片、響度量測結果）
+func IsGeneratedFile(name string) bool {
+	for _, suffix := range generatedSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// GeneratedFiles 回傳資料夾內後處理產生的檔案名稱
+func GeneratedFiles(folderPath string) []string {
+	entries, err := os.ReadDir(folderPath)
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && IsGeneratedFile(e.Name()) {
+			names = append(names, e.Name())
+		}
+	}
+	return names
+}
+
+// GeneratePreviews 為影片產生縮圖總覽與預覽短片，回傳產生的檔案路徑
+func GeneratePreviews(videoPath string, opts PreviewOptions) ([]string, error) {
+	if !opts.Enabled() {
+		return nil, nil
+	}
+	opts = opts.withDefaults()
+
+	duration, err := ffmpeg.ProbeDuration(videoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var generated []string
+	if opts.Sheet {
+		if err := generateSheet(videoPath, duration, opts); err != nil {
+			return generated, fmt.Errorf("產生縮圖總覽失敗: %v", err)
+		}
+		generated = append(generated, SheetPath(videoPath))
+		fmt.Printf("縮圖總覽已產生: %s\n", filepath.Base(SheetPath(videoPath)))
+	}
+
+	if opts.Preview != PreviewNone {
+		outputPath := PreviewPath(videoPath, opts.Preview)
+		if err := runQuiet(previewArgs(videoPath, outputPath, duration, opts)...); err != nil {
+			os.Remove(outputPath)
+			return generated, fmt.Errorf("產生預覽短片失敗: %v", err)
+		}
+		generated = append(generated, outputPath)
+		fmt.Printf("預覽短片已產生: %s\n", filepath.Base(outputPath))
+	}
+	return generated, nil
+}
+
+// evenTimestamps 回傳把影片平分為 n 段後每段中點的秒數
+func evenTimestamps(duration float64, n int) []float64 {
+	times := make([]float64, n)
+	for i := range times {
+		times[i] = duration * (float64(i) + 0.5) / float64(n)
+	}
+	return times
+}
+
+// generateSheet 在平均間隔處快速定位擷取畫面，再拼成一張縮圖總覽
+// 逐張定位只需解碼少量畫面，比解碼整部影片快得多
+func generateSheet(videoPath string, duration float64, opts PreviewOptions) error {
+	dir := filepath.Dir(videoPath)
+	framePattern := filepath.Join(dir, "sheet_frame_%03d.jpg")
+
+	count := opts.Columns * opts.Rows
+	defer func() {
+		for i := 1; i <= count; i++ {
+			os.Remove(fmt.Sprintf(framePattern, i))
+		}
+	}()
+
+	for i, t := range evenTimestamps(duration, count) {
+		if err := runQuiet(sheetFrameArgs(videoPath, fmt.Sprintf(framePattern, i+1), t, opts.Width)...); err != nil {
+			return err
+		}
+	}
+
+	return runQuiet("-y", "-i", framePattern,
+		"-vf", fmt.Sprintf("tile=%dx%d", opts.Columns, opts.Rows),
+		"-frames:v", "1", "-q:v", "3", SheetPath(videoPath))
+}
+
+// sheetFrameArgs 擷取 t 秒處的一個畫面
+// 明確指定第一個影像串流，寫入封面後 FFmpeg 預設可能選到封面圖片（attached_pic）
+func sheetFrameArgs(videoPath, framePath string, t float64, width int) []string {
+	return []string{"-y", "-ss", formatSeconds(t), "-i", videoPath, "-map", "0:v:0",
+		"-frames:v", "1", "-vf", fmt.Sprintf("scale=%d:-2", width), "-q:v", "3", framePath}
+}
+
+// previewArgs 從平均間隔處各擷取一小段，串接成無聲的預覽短片
+func previewArgs(videoPath, outputPath string, duration float64, opts PreviewOptions) []string {
+	args := []string{"-y"}
+	var filter strings.Builder
+	for i, t := range evenTimestamps(duration, opts.Clips) {
+		args = append(args, "-ss", formatSeconds(t), "-t", formatSeconds(opts.ClipSeconds), "-i", videoPath)
+		fmt.Fprintf(&filter, "[%d:v:0]scale=%d:-2,setsar=1,fps=12[v%d];", i, opts.Width, i)
+	}
+	for i := 0; i < opts.Clips; i++ {
+		fmt.Fprintf(&filter, "[v%d]", i)
+	}
+	fmt.Fprintf(&filter, "concat=n=%d:v=1:a=0[out]", opts.Clips)
+
+	args = append(args, "-filter_complex", filter.String(), "-map", "[out]", "-an")
+	if opts.Preview == PreviewWebP {
+		args = append(args, "-c:v", "libwebp", "-loop", "0", "-q:v", "60")
+	} else {
+		args = append(args, "-c:v", "libx264", "-crf", "28", "-preset", "veryfast", "-pix_fmt", "yuv420p", "-movflags", "+faststart")
+	}
+	return append(args, outputPath)
+}
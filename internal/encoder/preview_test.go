@@ -0,0 +1,99 @@
+package encoder
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseGrid(t *testing.T) {
+	c, r, err := ParseGrid("5x3")
+	if err != nil || c != 5 || r != 3 {
+		t.Errorf("ParseGrid(5x3) = %d, %d, %v", c, r, err)
+	}
+
+	for _, s := range []string{"", "4", "0x4", "ax4", "4x-1"} {
+		if _, _, err := ParseGrid(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
+
+func TestParsePreviewFormat(t *testing.T) {
+	for _, name := range []string{"", "webp", "MP4"} {
+		if _, err := ParsePreviewFormat(name); err != nil {
+			t.Errorf("unexpected error for %q: %v", name, err)
+		}
+	}
+	if _, err := ParsePreviewFormat("gif"); err == nil {
+		t.Error("expected error for unsupported preview format")
+	}
+}
+
+func TestPreviewPaths(t *testing.T) {
+	video := filepath.Join("download", "abc-123", "abc-123-part2.mkv")
+
+	if got := SheetPath(video); got != filepath.Join("download", "abc-123", "abc-123-part2-sheet.jpg") {
+		t.Errorf("unexpected sheet path: %s", got)
+	}
+	if got := PreviewPath(video, PreviewWebP); got != filepath.Join("download", "abc-123", "abc-123-part2-preview.webp") {
+		t.Errorf("unexpected preview path: %s", got)
+	}
+}
+
+func TestGeneratedFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"abc-123.mp4", "abc-123.jpg", "abc-123-sheet.jpg", "abc-123-preview.webp", "abc-123-part1-preview.mp4", "abc-123.loudnorm.json", "seg1.mp4"} {
+		os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644)
+	}
+
+	got := GeneratedFiles(dir)
+	want := []string{"abc-123-part1-preview.mp4", "abc-123-preview.webp", "abc-123-sheet.jpg", "abc-123.loudnorm.json"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GeneratedFiles() = %v, want %v", got, want)
+	}
+}
+
+func TestEvenTimestamps(t *testing.T) {
+	got := evenTimestamps(100, 4)
+	want := []float64{12.5, 37.5, 62.5, 87.5}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("evenTimestamps() = %v, want %v", got, want)
+	}
+}
+
+func TestPreviewArgs(t *testing.T) {
+	opts := PreviewOptions{Preview: PreviewWebP}.withDefaults()
+	args := strings.Join(previewArgs("in.mp4", "out.webp", 100, opts), " ")
+
+	if strings.Count(args, "-i in.mp4") != 5 {
+		t.Errorf("expected 5 clip inputs: %s", args)
+	}
+	if !strings.Contains(args, "concat=n=5:v=1:a=0[out]") || !strings.Contains(args, "libwebp") {
+		t.Errorf("unexpected preview args: %s", args)
+	}
+	if !strings.Contains(args, "[0:v:0]scale=") {
+		t.Errorf("expected first video stream of each clip: %s", args)
+	}
+}
+
+func TestSheetFrameArgs(t *testing.T) {
+	args := strings.Join(sheetFrameArgs("in.mp4", "frame_001.jpg", 12.5, 320), " ")
+
+	// 不可選到封面圖片
+	if !strings.Contains(args, "-i in.mp4 -map 0:v:0 -frames:v 1") {
+		t.Errorf("expected first video stream to be mapped: %s", args)
+	}
+	if !strings.HasSuffix(args, "scale=320:-2 -q:v 3 frame_001.jpg") {
+		t.Errorf("unexpected frame args: %s", args)
+	}
+}
+
+func TestGeneratePreviews_Disabled(t *testing.T) {
+	generated, err := GeneratePreviews("/nonexistent/video.mp4", PreviewOptions{})
+	if err != nil || generated != nil {
+		t.Errorf("disabled previews should do nothing, got %v, %v", generated, err)
+	}
+}
@@ -0,0 +1,220 @@
+package encoder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 內建轉檔設定名稱，對應原本的三種轉檔模式
+const (
+	ProfileFast = "fast" // 無損重新封裝
+	ProfileGPU  = "gpu"  // NVIDIA GPU 轉檔
+	ProfileCPU  = "cpu"  // CPU 轉檔
+)
+
+// Profile 轉檔設定，可在設定檔中自訂
+type Profile struct {
+	Name       string   `json:"name"`
+	VideoCodec string   `json:"video_codec"`           // 例如 libx264、h264_nvenc，copy 表示不重新編碼
+	CRF        int      `json:"crf,omitempty"`         // 固定品質，0 表示不指定
+	Bitrate    string   `json:"bitrate,omitempty"`     // 例如 3M、10000K
+	Preset     string   `json:"preset,omitempty"`      // 例如 superfast、medium
+	MaxHeight  int      `json:"max_height,omitempty"`  // 最大解析度（高度），超過時等比例縮小
+	AudioCodec string   `json:"audio_codec,omitempty"` // 例如 aac、copy，空白時使用 FFmpeg 預設
+	Threads    int      `json:"threads,omitempty"`
+	ExtraArgs  []string `json:"extra_args,omitempty"` // 附加在輸出參數前的 FFmpeg 參數
+	InputArgs  []string `json:"input_args,omitempty"` // 放在 -i 之前的 FFmpeg 參數，例如硬體裝置
+
+	AudioBitrate string `json:"audio_bitrate,omitempty"` // 重新編碼聲音時的位元率，例如 128k
+	AudioFilter  string `json:"-"`                       // 重新編碼聲音時的濾鏡，由響度正規化設定
+
+	// 目標大小模式：依影片長度計算位元率並以兩階段編碼，例如 700M
+	TargetSize string `json:"target_size,omitempty"`
+	// 品質模式：取樣數段短片搜尋符合 VMAF 或 SSIM 目標的最大 CRF
+	TargetVMAF float64 `json:"target_vmaf,omitempty"` // 0-100，例如 93
+	TargetSSIM float64 `json:"target_ssim,omitempty"` // 0-1，例如 0.98
+	Samples    int     `json:"samples,omitempty"`     // 取樣片段數，預設 3
+}
+
+var builtinProfiles = []Profile{
+	{Name: ProfileFast, VideoCodec: "copy", AudioCodec: "copy"},
+	{Name: ProfileGPU, VideoCodec: "h264_nvenc", Bitrate: "10000K", Threads: 5},
+	{Name: ProfileCPU, VideoCodec: "libx264", Bitrate: "3M", Threads: 5, Preset: "superfast"},
+}
+
+var (
+	profilesMu sync.RWMutex
+	profiles   = map[string]Profile{}
+)
+
+func init() {
+	for _, p := range builtinProfiles {
+		profiles[p.Name] = p
+	}
+}
+
+// Validate 檢查設定是否完整
+func (p Profile) Validate() error {
+	if p.Name == "" {
+		return errors.New("轉檔設定缺少名稱")
+	}
+	if p.VideoCodec == "" {
+		return fmt.Errorf("轉檔設定 %s 缺少 video_codec", p.Name)
+	}
+	if p.CRF < 0 || p.MaxHeight < 0 || p.Threads < 0 {
+		return fmt.Errorf("轉檔設定 %s 的數值不可為負數", p.Name)
+	}
+	if p.CRF > 0 && p.Bitrate != "" {
+		return fmt.Errorf("轉檔設定 %s 不可同時指定 crf 與 bitrate", p.Name)
+	}
+	return p.validateTarget()
+}
+
+// Args 回傳 FFmpeg 的編碼參數（不含輸入與輸出檔）
+func (p Profile) Args() []string {
+	// 影像與聲音都不重新編碼時複製所有串流
+	if p.VideoCodec == "copy" && p.AudioCodec == "copy" {
+		return append([]string{"-c", "copy"}, p.ExtraArgs...)
+	}
+
+	args := []string{"-c:v", p.VideoCodec}
+	if p.VideoCodec != "copy" {
+		if p.CRF > 0 {
+			args = append(args, "-crf", strconv.Itoa(p.CRF))
+		}
+		if p.Bitrate != "" {
+			args = append(args, "-b:v", p.Bitrate)
+		}
+		if p.Threads > 0 {
+			args = append(args, "-threads", strconv.Itoa(p.Threads))
+		}
+		if p.Preset != "" {
+			args = append(args, "-preset", p.Preset)
+		}
+		var filters []string
+		if p.MaxHeight > 0 {
+			// 只縮小不放大，寬度維持偶數
+			filters = append(filters, fmt.Sprintf("scale=-2:'min(ih,%d)'", p.MaxHeight))
+		}
+		if strings.HasSuffix(p.VideoCodec, "_vaapi") {
+			// VAAPI 編碼器需要先把畫面上傳到 GPU
+			filters = append(filters, "format=nv12", "hwupload")
+		}
+		if len(filters) > 0 {
+			args = append(args, "-vf", strings.Join(filters, ","))
+		}
+	}
+	if p.AudioCodec != "" {
+		args = append(args, "-c:a", p.AudioCodec)
+		if p.AudioCodec != "copy" && p.AudioBitrate != "" {
+			args = append(args, "-b:a", p.AudioBitrate)
+		}
+		if p.AudioCodec != "copy" && p.AudioFilter != "" {
+			// loudnorm 內部以 192kHz 處理，輸出時恢復一般取樣率
+			args = append(args, "-af", p.AudioFilter, "-ar", "48000")
+		}
+	}
+	return append(args, p.ExtraArgs...)
+}
+
+// RegisterProfile 新增或覆寫轉檔設定
+func RegisterProfile(p Profile) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+	profiles[p.Name] = p
+	return nil
+}
+
+// GetProfile 依名稱取得轉檔設定
+func GetProfile(name string) (Profile, error) {
+	profilesMu.RLock()
+	defer profilesMu.RUnlock()
+
+	p, ok := profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("找不到轉檔設定: %s", name)
+	}
+	return p, nil
+}
+
+// ProfileNames 回傳所有可用的轉檔設定名稱
+func ProfileNames() []string {
+	profilesMu.RLock()
+	defer profilesMu.RUnlock()
+
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ProfileName 回傳轉檔模式對應的內建設定名稱，NoEncode 回傳空字串
+func (m EncodeMode) ProfileName() string {
+	switch m {
+	case FastEncode:
+		return ProfileFast
+	case GPUEncode:
+		return ProfileGPU
+	case CPUEncode:
+		return ProfileCPU
+	default:
+		return ""
+	}
+}
+
+// ParseEncodeMode 解析轉檔模式名稱: none、fast、gpu、cpu，空字串視為 none
+func ParseEncodeMode(s string) (EncodeMode, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "none":
+		return NoEncode, nil
+	case ProfileFast:
+		return FastEncode, nil
+	case ProfileGPU:
+		return GPUEncode, nil
+	case ProfileCPU:
+		return CPUEncode, nil
+	default:
+		return NoEncode, fmt.Errorf("不支援的轉檔模式: %s (可用: none, fast, gpu, cpu)", s)
+	}
+}
+
+// profilesFile 自訂轉檔設定檔格式
+type profilesFile struct {
+	Profiles []Profile `json:"profiles"`
+}
+
+// LoadProfiles 從 JSON 設定檔載入自訂轉檔設定，檔案不存在時不做任何事
+// 與內建設定同名時會覆寫內建設定
+func LoadProfiles(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("無法讀取轉檔設定檔: %v", err)
+	}
+
+	var f profilesFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("無法解析轉檔設定檔: %v", err)
+	}
+
+	for _, p := range f.Profiles {
+		if err := RegisterProfile(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
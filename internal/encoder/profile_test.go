@@ -0,0 +1,134 @@
+package encoder
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBuiltinProfileArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{ProfileFast, []string{"-c", "copy"}},
+		{ProfileGPU, []string{"-c:v", "h264_nvenc", "-b:v", "10000K", "-threads", "5"}},
+		{ProfileCPU, []string{"-c:v", "libx264", "-b:v", "3M", "-threads", "5", "-preset", "superfast"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := GetProfile(tt.name)
+			if err != nil {
+				t.Fatalf("GetProfile failed: %v", err)
+			}
+			if got := p.Args(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Args() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProfileArgs_Custom(t *testing.T) {
+	p := Profile{
+		Name:       "hevc",
+		VideoCodec: "libx265",
+		CRF:        26,
+		Preset:     "medium",
+		MaxHeight:  720,
+		AudioCodec: "aac",
+		ExtraArgs:  []string{"-tag:v", "hvc1"},
+	}
+
+	want := []string{
+		"-c:v", "libx265", "-crf", "26", "-preset", "medium",
+		"-vf", "scale=-2:'min(ih,720)'", "-c:a", "aac", "-tag:v", "hvc1",
+	}
+	if got := p.Args(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Args() = %v, want %v", got, want)
+	}
+}
+
+func TestProfileValidate(t *testing.T) {
+	invalid := []Profile{
+		{VideoCodec: "libx264"},
+		{Name: "x"},
+		{Name: "x", VideoCodec: "libx264", CRF: 23, Bitrate: "3M"},
+		{Name: "x", VideoCodec: "libx264", MaxHeight: -1},
+	}
+	for _, p := range invalid {
+		if err := p.Validate(); err == nil {
+			t.Errorf("expected error for %+v", p)
+		}
+	}
+}
+
+func TestEncodeModeProfileName(t *testing.T) {
+	if NoEncode.ProfileName() != "" {
+		t.Error("NoEncode should not map to a profile")
+	}
+	for _, m := range []EncodeMode{FastEncode, GPUEncode, CPUEncode} {
+		if _, err := GetProfile(m.ProfileName()); err != nil {
+			t.Errorf("%s: %v", m, err)
+		}
+	}
+}
+
+func TestParseEncodeMode(t *testing.T) {
+	for in, want := range map[string]EncodeMode{"": NoEncode, "none": NoEncode, "fast": FastEncode, "GPU": GPUEncode, "cpu": CPUEncode} {
+		if got, err := ParseEncodeMode(in); err != nil || got != want {
+			t.Errorf("ParseEncodeMode(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	if _, err := ParseEncodeMode("hevc"); err == nil {
+		t.Error("expected error for unknown encode mode")
+	}
+}
+
+func TestGetProfile_Unknown(t *testing.T) {
+	if _, err := GetProfile("no-such-profile"); err == nil {
+		t.Error("expected error for unknown profile")
+	}
+}
+
+func TestLoadProfiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	data := `{"profiles": [{"name": "small", "video_codec": "libx264", "crf": 28, "max_height": 480, "audio_codec": "aac"}]}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := LoadProfiles(path); err != nil {
+		t.Fatalf("LoadProfiles failed: %v", err)
+	}
+
+	p, err := GetProfile("small")
+	if err != nil {
+		t.Fatalf("GetProfile failed: %v", err)
+	}
+	if p.CRF != 28 || p.MaxHeight != 480 {
+		t.Errorf("unexpected profile: %+v", p)
+	}
+}
+
+func TestLoadProfiles_Missing(t *testing.T) {
+	if err := LoadProfiles(filepath.Join(t.TempDir(), "missing.json")); err != nil {
+		t.Errorf("missing file should be ignored, got: %v", err)
+	}
+}
+
+func TestLoadProfiles_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	os.WriteFile(path, []byte(`{"profiles": [{"name": "broken"}]}`), 0644)
+
+	if err := LoadProfiles(path); err == nil {
+		t.Error("expected error for profile without video_codec")
+	}
+}
+
+func TestEncodeProfile_Empty(t *testing.T) {
+	if err := EncodeProfile("/nonexistent/path", "video", "", "", nil); err != nil {
+		t.Errorf("empty profile should not encode, got: %v", err)
+	}
+}
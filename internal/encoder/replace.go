@@ -0,0 +1,78 @@
+package encoder
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+
+	"github.com/jable-downloader-go/internal/ffmpeg"
+)
+
+// probeMedia 讀取影片資訊，測試時可替換
+var probeMedia = ffmpeg.ProbeMedia
+
+// hasFFprobe 回傳本機是否有 ffprobe，測試時可替換
+var hasFFprobe = func() bool {
+	_, err := exec.LookPath("ffprobe")
+	return err == nil
+}
+
+// validateOutput 以 ffprobe 確認暫存輸出可以讀取，且長度與串流和原始影片一致
+// 沒有 ffprobe 時只確認輸出檔不是空檔
+func validateOutput(tempPath, originalPath string) error {
+	if !hasFFprobe() {
+		info, err := os.Stat(tempPath)
+		if err != nil {
+			return err
+		}
+		if info.Size() == 0 {
+			return errors.New("輸出檔是空檔")
+		}
+		fmt.Println("找不到 ffprobe, 只確認輸出檔不是空檔")
+		return nil
+	}
+
+	out, err := probeMedia(tempPath)
+	if err != nil {
+		return err
+	}
+	if out.VideoStreams == 0 {
+		return errors.New("輸出檔沒有影像串流")
+	}
+	if out.Duration <= 0 {
+		return errors.New("輸出檔長度為 0")
+	}
+
+	orig, err := probeMedia(originalPath)
+	if err != nil || orig.Duration <= 0 {
+		// 無法讀取原始影片時只檢查輸出檔本身
+		return nil
+	}
+
+	// 允許 2 秒或 1% 的誤差（重新編碼時最後一個 GOP 長度可能不同）
+	tolerance := math.Max(2, orig.Duration*0.01)
+	if math.Abs(orig.Duration-out.Duration) > tolerance {
+		return fmt.Errorf("輸出檔長度 %.1f 秒與原始影片 %.1f 秒不符", out.Duration, orig.Duration)
+	}
+	if orig.AudioStreams > 0 && out.AudioStreams == 0 {
+		return errors.New("輸出檔缺少聲音串流")
+	}
+	return nil
+}
+
+// replaceFile 驗證暫存輸出後以 rename 原子地取代原始檔
+// 驗證或取代失敗時刪除暫存檔並保留原始檔，不會兩個檔案都遺失
+func replaceFile(tempPath, originalPath string) error {
+	if err := validateOutput(tempPath, originalPath); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("輸出檔驗證失敗, 已保留原始影片: %v", err)
+	}
+
+	if err := os.Rename(tempPath, originalPath); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("無法取代原始檔案, 已保留原始影片: %v", err)
+	}
+	return nil
+}
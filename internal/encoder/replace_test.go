@@ -0,0 +1,117 @@
+package encoder
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jable-downloader-go/internal/ffmpeg"
+)
+
+// fakeProbe 以檔名對應假的 ffprobe 結果
+func fakeProbe(t *testing.T, infos map[string]*ffmpeg.MediaInfo) {
+	t.Helper()
+	orig := probeMedia
+	probeMedia = func(path string) (*ffmpeg.MediaInfo, error) {
+		if info, ok := infos[filepath.Base(path)]; ok {
+			return info, nil
+		}
+		return nil, errors.New("invalid data found when processing input")
+	}
+	origHas := hasFFprobe
+	hasFFprobe = func() bool { return true }
+	t.Cleanup(func() {
+		probeMedia = orig
+		hasFFprobe = origHas
+	})
+}
+
+func writeReplaceFiles(t *testing.T) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	original := filepath.Join(dir, "abc-123.mp4")
+	temp := filepath.Join(dir, "f_abc-123.mp4")
+	os.WriteFile(original, []byte("original"), 0644)
+	os.WriteFile(temp, []byte("encoded"), 0644)
+	return original, temp
+}
+
+func TestReplaceFile_Valid(t *testing.T) {
+	original, temp := writeReplaceFiles(t)
+	fakeProbe(t, map[string]*ffmpeg.MediaInfo{
+		"abc-123.mp4":   {Duration: 3600, VideoStreams: 1, AudioStreams: 1},
+		"f_abc-123.mp4": {Duration: 3599.5, VideoStreams: 1, AudioStreams: 1},
+	})
+
+	if err := replaceFile(temp, original); err != nil {
+		t.Fatalf("replaceFile failed: %v", err)
+	}
+	if data, _ := os.ReadFile(original); string(data) != "encoded" {
+		t.Errorf("original should be replaced, got %q", data)
+	}
+	if _, err := os.Stat(temp); !os.IsNotExist(err) {
+		t.Error("temp file should be gone after replace")
+	}
+}
+
+func TestReplaceFile_KeepsOriginalOnInvalidOutput(t *testing.T) {
+	tests := []struct {
+		name string
+		temp *ffmpeg.MediaInfo
+		want string
+	}{
+		{"unreadable", nil, "invalid data"},
+		{"no_video", &ffmpeg.MediaInfo{Duration: 3600, AudioStreams: 1}, "影像串流"},
+		{"truncated", &ffmpeg.MediaInfo{Duration: 1200, VideoStreams: 1, AudioStreams: 1}, "不符"},
+		{"no_audio", &ffmpeg.MediaInfo{Duration: 3600, VideoStreams: 1}, "聲音串流"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original, temp := writeReplaceFiles(t)
+			infos := map[string]*ffmpeg.MediaInfo{
+				"abc-123.mp4": {Duration: 3600, VideoStreams: 1, AudioStreams: 1},
+			}
+			if tt.temp != nil {
+				infos["f_abc-123.mp4"] = tt.temp
+			}
+			fakeProbe(t, infos)
+
+			err := replaceFile(temp, original)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error containing %q, got %v", tt.want, err)
+			}
+			if data, _ := os.ReadFile(original); string(data) != "original" {
+				t.Errorf("original should be kept, got %q", data)
+			}
+			if _, err := os.Stat(temp); !os.IsNotExist(err) {
+				t.Error("broken temp file should be removed")
+			}
+		})
+	}
+}
+
+func TestReplaceFile_NoFFprobe(t *testing.T) {
+	orig := hasFFprobe
+	hasFFprobe = func() bool { return false }
+	t.Cleanup(func() { hasFFprobe = orig })
+
+	original, temp := writeReplaceFiles(t)
+	if err := replaceFile(temp, original); err != nil {
+		t.Fatalf("replaceFile failed: %v", err)
+	}
+	if data, _ := os.ReadFile(original); string(data) != "encoded" {
+		t.Errorf("expected encoded output to replace original, got %q", data)
+	}
+
+	// 空的輸出檔仍視為失敗
+	os.WriteFile(temp, nil, 0644)
+	if err := replaceFile(temp, original); err == nil {
+		t.Error("expected error for empty output")
+	}
+	if data, _ := os.ReadFile(original); string(data) != "encoded" {
+		t.Errorf("original should be kept, got %q", data)
+	}
+}
@@ -0,0 +1,306 @@
+package encoder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jable-downloader-go/internal/ffmpeg"
+	"github.com/jable-downloader-go/pkg/utils"
+)
+
+const (
+	defaultAudioBitrate = "128k" // 目標大小模式未指定時的聲音位元率
+	defaultSamples      = 3      // 品質模式預設取樣片段數
+	sampleSeconds       = 10     // 每個取樣片段的秒數
+	muxOverhead         = 0.02   // 預留給封裝格式的空間比例
+
+	// CRF 搜尋範圍，超出此範圍的畫質或大小通常沒有意義
+	minSearchCRF = 18
+	maxSearchCRF = 35
+)
+
+// targetCodecs 目標大小與品質模式支援的 CPU 編碼器
+var targetCodecs = map[string]bool{"libx264": true, "libx265": true}
+
+// IsTargetSize 是否為目標大小模式
+func (p Profile) IsTargetSize() bool {
+	return p.TargetSize != ""
+}
+
+// IsTargetQuality 是否為品質模式
+func (p Profile) IsTargetQuality() bool {
+	return p.TargetVMAF > 0 || p.TargetSSIM > 0
+}
+
+func (p Profile) validateTarget() error {
+	if !p.IsTargetSize() && !p.IsTargetQuality() {
+		return nil
+	}
+
+	if !targetCodecs[p.VideoCodec] {
+		return fmt.Errorf("轉檔設定 %s: 目標大小與品質模式僅支援 libx264、libx265", p.Name)
+	}
+	if p.CRF > 0 || p.Bitrate != "" {
+		return fmt.Errorf("轉檔設定 %s: 目標大小與品質模式不可同時指定 crf 或 bitrate", p.Name)
+	}
+	if p.IsTargetSize() && p.IsTargetQuality() {
+		return fmt.Errorf("轉檔設定 %s: target_size 與 target_vmaf/target_ssim 只能擇一", p.Name)
+	}
+	if p.TargetVMAF > 0 && p.TargetSSIM > 0 {
+		return fmt.Errorf("轉檔設定 %s: target_vmaf 與 target_ssim 只能擇一", p.Name)
+	}
+	if p.TargetVMAF > 100 || p.TargetSSIM > 1 || p.TargetVMAF < 0 || p.TargetSSIM < 0 || p.Samples < 0 {
+		return fmt.Errorf("轉檔設定 %s: 品質目標超出範圍 (VMAF 0-100, SSIM 0-1)", p.Name)
+	}
+	if p.IsTargetSize() {
+		if _, err := utils.ParseSize(p.TargetSize); err != nil {
+			return fmt.Errorf("轉檔設定 %s: target_size: %v", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// targetBitrate 依目標大小與影片長度計算影像位元率（kbps），扣除聲音與封裝所需空間
+func targetBitrate(size int64, duration float64, audioKbps int) (int, error) {
+	if duration <= 0 {
+		return 0, errors.New("無法取得影片長度")
+	}
+
+	totalKbps := float64(size) * 8 * (1 - muxOverhead) / duration / 1000
+	videoKbps := int(totalKbps) - audioKbps
+	if videoKbps <= 0 {
+		return 0, fmt.Errorf("目標大小過小，影片長度 %.0f 秒至少需要 %d kbps 給聲音", duration, audioKbps)
+	}
+	return videoKbps, nil
+}
+
+// parseKbps 解析 128k、1M 等位元率為 kbps
+func parseKbps(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	multiplier := 0.001
+	switch {
+	case strings.HasSuffix(s, "k"):
+		multiplier, s = 1, strings.TrimSuffix(s, "k")
+	case strings.HasSuffix(s, "m"):
+		multiplier, s = 1000, strings.TrimSuffix(s, "m")
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("無效的位元率: %s", s)
+	}
+	return int(n * multiplier), nil
+}
+
+// passArgs 回傳兩階段編碼第 pass 階段的參數，libx265 需以 -x265-params 指定
+func passArgs(codec string, pass int, logPrefix string) []string {
+	if codec == "libx265" {
+		return []string{"-x265-params", fmt.Sprintf("pass=%d:stats=%s.log", pass, logPrefix)}
+	}
+	return []string{"-pass", strconv.Itoa(pass), "-passlogfile", logPrefix}
+}
+
+// encodeTargetSize 以兩階段編碼輸出接近目標大小的影片
+func encodeTargetSize(ctx context.Context, p Profile, inputPath, outputPath string, outputArgs []string, progress ffmpeg.ProgressFunc) error {
+	size, _ := utils.ParseSize(p.TargetSize)
+	duration, err := ffmpeg.ProbeDuration(inputPath)
+	if err != nil {
+		return err
+	}
+
+	if p.AudioCodec == "" || p.AudioCodec == "copy" {
+		// 聲音必須重新編碼才能預估大小
+		p.AudioCodec = "aac"
+	}
+	if p.AudioBitrate == "" {
+		p.AudioBitrate = defaultAudioBitrate
+	}
+	audioKbps, err := parseKbps(p.AudioBitrate)
+	if err != nil {
+		return err
+	}
+
+	videoKbps, err := targetBitrate(size, duration, audioKbps)
+	if err != nil {
+		return err
+	}
+	p.Bitrate = fmt.Sprintf("%dk", videoKbps)
+	fmt.Printf("目標大小 %s, 影像位元率 %s\n", p.TargetSize, p.Bitrate)
+
+	logPrefix := filepath.Join(filepath.Dir(outputPath), "ffmpeg2pass")
+	defer removePassLogs(logPrefix)
+
+	// 第一階段只分析影像，不輸出檔案
+	analyze := p
+	analyze.AudioFilter = ""
+	pass1 := append(append([]string{"-y"}, p.InputArgs...), "-i", inputPath)
+	pass1 = append(pass1, analyze.Args()...)
+	pass1 = append(pass1, passArgs(p.VideoCodec, 1, logPrefix)...)
+	pass1 = append(pass1, "-an", "-f", "null", os.DevNull)
+	fmt.Println("兩階段編碼: 第 1 階段")
+	if err := ffmpeg.RunContext(ctx, pass1, duration, ffmpeg.PassProgress(progress, 1, 2)); err != nil {
+		return fmt.Errorf("第 1 階段編碼失敗: %v", err)
+	}
+
+	pass2 := append(append([]string{"-y"}, p.InputArgs...), "-i", inputPath)
+	pass2 = append(pass2, p.Args()...)
+	pass2 = append(pass2, passArgs(p.VideoCodec, 2, logPrefix)...)
+	pass2 = append(pass2, outputArgs...)
+	fmt.Println("兩階段編碼: 第 2 階段")
+	if err := ffmpeg.RunContext(ctx, append(pass2, outputPath), duration, ffmpeg.PassProgress(progress, 2, 2)); err != nil {
+		return fmt.Errorf("第 2 階段編碼失敗: %v", err)
+	}
+	return nil
+}
+
+func removePassLogs(logPrefix string) {
+	matches, _ := filepath.Glob(logPrefix + "*")
+	for _, path := range matches {
+		os.Remove(path)
+	}
+}
+
+// scoreFunc 回傳以 crf 編碼取樣片段後的平均品質分數
+type scoreFunc func(crf int) (float64, error)
+
+// searchCRF 以二分搜尋找出品質分數仍達到 target 的最大 CRF（檔案最小）
+// 分數隨 CRF 增加而下降；連最小 CRF 都達不到目標時回傳 minSearchCRF
+func searchCRF(target float64, score scoreFunc) (int, error) {
+	best := minSearchCRF
+	lo, hi := minSearchCRF, maxSearchCRF
+	for lo <= hi {
+		mid := (lo + hi) / 2
+		s, err := score(mid)
+		if err != nil {
+			return 0, err
+		}
+		fmt.Printf("CRF %d: 品質分數 %.4f\n", mid, s)
+
+		if s >= target {
+			best = mid
+			lo = mid + 1
+		} else {
+			hi = mid - 1
+		}
+	}
+	return best, nil
+}
+
+// chooseCRF 在影片中平均取樣數段短片，找出符合 VMAF 或 SSIM 目標的 CRF
+func chooseCRF(ctx context.Context, p Profile, inputPath, workDir string) (int, error) {
+	duration, err := ffmpeg.ProbeDuration(inputPath)
+	if err != nil {
+		return 0, err
+	}
+
+	count := p.Samples
+	if count == 0 {
+		count = defaultSamples
+	}
+
+	var samples []string
+	defer func() {
+		for _, path := range samples {
+			os.Remove(path)
+		}
+	}()
+
+	for i := 0; i < count; i++ {
+		start := duration * float64(i+1) / float64(count+1)
+		samplePath := filepath.Join(workDir, fmt.Sprintf("sample_%02d.mkv", i))
+		err := runQuietContext(ctx, "-y", "-ss", formatSeconds(start), "-i", inputPath,
+			"-t", strconv.Itoa(sampleSeconds), "-map", "0:v:0", "-c", "copy", samplePath)
+		if err != nil {
+			return 0, fmt.Errorf("無法擷取取樣片段: %v", err)
+		}
+		samples = append(samples, samplePath)
+	}
+
+	target, metric := p.TargetVMAF, "VMAF"
+	if p.TargetSSIM > 0 {
+		target, metric = p.TargetSSIM, "SSIM"
+	}
+	fmt.Printf("品質模式: 以 %d 個取樣片段搜尋 %s >= %g 的 CRF\n", len(samples), metric, target)
+
+	encodedPath := filepath.Join(workDir, "sample_encoded.mkv")
+	defer os.Remove(encodedPath)
+
+	return searchCRF(target, func(crf int) (float64, error) {
+		trial := p
+		trial.CRF = crf
+		trial.AudioCodec = ""
+		trial.AudioFilter = ""
+
+		var total float64
+		for _, samplePath := range samples {
+			args := append([]string{"-y", "-i", samplePath}, trial.Args()...)
+			if err := runQuietContext(ctx, append(args, "-an", encodedPath)...); err != nil {
+				return 0, fmt.Errorf("取樣片段編碼失敗: %v", err)
+			}
+
+			s, err := measureQuality(ctx, metric, encodedPath, samplePath)
+			if err != nil {
+				return 0, err
+			}
+			total += s
+		}
+		return total / float64(len(samples)), nil
+	})
+}
+
+var (
+	vmafScorePattern = regexp.MustCompile(`VMAF score:\s*([0-9.]+)`)
+	ssimScorePattern = regexp.MustCompile(`All:\s*([0-9.]+)`)
+)
+
+// measureQuality 比較編碼後與原始片段的品質，編碼後解析度不同時放大至原始解析度再比較
+func measureQuality(ctx context.Context, metric, distortedPath, referencePath string) (float64, error) {
+	filter := "[0:v][1:v]scale2ref=flags=bicubic[dist][ref];[dist][ref]ssim"
+	pattern := ssimScorePattern
+	if metric == "VMAF" {
+		filter = "[0:v][1:v]scale2ref=flags=bicubic[dist][ref];[dist][ref]libvmaf"
+		pattern = vmafScorePattern
+	}
+
+	out, err := exec.CommandContext(ctx, "ffmpeg", "-hide_banner", "-i", distortedPath, "-i", referencePath,
+		"-lavfi", filter, "-f", "null", "-").CombinedOutput()
+	if err != nil {
+		return 0, fmt.Errorf("%s 計算失敗: %v", metric, err)
+	}
+	return parseScore(string(out), pattern)
+}
+
+// parseScore 取出 FFmpeg 輸出中最後一個品質分數
+func parseScore(output string, pattern *regexp.Regexp) (float64, error) {
+	matches := pattern.FindAllStringSubmatch(output, -1)
+	if len(matches) == 0 {
+		return 0, errors.New("找不到品質分數")
+	}
+	return strconv.ParseFloat(matches[len(matches)-1][1], 64)
+}
+
+// runQuiet 執行 FFmpeg 但不輸出到終端機，失敗時附上最後的錯誤訊息
+func runQuiet(args ...string) error {
+	return runQuietContext(context.Background(), args...)
+}
+
+// runQuietContext 與 runQuiet 相同，ctx 取消時終止 FFmpeg
+func runQuietContext(ctx context.Context, args ...string) error {
+	out, err := exec.CommandContext(ctx, "ffmpeg", append([]string{"-hide_banner", "-loglevel", "error"}, args...)...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func formatSeconds(sec float64) string {
+	return strconv.FormatFloat(math.Max(sec, 0), 'f', 3, 64)
+}
@@ -0,0 +1,118 @@
+package encoder
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTargetBitrate(t *testing.T) {
+	// 700 MiB、60 分鐘、聲音 128 kbps
+	got, err := targetBitrate(700<<20, 3600, 128)
+	if err != nil {
+		t.Fatalf("targetBitrate failed: %v", err)
+	}
+	if got != 1470 {
+		t.Errorf("expected 1470 kbps, got %d", got)
+	}
+
+	if _, err := targetBitrate(1<<20, 3600, 128); err == nil {
+		t.Error("expected error when target size is too small")
+	}
+	if _, err := targetBitrate(700<<20, 0, 128); err == nil {
+		t.Error("expected error for unknown duration")
+	}
+}
+
+func TestParseKbps(t *testing.T) {
+	tests := map[string]int{"128k": 128, "1.5M": 1500, "96000": 96}
+	for in, want := range tests {
+		got, err := parseKbps(in)
+		if err != nil || got != want {
+			t.Errorf("parseKbps(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	if _, err := parseKbps("fast"); err == nil {
+		t.Error("expected error for invalid bitrate")
+	}
+}
+
+func TestPassArgs(t *testing.T) {
+	if got := passArgs("libx264", 1, "log"); !reflect.DeepEqual(got, []string{"-pass", "1", "-passlogfile", "log"}) {
+		t.Errorf("unexpected libx264 pass args: %v", got)
+	}
+	if got := passArgs("libx265", 2, "log"); !reflect.DeepEqual(got, []string{"-x265-params", "pass=2:stats=log.log"}) {
+		t.Errorf("unexpected libx265 pass args: %v", got)
+	}
+}
+
+func TestSearchCRF(t *testing.T) {
+	// 模擬品質隨 CRF 線性下降: CRF 18 = 99, 每增加 1 降 1 分
+	score := func(crf int) (float64, error) {
+		return float64(99 - (crf - minSearchCRF)), nil
+	}
+
+	got, err := searchCRF(93, score)
+	if err != nil {
+		t.Fatalf("searchCRF failed: %v", err)
+	}
+	if got != 24 {
+		t.Errorf("expected CRF 24, got %d", got)
+	}
+
+	// 目標無法達成時使用最高畫質
+	got, _ = searchCRF(100, score)
+	if got != minSearchCRF {
+		t.Errorf("expected CRF %d, got %d", minSearchCRF, got)
+	}
+}
+
+func TestParseScore(t *testing.T) {
+	vmaf := "[libvmaf @ 0x1] VMAF score: 94.123456\n"
+	if got, err := parseScore(vmaf, vmafScorePattern); err != nil || got != 94.123456 {
+		t.Errorf("parseScore(vmaf) = %v, %v", got, err)
+	}
+
+	ssim := "[Parsed_ssim_1 @ 0x1] SSIM Y:0.990 (20.1) U:0.99 V:0.99 All:0.985432 (18.4)\n"
+	if got, err := parseScore(ssim, ssimScorePattern); err != nil || got != 0.985432 {
+		t.Errorf("parseScore(ssim) = %v, %v", got, err)
+	}
+
+	if _, err := parseScore("no score here", vmafScorePattern); err == nil {
+		t.Error("expected error when score is missing")
+	}
+}
+
+func TestProfileValidate_Target(t *testing.T) {
+	valid := []Profile{
+		{Name: "share", VideoCodec: "libx264", TargetSize: "700M", Preset: "medium"},
+		{Name: "quality", VideoCodec: "libx265", TargetVMAF: 93},
+		{Name: "ssim", VideoCodec: "libx264", TargetSSIM: 0.98, Samples: 5},
+	}
+	for _, p := range valid {
+		if err := p.Validate(); err != nil {
+			t.Errorf("%s: unexpected error: %v", p.Name, err)
+		}
+	}
+
+	invalid := []Profile{
+		{Name: "gpu", VideoCodec: "h264_nvenc", TargetSize: "700M"},
+		{Name: "both", VideoCodec: "libx264", TargetSize: "700M", TargetVMAF: 93},
+		{Name: "crf", VideoCodec: "libx264", CRF: 23, TargetVMAF: 93},
+		{Name: "metrics", VideoCodec: "libx264", TargetVMAF: 93, TargetSSIM: 0.98},
+		{Name: "range", VideoCodec: "libx264", TargetSSIM: 2},
+		{Name: "size", VideoCodec: "libx264", TargetSize: "big"},
+	}
+	for _, p := range invalid {
+		if err := p.Validate(); err == nil {
+			t.Errorf("%s: expected error", p.Name)
+		}
+	}
+}
+
+func TestProfileArgs_AudioBitrate(t *testing.T) {
+	p := Profile{Name: "x", VideoCodec: "libx264", Bitrate: "1470k", AudioCodec: "aac", AudioBitrate: "128k"}
+	if got := strings.Join(p.Args(), " "); got != "-c:v libx264 -b:v 1470k -c:a aac -b:a 128k" {
+		t.Errorf("unexpected args: %s", got)
+	}
+}
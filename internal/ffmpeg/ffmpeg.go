@@ -0,0 +1,110 @@
+package ffmpeg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Run 執行 ffmpeg，fn 不為 nil 時以 -progress 取得進度並回報
+// duration 為輸出影片的預估總秒數，用來計算百分比與剩餘時間
+func Run(args []string, duration float64, fn ProgressFunc) error {
+	return RunContext(context.Background(), args, duration, fn)
+}
+
+// RunContext 與 Run 相同，ctx 取消時終止 ffmpeg
+func RunContext(ctx context.Context, args []string, duration float64, fn ProgressFunc) error {
+	if fn == nil {
+		cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		return cmd.Run()
+	}
+
+	// -progress pipe:1 將機器可讀的進度寫到 stdout
+	// -nostats         不再於 stderr 輸出統計行，避免與進度顯示重疊
+	cmd := exec.CommandContext(ctx, "ffmpeg", append([]string{"-progress", "pipe:1", "-nostats"}, args...)...)
+	cmd.Stderr = os.Stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	parseErr := ParseProgress(stdout, duration, fn)
+	if err := cmd.Wait(); err != nil {
+		return err
+	}
+	return parseErr
+}
+
+// ProbeDuration 以 ffprobe 取得影片長度（秒）
+func ProbeDuration(path string) (float64, error) {
+	out, err := exec.Command("ffprobe",
+		"-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		path,
+	).Output()
+	if err != nil {
+		return 0, fmt.Errorf("無法取得影片長度: %v", err)
+	}
+
+	duration, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("無法解析影片長度: %v", err)
+	}
+	return duration, nil
+}
+
+// MediaInfo ffprobe 取得的影片基本資訊
+type MediaInfo struct {
+	Duration     float64
+	VideoStreams int
+	AudioStreams int
+}
+
+// ProbeMedia 以 ffprobe 讀取影片長度與串流數量，檔案損壞時回傳錯誤
+func ProbeMedia(path string) (*MediaInfo, error) {
+	out, err := exec.Command("ffprobe",
+		"-v", "error",
+		"-show_entries", "format=duration:stream=codec_type",
+		"-of", "json",
+		path,
+	).Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe 無法讀取 %s: %v", filepath.Base(path), err)
+	}
+
+	var result struct {
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+		Streams []struct {
+			CodecType string `json:"codec_type"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		return nil, fmt.Errorf("無法解析 ffprobe 輸出: %v", err)
+	}
+
+	info := &MediaInfo{}
+	info.Duration, _ = strconv.ParseFloat(result.Format.Duration, 64)
+	for _, s := range result.Streams {
+		switch s.CodecType {
+		case "video":
+			info.VideoStreams++
+		case "audio":
+			info.AudioStreams++
+		}
+	}
+	return info, nil
+}
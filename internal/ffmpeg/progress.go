@@ -0,0 +1,128 @@
+package ffmpeg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Progress FFmpeg 以 -progress 回報的處理進度
+type Progress struct {
+	Stage    string        `json:"stage,omitempty"` // 呼叫端設定的階段名稱，例如 merging、encoding
+	OutTime  float64       `json:"out_time"`        // 已輸出的影片秒數
+	Duration float64       `json:"duration"`        // 影片總秒數，0 表示未知
+	Speed    float64       `json:"speed"`           // 處理速度倍率，例如 3.5 表示 3.5x
+	Percent  float64       `json:"percent"`         // 0-100，總長度未知時為 0
+	ETA      time.Duration `json:"-"`               // 預估剩餘時間，無法估計時為 0
+	Done     bool          `json:"done"`
+
+	ETASeconds float64 `json:"eta_seconds"` // 與 ETA 相同，以秒為單位供 API 使用
+}
+
+// ProgressFunc 接收進度回報的函數
+type ProgressFunc func(Progress)
+
+// ParseProgress 讀取 -progress 輸出，每收到一個 progress=continue|end 區塊呼叫一次 fn
+func ParseProgress(r io.Reader, duration float64, fn ProgressFunc) error {
+	p := Progress{Duration: duration}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "out_time_us", "out_time_ms":
+			// FFmpeg 的 out_time_ms 實際上也是微秒
+			if us, err := strconv.ParseInt(value, 10, 64); err == nil && us >= 0 {
+				p.OutTime = float64(us) / 1e6
+			}
+		case "speed":
+			if speed, err := strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64); err == nil {
+				p.Speed = speed
+			}
+		case "progress":
+			p.Done = value == "end"
+			p.update()
+			if fn != nil {
+				fn(p)
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// update 依已輸出秒數、總長度與速度計算百分比與剩餘時間
+func (p *Progress) update() {
+	p.Percent, p.ETA = 0, 0
+	defer func() { p.ETASeconds = p.ETA.Seconds() }()
+	if p.Done {
+		p.Percent = 100
+		return
+	}
+	if p.Duration <= 0 {
+		return
+	}
+
+	p.Percent = p.OutTime / p.Duration * 100
+	if p.Percent > 100 {
+		p.Percent = 100
+	}
+	if p.Speed > 0 && p.OutTime < p.Duration {
+		p.ETA = time.Duration((p.Duration - p.OutTime) / p.Speed * float64(time.Second))
+	}
+}
+
+// PassProgress 將多階段處理中第 pass 階段（從 1 開始）的進度換算為整體進度
+// 每個階段各佔 1/passes，剩餘時間加上後續階段的預估時間，只有最後一個階段結束時回報 Done
+func PassProgress(fn ProgressFunc, pass, passes int) ProgressFunc {
+	if fn == nil || passes <= 1 {
+		return fn
+	}
+	return func(p Progress) {
+		remaining := passes - pass
+		p.Percent = (float64(pass-1)*100 + p.Percent) / float64(passes)
+		if remaining > 0 {
+			p.Done = false
+			if p.Speed > 0 && p.Duration > 0 {
+				p.ETA += time.Duration(float64(remaining) * p.Duration / p.Speed * float64(time.Second))
+			}
+		}
+		p.ETASeconds = p.ETA.Seconds()
+		fn(p)
+	}
+}
+
+// String 回傳適合顯示在終端機的進度，例如 "45.2% 速度 3.10x 剩餘 00:12"
+func (p Progress) String() string {
+	if p.Done {
+		return "100.0%"
+	}
+	if p.Duration <= 0 {
+		return fmt.Sprintf("%s 速度 %.2fx", formatSeconds(p.OutTime), p.Speed)
+	}
+	return fmt.Sprintf("%.1f%% 速度 %.2fx 剩餘 %s", p.Percent, p.Speed, formatSeconds(p.ETA.Seconds()))
+}
+
+func formatSeconds(sec float64) string {
+	s := int(sec + 0.5)
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%02d:%02d", s/60, s%60)
+}
+
+// PrintProgress 回傳在終端機同一行更新進度的 ProgressFunc
+func PrintProgress(label string) ProgressFunc {
+	return func(p Progress) {
+		fmt.Printf("\r%s: %s          ", label, p)
+		if p.Done {
+			fmt.Println()
+		}
+	}
+}
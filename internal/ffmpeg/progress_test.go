@@ -0,0 +1,134 @@
+package ffmpeg
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sampleProgress = `frame=100
+fps=50.0
+out_time_us=30000000
+out_time_ms=30000000
+out_time=00:00:30.000000
+speed=2.0x
+progress=continue
+frame=200
+out_time_ms=60000000
+speed=N/A
+progress=continue
+out_time_ms=120000000
+speed=3x
+progress=end
+`
+
+func TestParseProgress(t *testing.T) {
+	var got []Progress
+	err := ParseProgress(strings.NewReader(sampleProgress), 120, func(p Progress) {
+		got = append(got, p)
+	})
+	if err != nil {
+		t.Fatalf("ParseProgress failed: %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("expected 3 updates, got %d", len(got))
+	}
+
+	first := got[0]
+	if first.OutTime != 30 || first.Speed != 2 || first.Percent != 25 {
+		t.Errorf("unexpected first update: %+v", first)
+	}
+	// 剩餘 90 秒影片，2 倍速需 45 秒
+	if first.ETA != 45*time.Second {
+		t.Errorf("expected ETA 45s, got %v", first.ETA)
+	}
+
+	// speed=N/A 時沿用上一次的速度
+	if got[1].Percent != 50 || got[1].Speed != 2 {
+		t.Errorf("unexpected second update: %+v", got[1])
+	}
+
+	last := got[2]
+	if !last.Done || last.Percent != 100 || last.ETA != 0 {
+		t.Errorf("unexpected final update: %+v", last)
+	}
+}
+
+func TestParseProgress_UnknownDuration(t *testing.T) {
+	var last Progress
+	ParseProgress(strings.NewReader("out_time_ms=5000000\nspeed=1.5x\nprogress=continue\n"), 0, func(p Progress) {
+		last = p
+	})
+
+	if last.Percent != 0 || last.ETA != 0 {
+		t.Errorf("percent and ETA should be unknown: %+v", last)
+	}
+	if last.OutTime != 5 {
+		t.Errorf("expected OutTime=5, got %v", last.OutTime)
+	}
+}
+
+func TestProgressString(t *testing.T) {
+	tests := []struct {
+		p    Progress
+		want string
+	}{
+		{Progress{OutTime: 30, Duration: 120, Speed: 2, Percent: 25, ETA: 45 * time.Second}, "25.0% 速度 2.00x 剩餘 00:45"},
+		{Progress{OutTime: 3725, Speed: 1}, "1:02:05 速度 1.00x"},
+		{Progress{Done: true}, "100.0%"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.p.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestProgressJSON_ETASeconds(t *testing.T) {
+	var got Progress
+	ParseProgress(strings.NewReader(sampleProgress), 120, func(p Progress) {
+		if got.Duration == 0 {
+			got = p
+		}
+	})
+
+	data, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"eta_seconds":45`) || strings.Contains(string(data), `"eta":`) {
+		t.Errorf("expected ETA in seconds only, got %s", data)
+	}
+}
+
+func TestPassProgress(t *testing.T) {
+	var got []Progress
+	collect := func(p Progress) { got = append(got, p) }
+
+	ParseProgress(strings.NewReader(sampleProgress), 120, PassProgress(collect, 1, 2))
+	ParseProgress(strings.NewReader(sampleProgress), 120, PassProgress(collect, 2, 2))
+
+	if len(got) != 6 {
+		t.Fatalf("expected 6 updates, got %d", len(got))
+	}
+	// 第 1 階段 0-50%，第 2 階段 50-100%
+	if got[0].Percent != 12.5 || got[2].Percent != 50 || got[3].Percent != 62.5 || got[5].Percent != 100 {
+		t.Errorf("unexpected percents: %v %v %v %v", got[0].Percent, got[2].Percent, got[3].Percent, got[5].Percent)
+	}
+	if got[2].Done || !got[5].Done {
+		t.Errorf("only the last pass should report done: %v %v", got[2].Done, got[5].Done)
+	}
+	// 第 1 階段剩餘 45 秒，加上第 2 階段 120 秒 / 2x
+	if got[0].ETA != 105*time.Second || got[0].ETASeconds != 105 {
+		t.Errorf("expected ETA 105s including the second pass, got %v (%v)", got[0].ETA, got[0].ETASeconds)
+	}
+	if got[3].ETA != 45*time.Second {
+		t.Errorf("expected ETA 45s in the last pass, got %v", got[3].ETA)
+	}
+
+	if PassProgress(nil, 1, 2) != nil {
+		t.Error("expected nil ProgressFunc to stay nil")
+	}
+}
@@ -0,0 +1,76 @@
+package hls
+
+import (
+	"net/url"
+)
+
+// AdFilter 判斷 discontinuity 群組是否為插入的廣告
+type AdFilter struct {
+	MaxDuration float64 // 群組總長度不超過此秒數視為廣告，0 表示不以長度判斷
+	ForeignHost bool    // 片段主機與正片不同的群組視為廣告
+}
+
+// Enabled 是否啟用任何廣告判斷條件
+func (f AdFilter) Enabled() bool {
+	return f.MaxDuration > 0 || f.ForeignHost
+}
+
+// DropAds 移除看起來像廣告的 discontinuity 群組，回傳移除的片段數
+// 總長度最長的群組視為正片，永遠不會被移除
+func (p *Playlist) DropAds(f AdFilter) int {
+	if !f.Enabled() {
+		return 0
+	}
+
+	groups := p.Groups()
+	if len(groups) < 2 {
+		return 0
+	}
+
+	main := 0
+	for i, g := range groups {
+		if groupDuration(g) > groupDuration(groups[main]) {
+			main = i
+		}
+	}
+	mainHost := segmentHost(groups[main][0])
+
+	var kept []Segment
+	dropped := 0
+	for i, g := range groups {
+		isAd := false
+		if i != main {
+			if f.MaxDuration > 0 && groupDuration(g) <= f.MaxDuration {
+				isAd = true
+			}
+			if f.ForeignHost && segmentHost(g[0]) != mainHost {
+				isAd = true
+			}
+		}
+
+		if isAd {
+			dropped += len(g)
+			continue
+		}
+		kept = append(kept, g...)
+	}
+
+	p.Segments = kept
+	return dropped
+}
+
+func groupDuration(g []Segment) float64 {
+	var total float64
+	for _, s := range g {
+		total += s.Duration
+	}
+	return total
+}
+
+func segmentHost(s Segment) string {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
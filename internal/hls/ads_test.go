@@ -0,0 +1,85 @@
+package hls
+
+import "testing"
+
+// adPlaylist 正片中間插入一段 15 秒、來自其他主機的廣告
+func adPlaylist() *Playlist {
+	return &Playlist{Segments: []Segment{
+		{URL: "https://cdn.example.com/a1.ts", Duration: 10},
+		{URL: "https://cdn.example.com/a2.ts", Duration: 10},
+		{URL: "https://ads.example.net/ad1.ts", Duration: 5, Discontinuity: true},
+		{URL: "https://ads.example.net/ad2.ts", Duration: 10},
+		{URL: "https://cdn.example.com/a3.ts", Duration: 10, Discontinuity: true},
+		{URL: "https://cdn.example.com/a4.ts", Duration: 10},
+		{URL: "https://cdn.example.com/a5.ts", Duration: 10},
+	}}
+}
+
+func TestGroups(t *testing.T) {
+	p := adPlaylist()
+
+	groups := p.Groups()
+	if len(groups) != 3 {
+		t.Fatalf("expected 3 groups, got %d", len(groups))
+	}
+	if len(groups[0]) != 2 || len(groups[1]) != 2 || len(groups[2]) != 3 {
+		t.Errorf("unexpected group sizes: %d, %d, %d", len(groups[0]), len(groups[1]), len(groups[2]))
+	}
+	if !p.HasDiscontinuity() {
+		t.Error("expected HasDiscontinuity=true")
+	}
+}
+
+func TestHasDiscontinuity_LeadingMarker(t *testing.T) {
+	// 第一個片段前的 discontinuity 沒有意義
+	p := &Playlist{Segments: []Segment{{URL: "a.ts", Discontinuity: true}, {URL: "b.ts"}}}
+	if p.HasDiscontinuity() {
+		t.Error("leading discontinuity should be ignored")
+	}
+}
+
+func TestDropAds_ByDuration(t *testing.T) {
+	p := adPlaylist()
+
+	dropped := p.DropAds(AdFilter{MaxDuration: 15})
+	if dropped != 2 {
+		t.Errorf("expected 2 dropped segments, got %d", dropped)
+	}
+	for _, s := range p.Segments {
+		if segmentHost(s) == "ads.example.net" {
+			t.Errorf("ad segment %s should be dropped", s.URL)
+		}
+	}
+	if len(p.Segments) != 5 {
+		t.Errorf("expected 5 remaining segments, got %d", len(p.Segments))
+	}
+}
+
+func TestDropAds_ByHost(t *testing.T) {
+	p := adPlaylist()
+
+	if dropped := p.DropAds(AdFilter{ForeignHost: true}); dropped != 2 {
+		t.Errorf("expected 2 dropped segments, got %d", dropped)
+	}
+}
+
+func TestDropAds_KeepsMainContent(t *testing.T) {
+	p := adPlaylist()
+
+	// 門檻大於所有群組長度時，仍必須保留最長的群組
+	p.DropAds(AdFilter{MaxDuration: 1000})
+	if len(p.Segments) != 3 {
+		t.Errorf("expected main group (3 segments) to remain, got %d", len(p.Segments))
+	}
+}
+
+func TestDropAds_Disabled(t *testing.T) {
+	p := adPlaylist()
+
+	if dropped := p.DropAds(AdFilter{}); dropped != 0 {
+		t.Errorf("expected nothing dropped, got %d", dropped)
+	}
+	if len(p.Segments) != 7 {
+		t.Errorf("expected 7 segments, got %d", len(p.Segments))
+	}
+}
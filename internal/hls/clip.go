@@ -0,0 +1,119 @@
+package hls
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeRange 只下載影片的一段，精確度為片段（通常數秒）
+type TimeRange struct {
+	Start time.Duration // 0 表示從頭開始
+	End   time.Duration // 0 表示到結尾
+}
+
+// Enabled 是否指定了範圍
+func (r TimeRange) Enabled() bool {
+	return r.Start > 0 || r.End > 0
+}
+
+// String 以 START-END 格式回傳範圍，未指定時回傳空字串
+func (r TimeRange) String() string {
+	if !r.Enabled() {
+		return ""
+	}
+	s := ""
+	if r.Start > 0 {
+		s = r.Start.String()
+	}
+	s += "-"
+	if r.End > 0 {
+		s += r.End.String()
+	}
+	return s
+}
+
+// ParseTimeRange 解析 START-END 格式的範圍，兩端可省略其一
+// 時間可為 Go duration（例如 90s、10m30s）、[hh:]mm:ss 或秒數
+func ParseTimeRange(s string) (TimeRange, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return TimeRange{}, nil
+	}
+	start, end, ok := strings.Cut(s, "-")
+	if !ok {
+		return TimeRange{}, fmt.Errorf("無效的時間範圍: %s, 格式為 START-END, 例如 10m-20m 或 1:00:00-", s)
+	}
+
+	var r TimeRange
+	var err error
+	if r.Start, err = parseTimestamp(start); err != nil {
+		return TimeRange{}, fmt.Errorf("無效的開始時間 %q: %v", start, err)
+	}
+	if r.End, err = parseTimestamp(end); err != nil {
+		return TimeRange{}, fmt.Errorf("無效的結束時間 %q: %v", end, err)
+	}
+	if r.End > 0 && r.End <= r.Start {
+		return TimeRange{}, fmt.Errorf("結束時間必須晚於開始時間: %s", s)
+	}
+	return r, nil
+}
+
+// parseTimestamp 解析單一時間點，空字串表示 0
+func parseTimestamp(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	if strings.Contains(s, ":") {
+		parts := strings.Split(s, ":")
+		if len(parts) > 3 {
+			return 0, fmt.Errorf("格式為 [hh:]mm:ss")
+		}
+		var total float64
+		for _, part := range parts {
+			n, err := strconv.ParseFloat(part, 64)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("格式為 [hh:]mm:ss")
+			}
+			total = total*60 + n
+		}
+		return time.Duration(total * float64(time.Second)), nil
+	}
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		if n < 0 {
+			return 0, fmt.Errorf("不可為負數")
+		}
+		return time.Duration(n * float64(time.Second)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("格式為 90s、10m30s、[hh:]mm:ss 或秒數")
+	}
+	return d, nil
+}
+
+// Clip 只保留與範圍重疊的片段，回傳移除的片段數
+// 以 EXTINF 長度計算時間，開頭與結尾的片段會完整保留
+func (p *Playlist) Clip(r TimeRange) int {
+	if !r.Enabled() {
+		return 0
+	}
+
+	start, end := r.Start.Seconds(), r.End.Seconds()
+	var kept []Segment
+	var offset float64
+	for _, seg := range p.Segments {
+		segStart := offset
+		offset += seg.Duration
+		if offset <= start || (end > 0 && segStart >= end) {
+			continue
+		}
+		kept = append(kept, seg)
+	}
+
+	dropped := len(p.Segments) - len(kept)
+	p.Segments = kept
+	return dropped
+}
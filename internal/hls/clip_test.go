@@ -0,0 +1,76 @@
+package hls
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeRange(t *testing.T) {
+	tests := []struct {
+		in    string
+		start time.Duration
+		end   time.Duration
+	}{
+		{"", 0, 0},
+		{"10m-20m", 10 * time.Minute, 20 * time.Minute},
+		{"1:00:00-", time.Hour, 0},
+		{"-90", 0, 90 * time.Second},
+		{"05:30-10:00", 5*time.Minute + 30*time.Second, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		r, err := ParseTimeRange(tt.in)
+		if err != nil {
+			t.Errorf("ParseTimeRange(%q) failed: %v", tt.in, err)
+			continue
+		}
+		if r.Start != tt.start || r.End != tt.end {
+			t.Errorf("ParseTimeRange(%q) = %v-%v, want %v-%v", tt.in, r.Start, r.End, tt.start, tt.end)
+		}
+	}
+
+	for _, in := range []string{"10m", "20m-10m", "abc-", "1:2:3:4-", "-5m-"} {
+		if _, err := ParseTimeRange(in); err == nil {
+			t.Errorf("ParseTimeRange(%q) should fail", in)
+		}
+	}
+}
+
+func TestTimeRangeString(t *testing.T) {
+	r := TimeRange{Start: 90 * time.Second}
+	if got := r.String(); got != "1m30s-" {
+		t.Errorf("expected 1m30s-, got %q", got)
+	}
+	if got := (TimeRange{}).String(); got != "" {
+		t.Errorf("expected empty string, got %q", got)
+	}
+}
+
+func TestClip(t *testing.T) {
+	pl := &Playlist{Segments: []Segment{
+		{URL: "a.ts", Duration: 10},
+		{URL: "b.ts", Duration: 10},
+		{URL: "c.ts", Duration: 10},
+		{URL: "d.ts", Duration: 10},
+	}}
+
+	// 15s-25s 與 b、c 重疊
+	dropped := pl.Clip(TimeRange{Start: 15 * time.Second, End: 25 * time.Second})
+	if dropped != 2 || len(pl.Segments) != 2 || pl.Segments[0].URL != "b.ts" || pl.Segments[1].URL != "c.ts" {
+		t.Errorf("expected [b c], dropped %d, got %+v", dropped, pl.Segments)
+	}
+}
+
+func TestClip_OpenEnded(t *testing.T) {
+	pl := &Playlist{Segments: []Segment{
+		{URL: "a.ts", Duration: 10},
+		{URL: "b.ts", Duration: 10},
+		{URL: "c.ts", Duration: 10},
+	}}
+
+	if dropped := pl.Clip(TimeRange{Start: 10 * time.Second}); dropped != 1 || pl.Segments[0].URL != "b.ts" {
+		t.Errorf("expected to start at b, got %+v", pl.Segments)
+	}
+	if dropped := pl.Clip(TimeRange{}); dropped != 0 {
+		t.Errorf("empty range should keep everything, dropped %d", dropped)
+	}
+}
@@ -0,0 +1,124 @@
+package hls
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// InitFileName EXT-X-MAP 初始化片段（fMP4/CMAF）在本地的檔名
+const InitFileName = "init.mp4"
+
+// Segment 播放清單中的單一片段
+type Segment struct {
+	URL    string `json:"url"`
+	Name   string `json:"name,omitempty"`   // 本地檔名，空白時由 URL 推導
+	Offset int64  `json:"offset,omitempty"` // EXT-X-BYTERANGE 起始位置
+	Length int64  `json:"length,omitempty"` // EXT-X-BYTERANGE 長度，0 表示整個檔案
+
+	Duration      float64 `json:"duration,omitempty"`      // EXTINF 秒數
+	Discontinuity bool    `json:"discontinuity,omitempty"` // EXT-X-DISCONTINUITY，時間戳在此片段重新開始
+}
+
+// IsByteRange 片段是否只是 URL 所指檔案的一段
+func (s Segment) IsByteRange() bool {
+	return s.Length > 0
+}
+
+// RangeHeader 回傳 HTTP Range 標頭值，例如 bytes=0-1023
+func (s Segment) RangeHeader() string {
+	return fmt.Sprintf("bytes=%d-%d", s.Offset, s.Offset+s.Length-1)
+}
+
+// FileName 回傳片段在番號資料夾內的檔名
+func (s Segment) FileName() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return FileNameFromURL(s.URL)
+}
+
+// Playlist 解析後的媒體播放清單
+type Playlist struct {
+	Map      *Segment  `json:"map,omitempty"` // EXT-X-MAP 初始化片段，僅 fMP4/CMAF 串流才有
+	Segments []Segment `json:"segments"`
+	Key      []byte    `json:"-"`
+	IV       []byte    `json:"-"`
+}
+
+// NewPlaylist 以片段 URL 清單建立播放清單
+func NewPlaylist(urls []string) *Playlist {
+	p := &Playlist{Segments: make([]Segment, 0, len(urls))}
+	for _, u := range urls {
+		p.Segments = append(p.Segments, Segment{URL: u})
+	}
+	return p
+}
+
+// URLs 依播放順序回傳所有片段 URL
+func (p *Playlist) URLs() []string {
+	urls := make([]string, 0, len(p.Segments))
+	for _, s := range p.Segments {
+		urls = append(urls, s.URL)
+	}
+	return urls
+}
+
+// HasDiscontinuity 播放清單中是否有 EXT-X-DISCONTINUITY
+func (p *Playlist) HasDiscontinuity() bool {
+	for i, s := range p.Segments {
+		if i > 0 && s.Discontinuity {
+			return true
+		}
+	}
+	return false
+}
+
+// Groups 依 EXT-X-DISCONTINUITY 將片段切成時間戳連續的群組
+func (p *Playlist) Groups() [][]Segment {
+	var groups [][]Segment
+	for i, s := range p.Segments {
+		if i == 0 || s.Discontinuity {
+			groups = append(groups, nil)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], s)
+	}
+	return groups
+}
+
+// Duration 回傳所有片段 EXTINF 秒數的總和
+func (p *Playlist) Duration() float64 {
+	var total float64
+	for _, s := range p.Segments {
+		total += s.Duration
+	}
+	return total
+}
+
+// IsFragmented 是否為 fMP4/CMAF 串流（片段需接在初始化片段之後）
+func (p *Playlist) IsFragmented() bool {
+	return p.Map != nil
+}
+
+// ByteRangeFileName 位元組範圍片段共用同一個 URL，以序號區分本地檔名
+func ByteRangeFileName(rawURL string, index int) string {
+	name := FileNameFromURL(rawURL)
+	ext := path.Ext(name)
+	return fmt.Sprintf("%s_%05d%s", strings.TrimSuffix(name, ext), index, ext)
+}
+
+// FileNameFromURL 由片段 URL 推導本地檔名
+// MPEG-TS 片段沿用 .mp4 副檔名，其他格式（例如 .m4s）保留原檔名
+func FileNameFromURL(rawURL string) string {
+	p := rawURL
+	if u, err := url.Parse(rawURL); err == nil && u.Path != "" {
+		p = u.Path
+	}
+
+	name := path.Base(p)
+	if strings.HasSuffix(name, ".ts") {
+		return strings.TrimSuffix(name, ".ts") + ".mp4"
+	}
+	return name
+}
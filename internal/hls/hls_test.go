@@ -0,0 +1,84 @@
+package hls
+
+import "testing"
+
+func TestFileNameFromURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://cdn.example.com/hls/abc-123/seg1.ts", "seg1.mp4"},
+		{"https://cdn.example.com/hls/abc-123/seg1.ts?token=abc", "seg1.mp4"},
+		{"https://cdn.example.com/hls/abc-123/seg1.m4s", "seg1.m4s"},
+		{"https://cdn.example.com/hls/abc-123/chunk-1.mp4", "chunk-1.mp4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := FileNameFromURL(tt.url); got != tt.want {
+				t.Errorf("FileNameFromURL(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSegmentFileName_ExplicitName(t *testing.T) {
+	s := Segment{URL: "https://cdn.example.com/init-v1.mp4", Name: InitFileName}
+	if s.FileName() != InitFileName {
+		t.Errorf("expected %q, got %q", InitFileName, s.FileName())
+	}
+}
+
+func TestNewPlaylist(t *testing.T) {
+	urls := []string{"https://cdn.example.com/a.ts", "https://cdn.example.com/b.ts"}
+	p := NewPlaylist(urls)
+
+	if p.IsFragmented() {
+		t.Error("playlist without map should not be fragmented")
+	}
+	got := p.URLs()
+	if len(got) != 2 || got[0] != urls[0] || got[1] != urls[1] {
+		t.Errorf("URLs() = %v, want %v", got, urls)
+	}
+}
+
+func TestByteRangeFileName(t *testing.T) {
+	tests := []struct {
+		url   string
+		index int
+		want  string
+	}{
+		{"https://cdn.example.com/video.ts", 0, "video_00000.mp4"},
+		{"https://cdn.example.com/video.ts", 12, "video_00012.mp4"},
+		{"https://cdn.example.com/video.mp4?token=abc", 3, "video_00003.mp4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := ByteRangeFileName(tt.url, tt.index); got != tt.want {
+				t.Errorf("ByteRangeFileName(%q, %d) = %q, want %q", tt.url, tt.index, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSegmentRangeHeader(t *testing.T) {
+	s := Segment{URL: "https://cdn.example.com/video.ts", Offset: 1000, Length: 500}
+	if !s.IsByteRange() {
+		t.Error("expected byte-range segment")
+	}
+	if got := s.RangeHeader(); got != "bytes=1000-1499" {
+		t.Errorf("expected 'bytes=1000-1499', got %q", got)
+	}
+
+	if (Segment{URL: "https://cdn.example.com/seg1.ts"}).IsByteRange() {
+		t.Error("segment without length should not be a byte range")
+	}
+}
+
+func TestPlaylistDuration(t *testing.T) {
+	p := &Playlist{Segments: []Segment{{Duration: 10}, {Duration: 9.5}, {Duration: 0.5}}}
+	if got := p.Duration(); got != 20 {
+		t.Errorf("Duration() = %v, want 20", got)
+	}
+}
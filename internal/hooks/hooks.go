@@ -0,0 +1,185 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Event hook 執行的時間點
+type Event string
+
+const (
+	EventResolved   Event = "after_resolve"  // 取得 m3u8 並解析播放清單之後
+	EventDownloaded Event = "after_download" // 所有片段下載完成之後
+	EventMerged     Event = "after_merge"    // 合成影片之後
+	EventEncoded    Event = "after_encode"   // 轉檔、標籤等後處理之後
+	EventFailed     Event = "on_failure"     // 任何階段失敗時
+)
+
+// Events 支援的時間點
+var Events = []Event{EventResolved, EventDownloaded, EventMerged, EventEncoded, EventFailed}
+
+// SkipExitCode hook 以此結束代碼要求略過後續階段（視為成功）
+const SkipExitCode = 3
+
+// DefaultTimeout hook 未指定 timeout 時的執行時間上限
+const DefaultTimeout = 5 * time.Minute
+
+// ErrSkip hook 要求略過後續階段
+var ErrSkip = errors.New("hook 要求略過後續階段")
+
+// Hook 在指定時間點執行的外部指令
+type Hook struct {
+	Event   Event    `json:"event"`
+	Command []string `json:"command"`           // 指令與參數，例如 ["sh", "-c", "rsync ..."]
+	Timeout string   `json:"timeout,omitempty"` // 例如 30s、10m，預設 5m
+	// IgnoreFailure 為 true 時指令失敗只顯示訊息，不讓任務失敗
+	IgnoreFailure bool `json:"ignore_failure,omitempty"`
+}
+
+// Payload 以 JSON 寫入 hook 的 stdin，並以環境變數提供
+type Payload struct {
+	Event   Event    `json:"event"`
+	TaskID  string   `json:"task_id,omitempty"`
+	Code    string   `json:"code"`
+	Title   string   `json:"title,omitempty"`
+	URL     string   `json:"url"`
+	Status  string   `json:"status"`
+	Folder  string   `json:"folder"`
+	Outputs []string `json:"outputs,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// Env 回傳 hook 的環境變數，例如 JABLE_CODE=abc-123
+func (p Payload) Env() []string {
+	return []string{
+		"JABLE_EVENT=" + string(p.Event),
+		"JABLE_TASK_ID=" + p.TaskID,
+		"JABLE_CODE=" + p.Code,
+		"JABLE_TITLE=" + p.Title,
+		"JABLE_URL=" + p.URL,
+		"JABLE_STATUS=" + p.Status,
+		"JABLE_FOLDER=" + p.Folder,
+		"JABLE_OUTPUTS=" + strings.Join(p.Outputs, string(os.PathListSeparator)),
+		"JABLE_ERROR=" + p.Error,
+	}
+}
+
+func (h Hook) validate() error {
+	valid := false
+	for _, e := range Events {
+		valid = valid || h.Event == e
+	}
+	if !valid {
+		return fmt.Errorf("不支援的 hook 時間點: %s", h.Event)
+	}
+	if len(h.Command) == 0 {
+		return fmt.Errorf("%s hook 缺少 command", h.Event)
+	}
+	if h.Timeout != "" {
+		if d, err := time.ParseDuration(h.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("%s hook 的 timeout 無效: %s", h.Event, h.Timeout)
+		}
+	}
+	return nil
+}
+
+func (h Hook) timeout() time.Duration {
+	if d, err := time.ParseDuration(h.Timeout); err == nil && d > 0 {
+		return d
+	}
+	return DefaultTimeout
+}
+
+// Pipeline 依時間點執行 hook，nil 表示沒有設定任何 hook
+type Pipeline struct {
+	Hooks []Hook `json:"hooks"`
+}
+
+// Load 讀取 hook 設定檔，檔案不存在時回傳 nil
+func Load(path string) (*Pipeline, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("無法讀取 hook 設定檔: %v", err)
+	}
+
+	var p Pipeline
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("無法解析 hook 設定檔: %v", err)
+	}
+	for _, h := range p.Hooks {
+		if err := h.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return &p, nil
+}
+
+// Run 依序執行 event 的所有 hook，ctx 取消時終止執行中的指令並回傳 ctx.Err()
+// 任一 hook 以 SkipExitCode 結束時回傳 ErrSkip；其他失敗回傳錯誤，除非設定 ignore_failure
+func (p *Pipeline) Run(ctx context.Context, event Event, payload Payload) error {
+	if p == nil {
+		return nil
+	}
+
+	payload.Event = event
+	for _, h := range p.Hooks {
+		if h.Event != event {
+			continue
+		}
+
+		err := h.run(ctx, payload)
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case err == nil:
+		case errors.Is(err, ErrSkip):
+			fmt.Printf("hook %s: %v\n", event, err)
+			return err
+		case h.IgnoreFailure:
+			fmt.Printf("hook %s 失敗 (已忽略): %v\n", event, err)
+		default:
+			return fmt.Errorf("hook %s 失敗: %v", event, err)
+		}
+	}
+	return nil
+}
+
+func (h Hook) run(parent context.Context, payload Payload) error {
+	input, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(parent, h.timeout())
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, h.Command[0], h.Command[1:]...)
+	cmd.Env = append(os.Environ(), payload.Env()...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// 終止後子行程可能仍佔用 stdout，不等待其結束
+	cmd.WaitDelay = time.Second
+
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded && parent.Err() == nil {
+		return fmt.Errorf("執行超過 %v", h.timeout())
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == SkipExitCode {
+		return ErrSkip
+	}
+	return err
+}
@@ -0,0 +1,142 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func requireShell(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+}
+
+func TestPipelineRun_PayloadAndEnv(t *testing.T) {
+	requireShell(t)
+	dir := t.TempDir()
+	stdinPath := filepath.Join(dir, "stdin.json")
+	envPath := filepath.Join(dir, "env.txt")
+
+	p := &Pipeline{Hooks: []Hook{{
+		Event:   EventMerged,
+		Command: []string{"sh", "-c", `cat > "$0"; echo "$JABLE_CODE $JABLE_STATUS $JABLE_EVENT" > "$1"`, stdinPath, envPath},
+	}}}
+
+	payload := Payload{TaskID: "task_1", Code: "abc-123", URL: "https://jable.tv/videos/abc-123/", Status: "merged", Outputs: []string{"a.mp4"}}
+	if err := p.Run(context.Background(), EventMerged, payload); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	var got Payload
+	data, _ := os.ReadFile(stdinPath)
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("hook stdin is not JSON: %v", err)
+	}
+	if got.Event != EventMerged || got.Code != "abc-123" || got.TaskID != "task_1" || len(got.Outputs) != 1 {
+		t.Errorf("unexpected payload: %+v", got)
+	}
+
+	env, _ := os.ReadFile(envPath)
+	if strings.TrimSpace(string(env)) != "abc-123 merged after_merge" {
+		t.Errorf("unexpected env: %q", env)
+	}
+}
+
+func TestPipelineRun_OnlyMatchingEvent(t *testing.T) {
+	requireShell(t)
+	p := &Pipeline{Hooks: []Hook{{Event: EventFailed, Command: []string{"sh", "-c", "exit 1"}}}}
+
+	if err := p.Run(context.Background(), EventMerged, Payload{}); err != nil {
+		t.Errorf("hooks for other events should not run, got: %v", err)
+	}
+}
+
+func TestPipelineRun_ExitCodes(t *testing.T) {
+	requireShell(t)
+
+	skip := &Pipeline{Hooks: []Hook{{Event: EventDownloaded, Command: []string{"sh", "-c", "exit 3"}}}}
+	if err := skip.Run(context.Background(), EventDownloaded, Payload{}); !errors.Is(err, ErrSkip) {
+		t.Errorf("expected ErrSkip, got %v", err)
+	}
+
+	fail := &Pipeline{Hooks: []Hook{{Event: EventDownloaded, Command: []string{"sh", "-c", "exit 1"}}}}
+	if err := fail.Run(context.Background(), EventDownloaded, Payload{}); err == nil || errors.Is(err, ErrSkip) {
+		t.Errorf("expected failure, got %v", err)
+	}
+
+	ignored := &Pipeline{Hooks: []Hook{{Event: EventDownloaded, Command: []string{"sh", "-c", "exit 1"}, IgnoreFailure: true}}}
+	if err := ignored.Run(context.Background(), EventDownloaded, Payload{}); err != nil {
+		t.Errorf("ignored failure should not return error, got %v", err)
+	}
+}
+
+func TestPipelineRun_Timeout(t *testing.T) {
+	requireShell(t)
+	p := &Pipeline{Hooks: []Hook{{Event: EventEncoded, Command: []string{"sh", "-c", "exec sleep 5"}, Timeout: "100ms"}}}
+
+	err := p.Run(context.Background(), EventEncoded, Payload{})
+	if err == nil || !strings.Contains(err.Error(), "執行超過") {
+		t.Errorf("expected timeout error, got %v", err)
+	}
+}
+
+func TestPipelineRun_Cancelled(t *testing.T) {
+	requireShell(t)
+	p := &Pipeline{Hooks: []Hook{{Event: EventEncoded, Command: []string{"sh", "-c", "exec sleep 5"}, IgnoreFailure: true}}}
+
+	// 暫停或取消任務時立即終止 hook，不等到 timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := p.Run(ctx, EventEncoded, Payload{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context error even with ignore_failure, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("hook should stop with the context, took %v", elapsed)
+	}
+}
+
+func TestPipelineRun_Nil(t *testing.T) {
+	var p *Pipeline
+	if err := p.Run(context.Background(), EventFailed, Payload{}); err != nil {
+		t.Errorf("nil pipeline should do nothing, got %v", err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	if p, err := Load(filepath.Join(dir, "missing.json")); p != nil || err != nil {
+		t.Errorf("missing file should return nil, got %v, %v", p, err)
+	}
+
+	valid := filepath.Join(dir, "hooks.json")
+	os.WriteFile(valid, []byte(`{"hooks": [{"event": "after_encode", "command": ["rsync", "-a", "."], "timeout": "10m"}]}`), 0644)
+	p, err := Load(valid)
+	if err != nil || len(p.Hooks) != 1 {
+		t.Fatalf("Load failed: %v, %+v", err, p)
+	}
+
+	invalid := []string{
+		`{"hooks": [{"event": "after_upload", "command": ["true"]}]}`,
+		`{"hooks": [{"event": "after_merge"}]}`,
+		`{"hooks": [{"event": "after_merge", "command": ["true"], "timeout": "soon"}]}`,
+		`not json`,
+	}
+	for _, data := range invalid {
+		path := filepath.Join(dir, "invalid.json")
+		os.WriteFile(path, []byte(data), 0644)
+		if _, err := Load(path); err == nil {
+			t.Errorf("expected error for %s", data)
+		}
+	}
+}
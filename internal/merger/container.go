@@ -0,0 +1,70 @@
+package merger
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Container 輸出影片的封裝格式
+type Container string
+
+const (
+	ContainerMP4  Container = "mp4"
+	ContainerMKV  Container = "mkv"
+	ContainerTS   Container = "ts"
+	ContainerFMP4 Container = "fmp4" // fragmented MP4，適合邊下載邊播放或串流
+)
+
+// Containers 支援的封裝格式
+var Containers = []Container{ContainerMP4, ContainerMKV, ContainerTS, ContainerFMP4}
+
+// ParseContainer 解析封裝格式名稱，空字串視為 mp4
+func ParseContainer(name string) (Container, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return ContainerMP4, nil
+	}
+
+	for _, c := range Containers {
+		if string(c) == name {
+			return c, nil
+		}
+	}
+	return "", fmt.Errorf("不支援的封裝格式: %s (可用: mp4, mkv, ts, fmp4)", name)
+}
+
+// Ext 回傳輸出檔的副檔名
+func (c Container) Ext() string {
+	switch c {
+	case ContainerMKV:
+		return ".mkv"
+	case ContainerTS:
+		return ".ts"
+	default:
+		return ".mp4"
+	}
+}
+
+// OutputArgs 回傳 FFmpeg 寫入此封裝格式所需的輸出參數
+func (c Container) OutputArgs() []string {
+	switch c {
+	case ContainerMKV:
+		return []string{"-bsf:a", "aac_adtstoasc", "-f", "matroska"}
+	case ContainerTS:
+		// MPEG-TS 直接使用 ADTS AAC，不需要轉換
+		return []string{"-f", "mpegts"}
+	case ContainerFMP4:
+		// 每個關鍵影格開始一個 fragment，moov 放在開頭且不含樣本
+		return []string{"-bsf:a", "aac_adtstoasc", "-movflags", "+frag_keyframe+empty_moov+default_base_moof"}
+	default:
+		// -bsf:a aac_adtstoasc  將 TS 的 ADTS AAC 轉為 MP4 所需的 ASC 格式
+		// -movflags +faststart  將 moov atom 移到檔案開頭，允許邊下載邊播放
+		return []string{"-bsf:a", "aac_adtstoasc", "-movflags", "+faststart"}
+	}
+}
+
+// OutputPath 回傳番號資料夾內的最終影片路徑，例如 download/abc-123/abc-123.mkv
+func OutputPath(folderPath string, c Container) string {
+	return filepath.Join(folderPath, filepath.Base(folderPath)+c.Ext())
+}
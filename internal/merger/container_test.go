@@ -0,0 +1,67 @@
+package merger
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseContainer(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Container
+		wantErr bool
+	}{
+		{"", ContainerMP4, false},
+		{"mp4", ContainerMP4, false},
+		{"MKV", ContainerMKV, false},
+		{"ts", ContainerTS, false},
+		{" fmp4 ", ContainerFMP4, false},
+		{"avi", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseContainer(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseContainer(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseContainer(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContainerExt(t *testing.T) {
+	tests := map[Container]string{
+		ContainerMP4:  ".mp4",
+		ContainerMKV:  ".mkv",
+		ContainerTS:   ".ts",
+		ContainerFMP4: ".mp4",
+	}
+	for c, want := range tests {
+		if got := c.Ext(); got != want {
+			t.Errorf("%s.Ext() = %q, want %q", c, got, want)
+		}
+	}
+}
+
+func TestContainerOutputArgs(t *testing.T) {
+	if args := strings.Join(ContainerMP4.OutputArgs(), " "); !strings.Contains(args, "+faststart") {
+		t.Errorf("mp4 should use +faststart, got %q", args)
+	}
+	if args := strings.Join(ContainerFMP4.OutputArgs(), " "); !strings.Contains(args, "frag_keyframe") {
+		t.Errorf("fmp4 should write fragments, got %q", args)
+	}
+	if args := strings.Join(ContainerTS.OutputArgs(), " "); strings.Contains(args, "aac_adtstoasc") {
+		t.Errorf("ts should keep ADTS audio, got %q", args)
+	}
+}
+
+func TestOutputPath(t *testing.T) {
+	folder := filepath.Join("download", "abc-123")
+	if got := OutputPath(folder, ContainerMKV); got != filepath.Join(folder, "abc-123.mkv") {
+		t.Errorf("unexpected output path %q", got)
+	}
+}
@@ -0,0 +1,59 @@
+package merger
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jable-downloader-go/internal/hls"
+	"github.com/jable-downloader-go/pkg/utils"
+)
+
+// ManifestFile 片段清單檔名，保存在番號資料夾內供重新合成使用
+const ManifestFile = "segments.json"
+
+// Manifest 記錄合成所需的片段順序，讓合成失敗後可以離線重建影片
+type Manifest struct {
+	URL     string           `json:"url"`
+	M3U8URL string           `json:"m3u8_url"`
+	Info    *utils.VideoInfo `json:"info,omitempty"` // 影片資訊，重新合成時寫入標籤
+	hls.Playlist
+}
+
+// SaveManifest 將片段清單寫入 folderPath/segments.json
+func SaveManifest(folderPath string, m *Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("無法序列化片段清單: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(folderPath, ManifestFile), data, 0644); err != nil {
+		return fmt.Errorf("無法寫入片段清單: %v", err)
+	}
+	return nil
+}
+
+// HasSegments 回傳 folderPath 內是否還有清單中的片段，合成成功後片段會被清理
+func (m *Manifest) HasSegments(folderPath string) bool {
+	for _, seg := range m.Segments {
+		if utils.FileExists(filepath.Join(folderPath, seg.FileName())) {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadManifest 讀取 folderPath/segments.json
+func LoadManifest(folderPath string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(folderPath, ManifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("無法讀取片段清單: %v", err)
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("片段清單格式錯誤: %v", err)
+	}
+	return &m, nil
+}
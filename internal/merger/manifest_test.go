@@ -0,0 +1,80 @@
+package merger
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jable-downloader-go/internal/hls"
+)
+
+func TestManifest_SaveAndLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	m := &Manifest{
+		URL:     "https://jable.tv/videos/abc-123/",
+		M3U8URL: "https://cdn.example.com/hls/abc-123/index.m3u8",
+		Playlist: hls.Playlist{
+			Map: &hls.Segment{URL: "https://cdn.example.com/hls/abc-123/init.mp4", Name: hls.InitFileName},
+			Segments: []hls.Segment{
+				{URL: "https://cdn.example.com/hls/abc-123/seg2.m4s"},
+				{URL: "https://cdn.example.com/hls/abc-123/seg1.m4s"},
+			},
+			Key: []byte("0123456789abcdef"),
+		},
+	}
+
+	if err := SaveManifest(dir, m); err != nil {
+		t.Fatalf("SaveManifest failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ManifestFile)); err != nil {
+		t.Fatalf("manifest file should exist: %v", err)
+	}
+
+	got, err := LoadManifest(dir)
+	if err != nil {
+		t.Fatalf("LoadManifest failed: %v", err)
+	}
+	if got.URL != m.URL || got.M3U8URL != m.M3U8URL {
+		t.Errorf("manifest mismatch: got %+v, want %+v", got, m)
+	}
+	// 片段順序必須保持不變
+	if len(got.Segments) != 2 || got.Segments[0] != m.Segments[0] || got.Segments[1] != m.Segments[1] {
+		t.Errorf("segment order mismatch: got %v, want %v", got.Segments, m.Segments)
+	}
+	if got.Map == nil || *got.Map != *m.Map {
+		t.Errorf("init section mismatch: got %v, want %v", got.Map, m.Map)
+	}
+	// 片段已解密，金鑰不應寫入磁碟
+	if len(got.Key) != 0 {
+		t.Error("AES key should not be persisted")
+	}
+}
+
+func TestLoadManifest_Missing(t *testing.T) {
+	if _, err := LoadManifest(t.TempDir()); err == nil {
+		t.Error("expected error when manifest does not exist")
+	}
+}
+
+func TestLoadManifest_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, ManifestFile), []byte("{not json"), 0644)
+
+	if _, err := LoadManifest(dir); err == nil {
+		t.Error("expected error for invalid manifest")
+	}
+}
+
+func TestManifest_HasSegments(t *testing.T) {
+	dir := t.TempDir()
+	m := &Manifest{Playlist: *hls.NewPlaylist([]string{"https://cdn.example.com/seg1.ts", "https://cdn.example.com/seg2.ts"})}
+
+	if m.HasSegments(dir) {
+		t.Error("expected no segments in an empty folder")
+	}
+	os.WriteFile(filepath.Join(dir, "seg2.mp4"), []byte("data"), 0644)
+	if !m.HasSegments(dir) {
+		t.Error("expected segments after writing seg2.mp4")
+	}
+}
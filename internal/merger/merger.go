@@ -1,29 +1,68 @@
 package merger
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
+
+	"github.com/jable-downloader-go/internal/ffmpeg"
+	"github.com/jable-downloader-go/internal/hls"
 )
 
 func MergeTSFiles(folderPath string, tsList []string) error {
+	return MergePlaylist(folderPath, hls.NewPlaylist(tsList), ContainerMP4)
+}
+
+// MergePlaylist 依播放清單順序合成影片，支援 MPEG-TS 與 fMP4/CMAF 片段
+func MergePlaylist(folderPath string, pl *hls.Playlist, container Container) error {
+	return mergePlaylist(context.Background(), folderPath, pl, container, nil)
+}
+
+func mergePlaylist(ctx context.Context, folderPath string, pl *hls.Playlist, container Container, progress ffmpeg.ProgressFunc) error {
 	startTime := time.Now()
 	fmt.Println("開始合成影片..")
 
+	if err := mergeTo(ctx, folderPath, pl, OutputPath(folderPath, container), container, progress); err != nil {
+		return err
+	}
+
+	elapsed := time.Since(startTime)
+	fmt.Printf("花費 %.2f 秒合成影片\n", elapsed.Seconds())
+	fmt.Println("下載完成!")
+
+	return nil
+}
+
+// mergeTo 依片段格式選擇合成方式，輸出到 outputPath
+// progress 不為 nil 時以播放清單的 EXTINF 總長度回報 FFmpeg 進度，ctx 取消時終止 FFmpeg
+func mergeTo(ctx context.Context, folderPath string, pl *hls.Playlist, outputPath string, container Container, progress ffmpeg.ProgressFunc) error {
+	run := func(args ...string) error {
+		return runFFmpeg(ctx, pl.Duration(), progress, args...)
+	}
+
+	switch {
+	case pl.HasDiscontinuity():
+		return mergeDiscontinuous(folderPath, pl, outputPath, container, run)
+	case pl.IsFragmented():
+		return mergeFragmented(folderPath, pl, outputPath, container, run)
+	default:
+		return mergeTS(folderPath, pl, outputPath, container, run)
+	}
+}
+
+// runFunc 執行 FFmpeg 的函數，由 mergeTo 綁定進度回報
+type runFunc func(args ...string) error
+
+// mergeTS 以 FFmpeg concat demuxer 合成 MPEG-TS 片段
+func mergeTS(folderPath string, pl *hls.Playlist, outputPath string, container Container, run runFunc) error {
 	// 建立 FFmpeg concat 清單檔
 	listPath := filepath.Join(folderPath, "filelist.txt")
 	var lines []string
-	for _, tsURL := range tsList {
-		fileName := filepath.Base(tsURL)
-		fileName = fileName[:len(fileName)-3] + ".mp4"
-		fullPath := filepath.Join(folderPath, fileName)
-		if _, err := os.Stat(fullPath); os.IsNotExist(err) {
-			fmt.Printf("%s 不存在，跳過\n", fileName)
-			continue
-		}
+	for _, fileName := range existingSegments(folderPath, pl.Segments) {
 		// FFmpeg concat 清單路徑相對於 filelist.txt 所在目錄
 		lines = append(lines, fmt.Sprintf("file '%s'", fileName))
 	}
@@ -33,32 +72,150 @@ func MergeTSFiles(folderPath string, tsList []string) error {
 	}
 	defer os.Remove(listPath)
 
-	videoName := filepath.Base(folderPath)
-	outputPath := filepath.Join(folderPath, videoName+".mp4")
-
-	// 使用 FFmpeg concat demuxer 直接合成為瀏覽器可播放的 MP4
+	// 使用 FFmpeg concat demuxer 直接合成為瀏覽器可播放的影片
 	// -c copy      無損重新封裝，速度快
-	// -bsf:a aac_adtstoasc  將 TS 的 ADTS AAC 轉為 MP4 所需的 ASC 格式
-	// -movflags +faststart  將 moov atom 移到檔案開頭，允許邊下載邊播放
-	cmd := exec.Command("ffmpeg",
+	args := []string{
 		"-f", "concat",
 		"-safe", "0",
 		"-i", listPath,
 		"-c", "copy",
-		"-bsf:a", "aac_adtstoasc",
-		"-movflags", "+faststart",
-		outputPath,
-	)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("FFmpeg 合成失敗: %v", err)
 	}
+	args = append(args, container.OutputArgs()...)
+	return run(append(args, outputPath)...)
+}
 
-	elapsed := time.Since(startTime)
-	fmt.Printf("花費 %.2f 秒合成影片\n", elapsed.Seconds())
-	fmt.Println("下載完成!")
+// mergeFragmented 合成 fMP4/CMAF 片段
+// 各片段只有 moof/mdat，必須接在初始化片段之後才是完整的 fragmented MP4，
+// 因此先以二進位串接，再由 FFmpeg 重新封裝為一般 MP4
+func mergeFragmented(folderPath string, pl *hls.Playlist, outputPath string, container Container, run runFunc) error {
+	if err := checkInit(folderPath, pl); err != nil {
+		return err
+	}
+
+	concatPath := filepath.Join(folderPath, "fmp4_concat.mp4")
+	defer os.Remove(concatPath)
+
+	files := append([]string{pl.Map.FileName()}, existingSegments(folderPath, pl.Segments)...)
+	if err := concatFiles(concatPath, folderPath, files); err != nil {
+		return err
+	}
+
+	args := append([]string{"-i", concatPath, "-c", "copy"}, container.OutputArgs()...)
+	return run(append(args, outputPath)...)
+}
+
+// mergeDiscontinuous 合成含有 EXT-X-DISCONTINUITY 的播放清單
+// 時間戳在 discontinuity 處重新開始，直接串接會造成音畫不同步或無法拖曳，
+// 因此先把每個時間戳連續的群組串成一個檔案，再由 concat demuxer 依群組長度
+// 重新計算偏移並產生時間戳
+func mergeDiscontinuous(folderPath string, pl *hls.Playlist, outputPath string, container Container, run runFunc) error {
+	ext := ".ts"
+	if pl.IsFragmented() {
+		if err := checkInit(folderPath, pl); err != nil {
+			return err
+		}
+		ext = ".mp4"
+	}
+
+	var lines []string
+	for i, group := range pl.Groups() {
+		files := existingSegments(folderPath, group)
+		if len(files) == 0 {
+			continue
+		}
+		if pl.IsFragmented() {
+			files = append([]string{pl.Map.FileName()}, files...)
+		}
 
+		groupName := fmt.Sprintf("group_%03d%s", i, ext)
+		groupPath := filepath.Join(folderPath, groupName)
+		defer os.Remove(groupPath)
+
+		if err := concatFiles(groupPath, folderPath, files); err != nil {
+			return err
+		}
+		lines = append(lines, fmt.Sprintf("file '%s'", groupName))
+	}
+
+	listPath := filepath.Join(folderPath, "filelist.txt")
+	if err := os.WriteFile(listPath, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		return fmt.Errorf("無法建立 filelist.txt: %v", err)
+	}
+	defer os.Remove(listPath)
+
+	// -fflags +genpts               重新產生缺少或重置的 PTS
+	// -avoid_negative_ts make_zero  讓輸出時間戳從 0 開始，避免拖曳異常
+	args := []string{
+		"-f", "concat",
+		"-safe", "0",
+		"-fflags", "+genpts",
+		"-i", listPath,
+		"-c", "copy",
+		"-avoid_negative_ts", "make_zero",
+	}
+	args = append(args, container.OutputArgs()...)
+	return run(append(args, outputPath)...)
+}
+
+func checkInit(folderPath string, pl *hls.Playlist) error {
+	initPath := filepath.Join(folderPath, pl.Map.FileName())
+	if _, err := os.Stat(initPath); err != nil {
+		return fmt.Errorf("找不到初始化片段 %s: %v", pl.Map.FileName(), err)
+	}
+	return nil
+}
+
+// concatFiles 依序以二進位串接 folderPath 內的檔案到 dstPath
+func concatFiles(dstPath, folderPath string, files []string) error {
+	out, err := os.Create(dstPath)
+	if err != nil {
+		return fmt.Errorf("無法建立串接檔: %v", err)
+	}
+
+	for _, fileName := range files {
+		if err := appendFile(out, filepath.Join(folderPath, fileName)); err != nil {
+			out.Close()
+			return fmt.Errorf("串接 %s 失敗: %v", fileName, err)
+		}
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("無法寫入串接檔: %v", err)
+	}
+	return nil
+}
+
+// existingSegments 依順序回傳已下載的片段檔名，缺少的片段會被跳過
+func existingSegments(folderPath string, segments []hls.Segment) []string {
+	var names []string
+	for _, seg := range segments {
+		fileName := seg.FileName()
+		fullPath := filepath.Join(folderPath, fileName)
+		if _, err := os.Stat(fullPath); os.IsNotExist(err) {
+			fmt.Printf("%s 不存在，跳過\n", fileName)
+			continue
+		}
+		names = append(names, fileName)
+	}
+	return names
+}
+
+func appendFile(dst io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(dst, f)
+	return err
+}
+
+func runFFmpeg(ctx context.Context, duration float64, progress ffmpeg.ProgressFunc, args ...string) error {
+	if err := ffmpeg.RunContext(ctx, args, duration, progress); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("FFmpeg 合成失敗: %v", err)
+	}
 	return nil
 }
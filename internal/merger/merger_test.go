@@ -5,6 +5,8 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/jable-downloader-go/internal/hls"
 )
 
 func TestMergeTSFiles_FileListCreation(t *testing.T) {
@@ -183,3 +185,111 @@ func TestMergeTSFiles_WithValidMP4(t *testing.T) {
 		t.Error("output file should exist after successful merge")
 	}
 }
+
+func TestMergePlaylist_FragmentedMissingInit(t *testing.T) {
+	dir := t.TempDir()
+	videoDir := filepath.Join(dir, "cmaf-001")
+	os.MkdirAll(videoDir, 0755)
+	os.WriteFile(filepath.Join(videoDir, "seg1.m4s"), []byte("moof"), 0644)
+
+	pl := &hls.Playlist{
+		Map:      &hls.Segment{URL: "https://cdn.example.com/init.mp4", Name: hls.InitFileName},
+		Segments: []hls.Segment{{URL: "https://cdn.example.com/seg1.m4s"}},
+	}
+
+	err := MergePlaylist(videoDir, pl, ContainerMP4)
+	if err == nil {
+		t.Fatal("expected error when init section is missing")
+	}
+	if !strings.Contains(err.Error(), "初始化片段") {
+		t.Errorf("expected init section error, got: %v", err)
+	}
+}
+
+func TestMergePlaylist_FragmentedConcat(t *testing.T) {
+	dir := t.TempDir()
+	videoDir := filepath.Join(dir, "cmaf-002")
+	os.MkdirAll(videoDir, 0755)
+
+	os.WriteFile(filepath.Join(videoDir, hls.InitFileName), []byte("init"), 0644)
+	os.WriteFile(filepath.Join(videoDir, "seg1.m4s"), []byte("seg1"), 0644)
+	os.WriteFile(filepath.Join(videoDir, "seg2.m4s"), []byte("seg2"), 0644)
+
+	pl := &hls.Playlist{
+		Map: &hls.Segment{URL: "https://cdn.example.com/init.mp4", Name: hls.InitFileName},
+		Segments: []hls.Segment{
+			{URL: "https://cdn.example.com/seg1.m4s"},
+			{URL: "https://cdn.example.com/seg2.m4s"},
+		},
+	}
+
+	err := MergePlaylist(videoDir, pl, ContainerMP4)
+	if err == nil {
+		t.Log("FFmpeg succeeded unexpectedly (fragments were not valid MP4)")
+		return
+	}
+	if !strings.Contains(err.Error(), "FFmpeg") {
+		t.Errorf("expected FFmpeg-related error, got: %v", err)
+	}
+
+	// 暫存的串接檔必須清除，片段保留供重試
+	if _, statErr := os.Stat(filepath.Join(videoDir, "fmp4_concat.mp4")); statErr == nil {
+		t.Error("temporary concat file should be removed")
+	}
+	if _, statErr := os.Stat(filepath.Join(videoDir, "seg1.m4s")); statErr != nil {
+		t.Error("segment files should not be deleted")
+	}
+}
+
+func TestMergePlaylist_DiscontinuityGroups(t *testing.T) {
+	dir := t.TempDir()
+	videoDir := filepath.Join(dir, "disc-001")
+	os.MkdirAll(videoDir, 0755)
+
+	for _, name := range []string{"a1.mp4", "a2.mp4", "b1.mp4"} {
+		os.WriteFile(filepath.Join(videoDir, name), []byte(name), 0644)
+	}
+
+	pl := &hls.Playlist{Segments: []hls.Segment{
+		{URL: "https://cdn.example.com/a1.ts"},
+		{URL: "https://cdn.example.com/a2.ts"},
+		{URL: "https://cdn.example.com/b1.ts", Discontinuity: true},
+	}}
+
+	err := MergePlaylist(videoDir, pl, ContainerMP4)
+	if err == nil {
+		t.Log("FFmpeg succeeded unexpectedly (segments were not valid TS)")
+		return
+	}
+	if !strings.Contains(err.Error(), "FFmpeg") {
+		t.Errorf("expected FFmpeg-related error, got: %v", err)
+	}
+
+	// 群組暫存檔與清單必須清除，原始片段保留
+	for _, name := range []string{"group_000.ts", "group_001.ts", "filelist.txt"} {
+		if _, statErr := os.Stat(filepath.Join(videoDir, name)); statErr == nil {
+			t.Errorf("temporary file %s should be removed", name)
+		}
+	}
+	for _, name := range []string{"a1.mp4", "a2.mp4", "b1.mp4"} {
+		if _, statErr := os.Stat(filepath.Join(videoDir, name)); statErr != nil {
+			t.Errorf("segment %s should not be deleted", name)
+		}
+	}
+}
+
+func TestConcatFiles_Order(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a"), []byte("AAA"), 0644)
+	os.WriteFile(filepath.Join(dir, "b"), []byte("BBB"), 0644)
+
+	dst := filepath.Join(dir, "out")
+	if err := concatFiles(dst, dir, []string{"b", "a"}); err != nil {
+		t.Fatalf("concatFiles failed: %v", err)
+	}
+
+	got, _ := os.ReadFile(dst)
+	if string(got) != "BBBAAA" {
+		t.Errorf("expected 'BBBAAA', got %q", got)
+	}
+}
@@ -0,0 +1,141 @@
+package merger
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jable-downloader-go/internal/ffmpeg"
+	"github.com/jable-downloader-go/internal/hls"
+)
+
+// SplitOptions 依大小或長度將輸出切成多個檔案，切點一律在片段邊界
+type SplitOptions struct {
+	MaxSize     int64   // 每個分段的最大位元組數，0 表示不限制
+	MaxDuration float64 // 每個分段的最大秒數，0 表示不限制
+}
+
+// Enabled 是否需要分段輸出
+func (o SplitOptions) Enabled() bool {
+	return o.MaxSize > 0 || o.MaxDuration > 0
+}
+
+// PartPath 回傳第 n 個分段的路徑，例如 download/abc-123/abc-123-part1.mp4
+func PartPath(folderPath string, c Container, n int) string {
+	return filepath.Join(folderPath, fmt.Sprintf("%s-part%d%s", filepath.Base(folderPath), n, c.Ext()))
+}
+
+// ExistingOutputs 回傳資料夾內已合成的影片（單一檔案或所有分段），依分段順序排列
+func ExistingOutputs(folderPath string, c Container) []string {
+	var outputs []string
+	if _, err := os.Stat(OutputPath(folderPath, c)); err == nil {
+		outputs = append(outputs, OutputPath(folderPath, c))
+	}
+
+	for n := 1; ; n++ {
+		partPath := PartPath(folderPath, c, n)
+		if _, err := os.Stat(partPath); err != nil {
+			break
+		}
+		outputs = append(outputs, partPath)
+	}
+	return outputs
+}
+
+// SplitPlaylist 依已下載片段的大小與 EXTINF 長度切分播放清單
+// 單一片段超過限制時自成一段；fMP4 的初始化片段會複製到每個分段
+func SplitPlaylist(folderPath string, pl *hls.Playlist, opts SplitOptions) []*hls.Playlist {
+	if !opts.Enabled() {
+		return []*hls.Playlist{pl}
+	}
+
+	var parts []*hls.Playlist
+	current := &hls.Playlist{Map: pl.Map}
+	var size int64
+	var duration float64
+
+	for _, seg := range pl.Segments {
+		segSize := int64(0)
+		if info, err := os.Stat(filepath.Join(folderPath, seg.FileName())); err == nil {
+			segSize = info.Size()
+		}
+
+		overSize := opts.MaxSize > 0 && size+segSize > opts.MaxSize
+		overDuration := opts.MaxDuration > 0 && duration+seg.Duration > opts.MaxDuration
+		if len(current.Segments) > 0 && (overSize || overDuration) {
+			parts = append(parts, current)
+			current = &hls.Playlist{Map: pl.Map}
+			size, duration = 0, 0
+		}
+
+		current.Segments = append(current.Segments, seg)
+		size += segSize
+		duration += seg.Duration
+	}
+
+	if len(current.Segments) > 0 || len(parts) == 0 {
+		parts = append(parts, current)
+	}
+	return parts
+}
+
+// MergeParts 合成影片，啟用分段時輸出 <番號>-partN，回傳所有輸出檔路徑
+// progress 不為 nil 時回報每個輸出檔的 FFmpeg 進度
+func MergeParts(folderPath string, pl *hls.Playlist, container Container, opts SplitOptions, progress ffmpeg.ProgressFunc) ([]string, error) {
+	return MergePartsContext(context.Background(), folderPath, pl, container, opts, progress)
+}
+
+// MergePartsContext 與 MergeParts 相同，ctx 取消時終止 FFmpeg 並回傳 ctx.Err()
+func MergePartsContext(ctx context.Context, folderPath string, pl *hls.Playlist, container Container, opts SplitOptions, progress ffmpeg.ProgressFunc) ([]string, error) {
+	if !opts.Enabled() {
+		if err := mergePlaylist(ctx, folderPath, pl, container, progress); err != nil {
+			return nil, err
+		}
+		return []string{OutputPath(folderPath, container)}, nil
+	}
+
+	startTime := time.Now()
+	parts := SplitPlaylist(folderPath, pl, opts)
+	fmt.Printf("開始合成影片.. (分為 %d 個分段)\n", len(parts))
+
+	var outputs []string
+	for i, part := range parts {
+		outputPath := PartPath(folderPath, container, i+1)
+		if err := mergeTo(ctx, folderPath, part, outputPath, container, progress); err != nil {
+			if ctx.Err() != nil {
+				return outputs, ctx.Err()
+			}
+			return outputs, fmt.Errorf("分段 %d: %v", i+1, err)
+		}
+		outputs = append(outputs, outputPath)
+	}
+
+	elapsed := time.Since(startTime)
+	fmt.Printf("花費 %.2f 秒合成影片\n", elapsed.Seconds())
+	fmt.Println("下載完成!")
+
+	return outputs, nil
+}
+
+// RemoveOutputs 刪除上次合成留下的輸出檔（單一檔案與所有分段）
+func RemoveOutputs(folderPath string, c Container) error {
+	matches, _ := filepath.Glob(filepath.Join(folderPath, filepath.Base(folderPath)+"-part*"+c.Ext()))
+	var paths []string
+	for _, path := range matches {
+		// 只移除 -partN 本身，不動到 -partN-preview.mp4 等衍生檔案
+		n := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), filepath.Base(folderPath)+"-part"), c.Ext())
+		if _, err := strconv.Atoi(n); err == nil {
+			paths = append(paths, path)
+		}
+	}
+	for _, path := range append(paths, OutputPath(folderPath, c)) {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("無法移除舊的輸出檔案: %v", err)
+		}
+	}
+	return nil
+}
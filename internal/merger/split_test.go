@@ -0,0 +1,131 @@
+package merger
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jable-downloader-go/internal/hls"
+)
+
+// writeSegments 建立指定大小的片段檔案並回傳播放清單
+func writeSegments(t *testing.T, dir string, sizes []int, duration float64) *hls.Playlist {
+	t.Helper()
+	pl := &hls.Playlist{}
+	for i, size := range sizes {
+		seg := hls.Segment{URL: "https://cdn.example.com/seg" + string(rune('a'+i)) + ".ts", Duration: duration}
+		if err := os.WriteFile(filepath.Join(dir, seg.FileName()), make([]byte, size), 0644); err != nil {
+			t.Fatalf("failed to create segment: %v", err)
+		}
+		pl.Segments = append(pl.Segments, seg)
+	}
+	return pl
+}
+
+func partSizes(parts []*hls.Playlist) []int {
+	var sizes []int
+	for _, p := range parts {
+		sizes = append(sizes, len(p.Segments))
+	}
+	return sizes
+}
+
+func TestSplitPlaylist_Disabled(t *testing.T) {
+	dir := t.TempDir()
+	pl := writeSegments(t, dir, []int{10, 10, 10}, 10)
+
+	parts := SplitPlaylist(dir, pl, SplitOptions{})
+	if len(parts) != 1 || len(parts[0].Segments) != 3 {
+		t.Errorf("expected a single part with all segments, got %v", partSizes(parts))
+	}
+}
+
+func TestSplitPlaylist_BySize(t *testing.T) {
+	dir := t.TempDir()
+	pl := writeSegments(t, dir, []int{40, 40, 40, 40, 100, 10}, 10)
+
+	parts := SplitPlaylist(dir, pl, SplitOptions{MaxSize: 90})
+
+	// 40+40 | 40+40 | 100（單一片段超過限制自成一段）| 10
+	want := []int{2, 2, 1, 1}
+	got := partSizes(parts)
+	if len(got) != len(want) {
+		t.Fatalf("expected parts %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("expected parts %v, got %v", want, got)
+			break
+		}
+	}
+}
+
+func TestSplitPlaylist_ByDuration(t *testing.T) {
+	dir := t.TempDir()
+	pl := writeSegments(t, dir, []int{1, 1, 1, 1, 1}, 10)
+
+	parts := SplitPlaylist(dir, pl, SplitOptions{MaxDuration: 20})
+
+	if got := partSizes(parts); len(got) != 3 || got[0] != 2 || got[1] != 2 || got[2] != 1 {
+		t.Errorf("expected parts [2 2 1], got %v", got)
+	}
+}
+
+func TestSplitPlaylist_KeepsInitSection(t *testing.T) {
+	dir := t.TempDir()
+	pl := writeSegments(t, dir, []int{1, 1}, 10)
+	pl.Map = &hls.Segment{URL: "https://cdn.example.com/init.mp4", Name: hls.InitFileName}
+
+	for i, part := range SplitPlaylist(dir, pl, SplitOptions{MaxDuration: 10}) {
+		if part.Map != pl.Map {
+			t.Errorf("part %d should keep the init section", i+1)
+		}
+	}
+}
+
+func TestPartPathAndExistingOutputs(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "abc-123")
+	os.MkdirAll(dir, 0755)
+
+	if got := PartPath(dir, ContainerMKV, 2); got != filepath.Join(dir, "abc-123-part2.mkv") {
+		t.Errorf("unexpected part path %q", got)
+	}
+
+	os.WriteFile(PartPath(dir, ContainerMP4, 1), []byte("1"), 0644)
+	os.WriteFile(PartPath(dir, ContainerMP4, 2), []byte("2"), 0644)
+
+	outputs := ExistingOutputs(dir, ContainerMP4)
+	if len(outputs) != 2 || outputs[0] != PartPath(dir, ContainerMP4, 1) {
+		t.Errorf("unexpected outputs %v", outputs)
+	}
+
+	if err := RemoveOutputs(dir, ContainerMP4); err != nil {
+		t.Fatalf("RemoveOutputs failed: %v", err)
+	}
+	if outputs := ExistingOutputs(dir, ContainerMP4); len(outputs) != 0 {
+		t.Errorf("expected no outputs after RemoveOutputs, got %v", outputs)
+	}
+}
+
+func TestRemoveOutputs_KeepsDerivedFiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "abc-123")
+	os.MkdirAll(dir, 0755)
+	for _, name := range []string{"abc-123.mp4", "abc-123-part1.mp4", "abc-123-part1-preview.mp4", "abc-123-preview.mp4"} {
+		os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644)
+	}
+
+	if err := RemoveOutputs(dir, ContainerMP4); err != nil {
+		t.Fatalf("RemoveOutputs failed: %v", err)
+	}
+
+	for _, name := range []string{"abc-123.mp4", "abc-123-part1.mp4"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s should be removed", name)
+		}
+	}
+	for _, name := range []string{"abc-123-part1-preview.mp4", "abc-123-preview.mp4"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s should be kept", name)
+		}
+	}
+}
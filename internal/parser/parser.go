@@ -1,16 +1,68 @@
 package parser
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jable-downloader-go/internal/config"
+	"github.com/jable-downloader-go/internal/downloader"
+	"github.com/jable-downloader-go/internal/encoder"
+	"github.com/jable-downloader-go/internal/hls"
+	"github.com/jable-downloader-go/internal/hooks"
+	"github.com/jable-downloader-go/internal/merger"
+	"github.com/jable-downloader-go/pkg/utils"
 )
 
+// CommandMerge 以既有片段重新合成影片的子指令
+const CommandMerge = "merge"
+
 type Args struct {
 	URL     string
 	Random  bool
 	AllURLs string
 	Server  bool
 	Port    int
+	Command string // 子指令，例如 merge
+	Folder  string // merge 子指令的番號資料夾
+
+	Workers     int    // 服務器模式同時處理的任務數
+	Connections int    // 服務器模式所有任務共用的片段連線數上限
+	TasksFile   string // 服務器模式的任務記錄檔，空字串表示不保存
+	MaxQueue    int    // 服務器模式排隊中任務數上限，0 表示不限制
+
+	Host           string // 服務器模式的監聽位址
+	Token          string // 服務器模式的 API token，空字串表示不檢查
+	AllowedOrigins string // 服務器模式允許的 CORS 來源，以逗號分隔
+
+	DropAdsDuration float64 // 移除總長度不超過此秒數的 discontinuity 群組
+	DropAdsHost     bool    // 移除主機與正片不同的 discontinuity 群組
+	Container       string  // 輸出封裝格式: mp4, mkv, ts, fmp4
+
+	Quality    string // 主播放清單的畫質: best, worst 或最高解析度，例如 720p
+	OutputDir  string // 下載資料夾，空字串表示預設的 download
+	Range      string // 只下載一段，例如 10:00-20:00
+	NoCover    bool   // 不下載封面
+	NoMetadata bool   // 不寫入標題、演員等標籤
+
+	SplitSize     string        // 每個分段的最大大小，例如 3900M
+	SplitDuration time.Duration // 每個分段的最大長度，例如 30m
+
+	Profile      string // 轉檔設定名稱，例如 fast、gpu、cpu 或設定檔中的自訂名稱
+	ProfilesFile string // 自訂轉檔設定檔路徑
+
+	Sheet     bool   // 產生縮圖總覽
+	SheetGrid string // 縮圖排列，例如 4x4
+	Preview   string // 預覽短片格式: webp, mp4
+
+	Loudnorm       bool    // EBU R128 響度正規化
+	LoudnormTarget float64 // 整合響度目標 (LUFS)
+
+	HooksFile string // hook 設定檔路徑
 }
 
 func ParseArgs() *Args {
@@ -21,21 +73,174 @@ func ParseArgs() *Args {
 	flag.StringVar(&args.AllURLs, "all-urls", "", "Jable URL contains multiple videos")
 	flag.BoolVar(&args.Server, "server", false, "Start HTTP API server mode")
 	flag.IntVar(&args.Port, "port", 18080, "HTTP API server port (default: 18080)")
+	flag.IntVar(&args.Workers, "workers", config.ServerWorkers, "Number of tasks the server processes at the same time")
+	flag.IntVar(&args.Connections, "connections", config.MaxWorkers, "Total segment connections shared by all server tasks")
+	flag.StringVar(&args.Host, "host", config.ServerHost, "HTTP API server bind address, use 0.0.0.0 to accept LAN connections")
+	flag.StringVar(&args.Token, "token", os.Getenv(config.TokenEnv), "API token required as 'Authorization: Bearer <token>' (default: $"+config.TokenEnv+")")
+	flag.StringVar(&args.AllowedOrigins, "allowed-origins", config.AllowedOrigins, "Comma-separated CORS origins, e.g. chrome-extension://<id>; a trailing * matches any origin with that prefix")
+	flag.IntVar(&args.MaxQueue, "max-queue", config.MaxQueue, "Maximum queued server tasks; new downloads get HTTP 429 when full, 0 for unlimited")
+	flag.StringVar(&args.TasksFile, "tasks-file", config.TasksFile, "Server task log; unfinished tasks are resumed on restart, empty keeps tasks in memory only")
+	flag.Float64Var(&args.DropAdsDuration, "drop-ads-duration", 0, "Drop discontinuity groups no longer than N seconds (ads)")
+	flag.BoolVar(&args.DropAdsHost, "drop-ads-host", false, "Drop discontinuity groups served from a different host (ads)")
+	flag.StringVar(&args.Container, "container", config.DefaultContainer, "Output container: mp4, mkv, ts, fmp4")
+	flag.StringVar(&args.Quality, "quality", "best", "Variant to download from a master playlist: best, worst or a maximum height such as 720p")
+	flag.StringVar(&args.OutputDir, "output-dir", config.DownloadDir, "Directory for downloaded videos")
+	flag.StringVar(&args.Range, "range", "", "Only download part of the video, e.g. 10:00-20:00, 90s-5m or 30:00- to the end")
+	flag.BoolVar(&args.NoCover, "no-cover", false, "Do not download or embed the cover image")
+	flag.BoolVar(&args.NoMetadata, "no-metadata", false, "Do not write title, actress and tag metadata")
+	flag.StringVar(&args.SplitSize, "split-size", "", "Split output into parts no larger than this size, e.g. 3900M for FAT32")
+	flag.DurationVar(&args.SplitDuration, "split-duration", 0, "Split output into parts no longer than this duration, e.g. 30m")
+	flag.StringVar(&args.Profile, "profile", "", "Encoder profile name: fast, gpu, cpu or a custom profile from the profiles file")
+	flag.StringVar(&args.ProfilesFile, "profiles-file", config.ProfilesFile, "JSON file with custom encoder profiles")
+	flag.BoolVar(&args.Sheet, "sheet", false, "Generate a <code>-sheet.jpg contact sheet after merging")
+	flag.StringVar(&args.SheetGrid, "sheet-grid", "4x4", "Contact sheet grid as COLUMNSxROWS")
+	flag.StringVar(&args.Preview, "preview", "", "Generate a short animated preview: webp, mp4")
+	flag.BoolVar(&args.Loudnorm, "loudnorm", false, "Normalize audio loudness (EBU R128, two-pass), video stream is copied")
+	flag.StringVar(&args.HooksFile, "hooks-file", config.HooksFile, "JSON file with commands to run after resolve/download/merge/encode and on failure")
+	flag.Float64Var(&args.LoudnormTarget, "loudnorm-target", encoder.DefaultLoudnessTarget, "Integrated loudness target in LUFS for --loudnorm")
 	
 	flag.Parse()
 	
+	// 子指令: merge <folder>
+	if flag.Arg(0) == CommandMerge {
+		args.Command = CommandMerge
+		args.Folder = flag.Arg(1)
+	}
+	
 	return args
 }
 
 func (a *Args) Validate() error {
+	if a.Command == CommandMerge && a.Folder == "" {
+		return errors.New("merge 指令需要指定番號資料夾, 例如: merge download/abc-123")
+	}
+	if _, err := merger.ParseContainer(a.Container); err != nil {
+		return err
+	}
+	if _, err := downloader.ParseQuality(a.Quality); err != nil {
+		return err
+	}
+	if _, err := a.TimeRange(); err != nil {
+		return err
+	}
+	if _, err := a.SplitOptions(); err != nil {
+		return err
+	}
+	if _, err := a.PreviewOptions(); err != nil {
+		return err
+	}
+	if a.LoudnormTarget > 0 {
+		return errors.New("--loudnorm-target 必須小於 0 LUFS")
+	}
+	if a.Workers < 0 || a.Connections < 0 {
+		return errors.New("--workers 與 --connections 不可為負數")
+	}
+	if a.MaxQueue < 0 {
+		return errors.New("--max-queue 不可為負數")
+	}
+	if a.Host != "" && net.ParseIP(a.Host) == nil && a.Host != "localhost" {
+		return fmt.Errorf("無效的 --host: %s", a.Host)
+	}
+	if a.DropAdsDuration < 0 {
+		return errors.New("--drop-ads-duration 不可為負數")
+	}
 	if a.URL == "" && !a.Random && a.AllURLs == "" {
 		return nil // 互動模式
 	}
 	return nil
 }
 
+// Origins 將 --allowed-origins 拆成清單，空字串表示不允許任何跨來源請求
+func (a *Args) Origins() []string {
+	origins := []string{}
+	for _, origin := range strings.Split(a.AllowedOrigins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// TimeRange 解析 --range，未指定時回傳不裁切的區間
+func (a *Args) TimeRange() (hls.TimeRange, error) {
+	r, err := hls.ParseTimeRange(a.Range)
+	if err != nil {
+		return r, fmt.Errorf("--range: %v", err)
+	}
+	return r, nil
+}
+
+// SplitOptions 將 --split-size 與 --split-duration 轉為分段設定
+func (a *Args) SplitOptions() (merger.SplitOptions, error) {
+	var opts merger.SplitOptions
+	if a.SplitSize != "" {
+		size, err := utils.ParseSize(a.SplitSize)
+		if err != nil {
+			return opts, fmt.Errorf("--split-size: %v", err)
+		}
+		opts.MaxSize = size
+	}
+	if a.SplitDuration < 0 {
+		return opts, errors.New("--split-duration 不可為負數")
+	}
+	opts.MaxDuration = a.SplitDuration.Seconds()
+	return opts, nil
+}
+
+// PreviewOptions 將 --sheet、--sheet-grid 與 --preview 轉為預覽設定
+func (a *Args) PreviewOptions() (encoder.PreviewOptions, error) {
+	var opts encoder.PreviewOptions
+	format, err := encoder.ParsePreviewFormat(a.Preview)
+	if err != nil {
+		return opts, err
+	}
+	opts.Preview = format
+	
+	if a.Sheet {
+		opts.Sheet = true
+		if a.SheetGrid != "" {
+			if opts.Columns, opts.Rows, err = encoder.ParseGrid(a.SheetGrid); err != nil {
+				return opts, err
+			}
+		}
+	}
+	return opts, nil
+}
+
+// LoudnessOptions 將 --loudnorm 與 --loudnorm-target 轉為響度正規化設定
+func (a *Args) LoudnessOptions() encoder.LoudnessOptions {
+	return encoder.LoudnessOptions{Enabled: a.Loudnorm, Target: a.LoudnormTarget}
+}
+
+// Load 載入 --profiles-file 的自訂轉檔設定並讀取 --hooks-file
+// CLI 與服務器模式都需在 Validate 之後、開始下載或啟動服務器之前呼叫，
+// API 請求指定的自訂轉檔設定也依賴這裡註冊的設定
+func (a *Args) Load() (*hooks.Pipeline, error) {
+	if a.ProfilesFile != "" {
+		if err := encoder.LoadProfiles(a.ProfilesFile); err != nil {
+			return nil, err
+		}
+	}
+	if a.Profile != "" {
+		if err := encoder.CheckProfileRequirements(a.Profile); err != nil {
+			return nil, err
+		}
+	}
+	return a.LoadHooks()
+}
+
+// LoadHooks 讀取 --hooks-file，未指定或檔案不存在時回傳 nil
+func (a *Args) LoadHooks() (*hooks.Pipeline, error) {
+	if a.HooksFile == "" {
+		return nil, nil
+	}
+	return hooks.Load(a.HooksFile)
+}
+
 func PrintUsage() {
 	fmt.Println("Jable TV Downloader - Go Version")
 	fmt.Println("\n使用方式:")
 	flag.PrintDefaults()
+	fmt.Println("\n子指令:")
+	fmt.Println("  merge <folder>\t以資料夾內已下載的片段重新合成影片（不需要網路）")
 }
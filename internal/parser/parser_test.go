@@ -3,7 +3,12 @@ package parser
 import (
 	"flag"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/jable-downloader-go/internal/config"
+	"github.com/jable-downloader-go/internal/encoder"
 )
 
 // resetFlags 重置 flag 狀態，避免測試間互相影響
@@ -33,6 +38,9 @@ func TestParseArgs_Defaults(t *testing.T) {
 	if args.Port != 18080 {
 		t.Errorf("expected Port=18080, got %d", args.Port)
 	}
+	if args.Container != "mp4" {
+		t.Errorf("expected Container=mp4, got %q", args.Container)
+	}
 }
 
 func TestParseArgs_URL(t *testing.T) {
@@ -165,3 +173,296 @@ func TestPrintUsage(t *testing.T) {
 	resetFlags(t)
 	PrintUsage()
 }
+
+func TestParseArgs_MergeCommand(t *testing.T) {
+	resetFlags(t)
+	os.Args = []string{"jable-downloader", "merge", "download/abc-123"}
+
+	args := ParseArgs()
+
+	if args.Command != CommandMerge {
+		t.Errorf("expected Command=%q, got %q", CommandMerge, args.Command)
+	}
+	if args.Folder != "download/abc-123" {
+		t.Errorf("expected Folder 'download/abc-123', got %q", args.Folder)
+	}
+	if err := args.Validate(); err != nil {
+		t.Errorf("Validate() unexpected error: %v", err)
+	}
+}
+
+func TestParseArgs_MergeCommandMissingFolder(t *testing.T) {
+	resetFlags(t)
+	os.Args = []string{"jable-downloader", "merge"}
+
+	args := ParseArgs()
+
+	if args.Command != CommandMerge {
+		t.Errorf("expected Command=%q, got %q", CommandMerge, args.Command)
+	}
+	if err := args.Validate(); err == nil {
+		t.Error("expected error when merge folder is missing")
+	}
+}
+
+func TestParseArgs_DropAds(t *testing.T) {
+	resetFlags(t)
+	os.Args = []string{"jable-downloader", "--url", "https://jable.tv/videos/abc/", "--drop-ads-duration", "30", "--drop-ads-host"}
+
+	args := ParseArgs()
+
+	if args.DropAdsDuration != 30 {
+		t.Errorf("expected DropAdsDuration=30, got %v", args.DropAdsDuration)
+	}
+	if !args.DropAdsHost {
+		t.Error("expected DropAdsHost=true")
+	}
+
+	args.DropAdsDuration = -1
+	if err := args.Validate(); err == nil {
+		t.Error("expected error for negative --drop-ads-duration")
+	}
+}
+
+func TestParseArgs_Container(t *testing.T) {
+	resetFlags(t)
+	os.Args = []string{"jable-downloader", "--container", "mkv"}
+
+	args := ParseArgs()
+
+	if args.Container != "mkv" {
+		t.Errorf("expected Container=mkv, got %q", args.Container)
+	}
+	if err := args.Validate(); err != nil {
+		t.Errorf("Validate() unexpected error: %v", err)
+	}
+
+	args.Container = "avi"
+	if err := args.Validate(); err == nil {
+		t.Error("expected error for unsupported container")
+	}
+}
+
+func TestParseArgs_Split(t *testing.T) {
+	resetFlags(t)
+	os.Args = []string{"jable-downloader", "--split-size", "3900M", "--split-duration", "30m"}
+
+	args := ParseArgs()
+
+	opts, err := args.SplitOptions()
+	if err != nil {
+		t.Fatalf("SplitOptions failed: %v", err)
+	}
+	if opts.MaxSize != 3900<<20 {
+		t.Errorf("expected MaxSize=%d, got %d", int64(3900<<20), opts.MaxSize)
+	}
+	if opts.MaxDuration != 1800 {
+		t.Errorf("expected MaxDuration=1800, got %v", opts.MaxDuration)
+	}
+
+	args.SplitSize = "huge"
+	if err := args.Validate(); err == nil {
+		t.Error("expected error for invalid --split-size")
+	}
+}
+
+func TestParseArgs_Profile(t *testing.T) {
+	resetFlags(t)
+	os.Args = []string{"jable-downloader", "--profile", "gpu", "--profiles-file", filepath.Join(t.TempDir(), "missing.json")}
+
+	args := ParseArgs()
+
+	if args.Profile != "gpu" {
+		t.Errorf("expected Profile=gpu, got %q", args.Profile)
+	}
+	if err := args.Validate(); err != nil {
+		t.Errorf("Validate() unexpected error: %v", err)
+	}
+	if _, err := args.Load(); err != nil {
+		t.Errorf("Load() unexpected error: %v", err)
+	}
+
+	args.Profile = "no-such-profile"
+	if _, err := args.Load(); err == nil {
+		t.Error("expected error for unknown profile")
+	}
+}
+
+func TestLoad_CustomProfile(t *testing.T) {
+	dir := t.TempDir()
+	profiles := filepath.Join(dir, "profiles.json")
+	data := `{"profiles":[{"name":"parser-custom","video_codec":"libx264","crf":23}]}`
+	if err := os.WriteFile(profiles, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	args := &Args{Profile: "parser-custom", ProfilesFile: profiles, HooksFile: filepath.Join(dir, "hooks.json")}
+
+	// Validate 不讀取設定檔，自訂設定在 Load 之後才能使用
+	if err := args.Validate(); err != nil {
+		t.Fatalf("Validate() unexpected error: %v", err)
+	}
+	if _, err := encoder.GetProfile("parser-custom"); err == nil {
+		t.Fatal("expected Validate not to register custom profiles")
+	}
+
+	pipeline, err := args.Load()
+	if err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if pipeline != nil {
+		t.Errorf("expected no hooks for a missing hooks file, got %+v", pipeline)
+	}
+	if _, err := encoder.GetProfile("parser-custom"); err != nil {
+		t.Errorf("expected custom profile after Load: %v", err)
+	}
+}
+
+func TestParseArgs_Preview(t *testing.T) {
+	resetFlags(t)
+	os.Args = []string{"jable-downloader", "--sheet", "--sheet-grid", "5x3", "--preview", "webp"}
+
+	args := ParseArgs()
+
+	opts, err := args.PreviewOptions()
+	if err != nil {
+		t.Fatalf("PreviewOptions failed: %v", err)
+	}
+	if !opts.Sheet || opts.Columns != 5 || opts.Rows != 3 || opts.Preview != "webp" {
+		t.Errorf("unexpected preview options: %+v", opts)
+	}
+
+	args.Preview = "gif"
+	if err := args.Validate(); err == nil {
+		t.Error("expected error for unsupported preview format")
+	}
+}
+
+func TestParseArgs_Loudnorm(t *testing.T) {
+	resetFlags(t)
+	os.Args = []string{"jable-downloader", "--loudnorm", "--loudnorm-target", "-16"}
+
+	args := ParseArgs()
+
+	opts := args.LoudnessOptions()
+	if !opts.Enabled || opts.Target != -16 {
+		t.Errorf("unexpected loudness options: %+v", opts)
+	}
+
+	args.LoudnormTarget = 3
+	if err := args.Validate(); err == nil {
+		t.Error("expected error for positive loudness target")
+	}
+}
+
+func TestParseArgs_Workers(t *testing.T) {
+	resetFlags(t)
+	os.Args = []string{"jable-downloader", "--server", "--workers", "3", "--connections", "16"}
+
+	args := ParseArgs()
+
+	if args.Workers != 3 || args.Connections != 16 {
+		t.Errorf("expected Workers=3 Connections=16, got %d %d", args.Workers, args.Connections)
+	}
+
+	args.Workers = -1
+	if err := args.Validate(); err == nil {
+		t.Error("expected error for negative --workers")
+	}
+}
+
+func TestParseArgs_MaxQueue(t *testing.T) {
+	resetFlags(t)
+	os.Args = []string{"jable-downloader", "--server"}
+
+	if args := ParseArgs(); args.MaxQueue != config.MaxQueue {
+		t.Errorf("expected default MaxQueue %d, got %d", config.MaxQueue, args.MaxQueue)
+	}
+
+	resetFlags(t)
+	os.Args = []string{"jable-downloader", "--server", "--max-queue", "0"}
+
+	args := ParseArgs()
+	if args.MaxQueue != 0 {
+		t.Errorf("expected MaxQueue=0, got %d", args.MaxQueue)
+	}
+	args.MaxQueue = -1
+	if err := args.Validate(); err == nil {
+		t.Error("expected error for negative --max-queue")
+	}
+}
+
+func TestParseArgs_ServerSecurity(t *testing.T) {
+	resetFlags(t)
+	t.Setenv(config.TokenEnv, "from-env")
+	os.Args = []string{"jable-downloader", "--server"}
+
+	args := ParseArgs()
+
+	if args.Host != config.ServerHost {
+		t.Errorf("expected default Host %s, got %s", config.ServerHost, args.Host)
+	}
+	if args.Token != "from-env" {
+		t.Errorf("expected Token from $%s, got %q", config.TokenEnv, args.Token)
+	}
+
+	resetFlags(t)
+	os.Args = []string{"jable-downloader", "--server", "--host", "0.0.0.0", "--token", "secret",
+		"--allowed-origins", "chrome-extension://abc, http://localhost:3000,"}
+
+	args = ParseArgs()
+
+	if args.Host != "0.0.0.0" || args.Token != "secret" {
+		t.Errorf("expected Host=0.0.0.0 Token=secret, got %s %s", args.Host, args.Token)
+	}
+	origins := args.Origins()
+	if len(origins) != 2 || origins[0] != "chrome-extension://abc" || origins[1] != "http://localhost:3000" {
+		t.Errorf("unexpected origins: %v", origins)
+	}
+
+	args.Host = "not a host"
+	if err := args.Validate(); err == nil {
+		t.Error("expected error for invalid --host")
+	}
+}
+
+func TestParseArgs_DownloadOptions(t *testing.T) {
+	resetFlags(t)
+	os.Args = []string{"jable-downloader"}
+
+	args := ParseArgs()
+
+	if args.Quality != "best" || args.OutputDir != config.DownloadDir || args.NoCover || args.NoMetadata {
+		t.Errorf("unexpected defaults: %+v", args)
+	}
+	if r, err := args.TimeRange(); err != nil || r.Enabled() {
+		t.Errorf("expected no range by default, got %v, %v", r, err)
+	}
+
+	resetFlags(t)
+	os.Args = []string{"jable-downloader", "--quality", "720p", "--output-dir", "library",
+		"--range", "10:00-20:00", "--no-cover", "--no-metadata"}
+
+	args = ParseArgs()
+
+	if args.Quality != "720p" || args.OutputDir != "library" || !args.NoCover || !args.NoMetadata {
+		t.Errorf("unexpected options: %+v", args)
+	}
+	r, err := args.TimeRange()
+	if err != nil || r.Start != 10*time.Minute || r.End != 20*time.Minute {
+		t.Errorf("expected 10m-20m, got %v, %v", r, err)
+	}
+	if err := args.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	for _, invalid := range []func(*Args){
+		func(a *Args) { a.Quality = "hd" },
+		func(a *Args) { a.Range = "20:00-10:00" },
+	} {
+		bad := *args
+		invalid(&bad)
+		if err := bad.Validate(); err == nil {
+			t.Errorf("expected validation error for %+v", bad)
+		}
+	}
+}
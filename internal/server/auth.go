@@ -0,0 +1,95 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// originAllowed 檢查 Origin 是否在允許清單中
+// 清單項目為完整的來源，例如 chrome-extension://abcdefghijklmnop，
+// 或以 * 結尾表示該 scheme 的所有來源，例如 chrome-extension://*
+func originAllowed(origin string, allowed []string) bool {
+	for _, pattern := range allowed {
+		pattern = strings.TrimSuffix(strings.TrimSpace(pattern), "/")
+		if pattern == "" {
+			continue
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(origin, prefix) && len(origin) > len(prefix) {
+				return true
+			}
+			continue
+		}
+		if strings.EqualFold(origin, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestToken 取得請求攜帶的 API token
+// EventSource 無法設定 header，因此也接受 ?token= 參數
+func requestToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if token, ok := strings.CutPrefix(auth, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+		return ""
+	}
+	return r.URL.Query().Get("token")
+}
+
+// authorized 比對請求的 token，未設定 token 時不檢查
+func (s *Server) authorized(r *http.Request) bool {
+	if s.token == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(requestToken(r)), []byte(s.token)) == 1
+}
+
+// cors 處理 CORS 標頭並拒絕不在允許清單中的來源
+// 沒有 Origin 的請求（例如 curl、命令列工具）不受限制，只檢查 token
+func (s *Server) cors(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		if origin := r.Header.Get("Origin"); origin != "" {
+			if !originAllowed(origin, s.allowedOrigins) {
+				s.sendError(w, "Origin not allowed", http.StatusForbidden)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Last-Event-ID")
+		}
+
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// requireToken 要求請求攜帶正確的 API token
+func (s *Server) requireToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.authorized(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="jable-downloader"`)
+			s.sendError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// isLoopback 判斷監聽位址是否只接受本機連線
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOriginAllowed(t *testing.T) {
+	allowed := []string{"chrome-extension://abc123", "http://localhost:3000/", "moz-extension://*"}
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"chrome-extension://abc123", true},
+		{"chrome-extension://other", false},
+		{"http://localhost:3000", true},
+		{"moz-extension://anything", true},
+		{"moz-extension://", false},
+		{"https://evil.example", false},
+		{"null", false},
+	}
+	for _, tt := range tests {
+		if got := originAllowed(tt.origin, allowed); got != tt.want {
+			t.Errorf("originAllowed(%q) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestCORS_RejectsOrigin(t *testing.T) {
+	s := newTestServer()
+
+	body := `{"url":"https://jable.tv/videos/evil/"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/download", strings.NewReader(body))
+	req.Header.Set("Origin", "https://evil.example")
+	w := httptest.NewRecorder()
+	s.mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for disallowed origin, got %d", w.Code)
+	}
+	if origin := w.Header().Get("Access-Control-Allow-Origin"); origin != "" {
+		t.Errorf("expected no Access-Control-Allow-Origin, got %q", origin)
+	}
+	if len(s.tasks) != 0 {
+		t.Errorf("expected no task to be created, got %d", len(s.tasks))
+	}
+}
+
+func TestRequireToken(t *testing.T) {
+	s := newTestServer()
+	s.token = "secret"
+
+	tests := []struct {
+		name   string
+		path   string
+		header string
+		want   int
+	}{
+		{"missing", "/api/tasks", "", http.StatusUnauthorized},
+		{"wrong", "/api/tasks", "Bearer nope", http.StatusUnauthorized},
+		{"not bearer", "/api/tasks", "Basic secret", http.StatusUnauthorized},
+		{"bearer", "/api/tasks", "Bearer secret", http.StatusOK},
+		{"query", "/api/tasks?token=secret", "", http.StatusOK},
+		{"health is public", "/api/health", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			s.mux.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+}
+
+func TestRequireToken_Preflight(t *testing.T) {
+	s := newTestServer()
+	s.token = "secret"
+
+	// 瀏覽器的 preflight 不會攜帶 Authorization
+	req := httptest.NewRequest(http.MethodOptions, "/api/download", nil)
+	req.Header.Set("Origin", "chrome-extension://abc123")
+	w := httptest.NewRecorder()
+	s.mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200 for preflight without token, got %d", w.Code)
+	}
+}
+
+func TestIsLoopback(t *testing.T) {
+	for host, want := range map[string]bool{
+		"127.0.0.1":   true,
+		"::1":         true,
+		"localhost":   true,
+		"0.0.0.0":     false,
+		"":            false,
+		"192.168.1.2": false,
+	} {
+		if got := isLoopback(host); got != want {
+			t.Errorf("isLoopback(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
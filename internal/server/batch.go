@@ -0,0 +1,300 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jable-downloader-go/internal/downloader"
+)
+
+// 批次的整體狀態
+const (
+	BatchExpanding = "expanding" // 正在展開列表頁
+	BatchRunning   = "running"   // 有排隊中或處理中的任務
+	BatchPaused    = "paused"    // 未結束的任務都已暫停
+	BatchCompleted = "completed" // 所有任務都已完成
+	BatchFailed    = "failed"    // 所有任務都已結束，但有失敗或取消的任務
+	BatchSkipped   = "skipped"   // 沒有建立任務，所有網址都已跳過（已下載、無效或隊列已滿）
+)
+
+// BatchRequest 批次下載請求
+// urls 為影片網址清單，url 為演員、標籤或搜尋等列表頁（由服務器展開），兩者擇一
+// 其他欄位與 DownloadRequest 相同，套用到每個子任務
+type BatchRequest struct {
+	DownloadRequest
+	URLs []string `json:"urls,omitempty"`
+}
+
+// Batch 一次批次下載建立的子任務
+type Batch struct {
+	ID        string      `json:"id"`
+	Page      string      `json:"page,omitempty"` // 展開的列表頁
+	CreatedAt time.Time   `json:"created_at"`
+	Expanding bool        `json:"expanding,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	TaskIDs   []string    `json:"task_ids"`
+	Skipped   []BatchSkip `json:"skipped,omitempty"`
+}
+
+// BatchSkip 未建立任務的網址與原因，例如已下載、無效網址或隊列已滿
+type BatchSkip struct {
+	URL    string `json:"url"`
+	Reason string `json:"reason"`
+}
+
+// BatchStatus 批次與子任務的彙總狀態
+type BatchStatus struct {
+	Batch
+	Status string             `json:"status"`
+	Total  int                `json:"total"`
+	Counts map[TaskStatus]int `json:"counts"`
+	Tasks  []DownloadTask     `json:"tasks"`
+}
+
+// BatchResponse 建立批次的響應
+type BatchResponse struct {
+	Success bool         `json:"success"`
+	Message string       `json:"message"`
+	Batch   *BatchStatus `json:"batch,omitempty"`
+}
+
+// keep 回傳批次是否需要保留：展開中、從未建立任務（保留 skipped 與 error 供查詢），或還有任務存在於 tasks 中
+func (b *Batch) keep(tasks map[string]*DownloadTask) bool {
+	if b.Expanding || len(b.TaskIDs) == 0 {
+		return true
+	}
+	for _, id := range b.TaskIDs {
+		if _, ok := tasks[id]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// handleBatch 建立批次，網址清單立即建立子任務，列表頁在背景展開後建立
+func (s *Server) handleBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case req.URL == "" && len(req.URLs) == 0:
+		s.sendError(w, "url or urls is required", http.StatusBadRequest)
+		return
+	case req.URL != "" && len(req.URLs) > 0:
+		s.sendError(w, "Specify either url or urls, not both", http.StatusBadRequest)
+		return
+	}
+
+	if err := req.validate(); err != nil {
+		s.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.tasksMutex.Lock()
+	batch := &Batch{
+		ID:        s.newBatchID(),
+		Page:      req.URL,
+		CreatedAt: time.Now(),
+		Expanding: req.URL != "",
+		TaskIDs:   []string{},
+	}
+	s.batches[batch.ID] = batch
+	s.persistBatch(batch)
+	s.tasksMutex.Unlock()
+
+	code := http.StatusOK
+	message := "Batch created"
+	if batch.Expanding {
+		go s.expandBatch(batch, req.DownloadRequest)
+		code = http.StatusAccepted
+		message = "Expanding listing page"
+	} else {
+		s.addBatchTasks(batch, req.DownloadRequest, req.URLs)
+	}
+
+	s.tasksMutex.RLock()
+	status := s.batchStatus(batch)
+	s.tasksMutex.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(BatchResponse{Success: true, Message: message, Batch: status})
+	log.Printf("Batch %s created: %d task(s), %d skipped", batch.ID, len(status.TaskIDs), len(status.Skipped))
+}
+
+// handleBatchStatus GET /api/batch/{id} 取得批次的彙總狀態
+func (s *Server) handleBatchStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.tasksMutex.RLock()
+	batch, ok := s.batches[r.PathValue("id")]
+	var status *BatchStatus
+	if ok {
+		status = s.batchStatus(batch)
+	}
+	s.tasksMutex.RUnlock()
+
+	if !ok {
+		s.sendError(w, "Batch not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// expandBatch 以 GetMovieLinks 展開列表頁並建立子任務
+func (s *Server) expandBatch(batch *Batch, req DownloadRequest) {
+	links, err := s.expandPage(batch.Page)
+	if err == nil && len(links) == 0 {
+		err = fmt.Errorf("no videos found")
+	}
+	if err != nil {
+		log.Printf("Failed to expand batch %s (%s): %v", batch.ID, batch.Page, err)
+		s.tasksMutex.Lock()
+		batch.Expanding = false
+		batch.Error = fmt.Sprintf("Failed to expand listing page: %v", err)
+		s.persistBatch(batch)
+		s.tasksMutex.Unlock()
+		return
+	}
+
+	// 列表頁中的相對連結以列表頁為基準
+	if base, err := url.Parse(batch.Page); err == nil {
+		for i, link := range links {
+			if ref, err := url.Parse(link); err == nil {
+				links[i] = base.ResolveReference(ref).String()
+			}
+		}
+	}
+	added, skipped := s.addBatchTasks(batch, req, links)
+	log.Printf("Batch %s expanded %s: %d task(s), %d skipped", batch.ID, batch.Page, added, skipped)
+}
+
+// addBatchTasks 為每個網址建立子任務，同一番號只處理一次
+// 已有未結束任務的影片沿用該任務，已下載、無效或隊列已滿的網址記錄在 Skipped
+func (s *Server) addBatchTasks(batch *Batch, req DownloadRequest, urls []string) (int, int) {
+	var taskIDs []string
+	var skipped []BatchSkip
+	seen := make(map[string]bool)
+	for _, u := range urls {
+		u = strings.TrimSpace(u)
+		code, err := downloader.VideoCode(u)
+		if err == nil {
+			code = strings.ToLower(code)
+			if seen[code] {
+				continue
+			}
+			seen[code] = true
+		}
+
+		child := req
+		child.URL = u
+		resp, _ := s.submit(child, batch.ID)
+		if resp.TaskID != "" {
+			taskIDs = append(taskIDs, resp.TaskID)
+		} else {
+			skipped = append(skipped, BatchSkip{URL: u, Reason: resp.Message})
+		}
+	}
+
+	s.tasksMutex.Lock()
+	defer s.tasksMutex.Unlock()
+	batch.TaskIDs = append(batch.TaskIDs, taskIDs...)
+	batch.Skipped = append(batch.Skipped, skipped...)
+	batch.Expanding = false
+	s.persistBatch(batch)
+	return len(taskIDs), len(skipped)
+}
+
+// batchStatus 彙總批次中仍存在的任務，呼叫者需持有 tasksMutex
+func (s *Server) batchStatus(batch *Batch) *BatchStatus {
+	status := &BatchStatus{
+		Batch:  *batch,
+		Counts: make(map[TaskStatus]int),
+		Tasks:  []DownloadTask{},
+	}
+	status.TaskIDs = append([]string{}, batch.TaskIDs...)
+	status.Skipped = append([]BatchSkip(nil), batch.Skipped...)
+
+	for _, id := range batch.TaskIDs {
+		if task, ok := s.tasks[id]; ok {
+			status.Tasks = append(status.Tasks, *task)
+			status.Counts[task.Status]++
+		}
+	}
+	status.Total = len(status.Tasks)
+
+	c := status.Counts
+	switch {
+	case batch.Expanding:
+		status.Status = BatchExpanding
+	case c[StatusQueued]+c[StatusDownloading] > 0:
+		status.Status = BatchRunning
+	case c[StatusPaused] > 0:
+		status.Status = BatchPaused
+	case c[StatusFailed]+c[StatusCancelled] > 0 || (status.Total == 0 && batch.Error != ""):
+		status.Status = BatchFailed
+	case len(batch.TaskIDs) == 0 && len(batch.Skipped) > 0:
+		status.Status = BatchSkipped
+	default:
+		status.Status = BatchCompleted
+	}
+	return status
+}
+
+// restoreBatches 載入記錄檔中的批次，展開到一半中斷的批次標記為失敗
+func (s *Server) restoreBatches(batches []*Batch) {
+	s.tasksMutex.Lock()
+	defer s.tasksMutex.Unlock()
+
+	for _, batch := range batches {
+		if batch.Expanding {
+			batch.Expanding = false
+			batch.Error = "Interrupted before the listing page was expanded"
+			s.persistBatch(batch)
+		}
+		s.batches[batch.ID] = batch
+	}
+}
+
+// pruneBatches 移除任務都已刪除的批次，呼叫者需持有 tasksMutex
+func (s *Server) pruneBatches() {
+	for id, batch := range s.batches {
+		if !batch.keep(s.tasks) {
+			delete(s.batches, id)
+		}
+	}
+}
+
+// persistBatch 寫入批次的最新狀態，呼叫者需持有 tasksMutex
+func (s *Server) persistBatch(batch *Batch) {
+	if err := s.store.PutBatch(batch); err != nil {
+		log.Printf("Failed to save batch %s: %v", batch.ID, err)
+	}
+}
+
+// newBatchID 產生不重複的批次 ID，呼叫者需持有 tasksMutex
+func (s *Server) newBatchID() string {
+	for n := time.Now().UnixNano(); ; n++ {
+		id := fmt.Sprintf("batch_%d", n)
+		if _, ok := s.batches[id]; !ok {
+			return id
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func postBatch(s *Server, body string) (*httptest.ResponseRecorder, BatchResponse) {
+	req := httptest.NewRequest(http.MethodPost, "/api/batch", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	s.mux.ServeHTTP(w, req)
+
+	var resp BatchResponse
+	json.NewDecoder(strings.NewReader(w.Body.String())).Decode(&resp)
+	return w, resp
+}
+
+func getBatch(t *testing.T, s *Server, id string) BatchStatus {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/batch/"+id, nil)
+	w := httptest.NewRecorder()
+	s.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var status BatchStatus
+	json.NewDecoder(w.Body).Decode(&status)
+	return status
+}
+
+func TestBatch_URLs(t *testing.T) {
+	s := newTestServer()
+
+	w, resp := postBatch(s, `{"urls":[
+		"https://jable.tv/videos/abc-001/",
+		"https://jable.tv/videos/ABC-001",
+		"https://jable.tv/videos/abc-002/",
+		"not-a-url"
+	],"container":"mkv"}`)
+	if w.Code != http.StatusOK || !resp.Success {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	batch := resp.Batch
+	if batch.Status != BatchRunning || batch.Total != 2 || batch.Counts[StatusQueued] != 2 {
+		t.Errorf("expected 2 queued tasks, got %+v", batch)
+	}
+	if len(batch.Skipped) != 1 || batch.Skipped[0].URL != "not-a-url" {
+		t.Errorf("expected invalid URL to be skipped, got %+v", batch.Skipped)
+	}
+	for _, task := range batch.Tasks {
+		if task.BatchID != batch.ID || task.Container != "mkv" {
+			t.Errorf("child task should carry batch ID and options, got %+v", task)
+		}
+	}
+	if s.queue.Len() != 2 {
+		t.Errorf("expected 2 queued tasks, got %d", s.queue.Len())
+	}
+
+	// 彙總狀態
+	s.tasks[batch.TaskIDs[0]].Status = StatusCompleted
+	if status := getBatch(t, s, batch.ID); status.Status != BatchRunning {
+		t.Errorf("expected running, got %s", status.Status)
+	}
+	s.tasks[batch.TaskIDs[1]].Status = StatusCompleted
+	if status := getBatch(t, s, batch.ID); status.Status != BatchCompleted || status.Counts[StatusCompleted] != 2 {
+		t.Errorf("expected completed, got %+v", status)
+	}
+	s.tasks[batch.TaskIDs[1]].Status = StatusFailed
+	if status := getBatch(t, s, batch.ID); status.Status != BatchFailed {
+		t.Errorf("expected failed, got %s", status.Status)
+	}
+}
+
+func TestBatch_ReusesExistingTask(t *testing.T) {
+	s := newTestServer()
+	s.tasks["running"] = &DownloadTask{ID: "running", URL: "https://jable.tv/videos/abc-001/", Status: StatusDownloading}
+
+	_, resp := postBatch(s, `{"urls":["https://jable.tv/videos/abc-001/"]}`)
+
+	if len(resp.Batch.TaskIDs) != 1 || resp.Batch.TaskIDs[0] != "running" {
+		t.Errorf("expected batch to reuse the running task, got %v", resp.Batch.TaskIDs)
+	}
+	if len(s.tasks) != 1 {
+		t.Errorf("expected no new task, got %d", len(s.tasks))
+	}
+}
+
+func TestBatch_ListingPage(t *testing.T) {
+	s := newTestServer()
+	s.expandPage = func(url string) ([]string, error) {
+		if url != "https://jable.tv/models/someone/" {
+			t.Errorf("unexpected page %s", url)
+		}
+		return []string{"https://jable.tv/videos/abc-001/", "/videos/abc-002/"}, nil
+	}
+
+	w, resp := postBatch(s, `{"url":"https://jable.tv/models/someone/"}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var status BatchStatus
+	deadline := time.Now().Add(time.Second)
+	for {
+		status = getBatch(t, s, resp.Batch.ID)
+		if status.Status != BatchExpanding || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if status.Total != 2 || status.Page != "https://jable.tv/models/someone/" {
+		t.Fatalf("expected 2 tasks from the listing page, got %+v", status)
+	}
+	if status.Tasks[1].URL != "https://jable.tv/videos/abc-002/" {
+		t.Errorf("relative link should be resolved, got %s", status.Tasks[1].URL)
+	}
+}
+
+func TestBatch_ListingPageFailed(t *testing.T) {
+	s := newTestServer()
+	s.expandPage = func(string) ([]string, error) { return nil, errors.New("timeout") }
+
+	_, resp := postBatch(s, `{"url":"https://jable.tv/tags/x/"}`)
+
+	var status BatchStatus
+	deadline := time.Now().Add(time.Second)
+	for {
+		status = getBatch(t, s, resp.Batch.ID)
+		if status.Status != BatchExpanding || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if status.Status != BatchFailed || !strings.Contains(status.Error, "timeout") {
+		t.Errorf("expected failed batch with error, got %+v", status)
+	}
+}
+
+func TestBatch_Invalid(t *testing.T) {
+	s := newTestServer()
+
+	for _, body := range []string{
+		`{}`,
+		`{"url":"https://jable.tv/tags/x/","urls":["https://jable.tv/videos/a/"]}`,
+		`{"urls":["https://jable.tv/videos/a/"],"container":"avi"}`,
+		`not json`,
+	} {
+		if w, _ := postBatch(s, body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, w.Code)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/batch/nope", nil)
+	w := httptest.NewRecorder()
+	s.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown batch, got %d", w.Code)
+	}
+}
+
+func TestPruneBatches(t *testing.T) {
+	s := newTestServer()
+	_, resp := postBatch(s, `{"urls":["https://jable.tv/videos/abc-001/"]}`)
+	id := resp.Batch.TaskIDs[0]
+
+	if err := s.deleteTask(id); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.batches) != 0 {
+		t.Errorf("batch without tasks should be removed, got %d", len(s.batches))
+	}
+}
+
+func TestBatch_AllSkipped(t *testing.T) {
+	t.Chdir(t.TempDir())
+	folder := filepath.Join("download", "have-001")
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(folder, "have-001.mp4"), []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer()
+
+	_, resp := postBatch(s, `{"urls":["https://jable.tv/videos/have-001/","not-a-url"]}`)
+	batch := resp.Batch
+	if batch.Status != BatchSkipped || batch.Total != 0 || len(batch.Skipped) != 2 {
+		t.Fatalf("expected skipped batch with 2 skipped URLs, got %+v", batch)
+	}
+	if !strings.Contains(batch.Skipped[0].Reason, "already downloaded") {
+		t.Errorf("expected already downloaded reason, got %+v", batch.Skipped[0])
+	}
+
+	// 刪除其他任務時保留只有 skipped 的批次
+	_, other := postBatch(s, `{"urls":["https://jable.tv/videos/abc-001/"]}`)
+	if err := s.deleteTask(other.Batch.TaskIDs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if status := getBatch(t, s, batch.ID); len(status.Skipped) != 2 {
+		t.Errorf("expected skipped list to be kept, got %+v", status)
+	}
+	if _, ok := s.batches[other.Batch.ID]; ok {
+		t.Error("batch whose tasks were deleted should be removed")
+	}
+}
+
+func TestRestoreBatches(t *testing.T) {
+	s := newTestServer()
+	s.restoreBatches([]*Batch{{ID: "b", Page: "https://jable.tv/tags/x/", Expanding: true}})
+
+	status := getBatch(t, s, "b")
+	if status.Status != BatchFailed || status.Error == "" {
+		t.Errorf("interrupted expansion should be marked failed, got %+v", status)
+	}
+}
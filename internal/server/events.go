@@ -0,0 +1,247 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventType 任務事件類型
+type EventType string
+
+const (
+	EventCreated  EventType = "created"  // 新增任務
+	EventStatus   EventType = "status"   // 狀態改變，例如開始處理、暫停、重新排隊
+	EventFinished EventType = "finished" // 完成、失敗或取消
+	EventDeleted  EventType = "deleted"  // 刪除任務
+	EventProgress EventType = "progress" // 處理階段與進度，不保留在歷史記錄中
+	EventResync   EventType = "resync"   // Last-Event-ID 已超出歷史記錄，客戶端需重新取得 /api/tasks
+)
+
+const (
+	eventHistorySize  = 1000                   // 保留供 Last-Event-ID 續傳的事件數
+	eventBufferSize   = 64                     // 每個訂閱者的緩衝，塞滿時中斷連線讓客戶端重新連線
+	progressInterval  = 250 * time.Millisecond // 同一任務同一階段的進度事件最短間隔
+	keepAliveInterval = 15 * time.Second       // SSE 心跳間隔，避免代理伺服器中斷閒置連線
+)
+
+// Event 任務事件，Task 為事件發生時的任務快照
+type Event struct {
+	ID     uint64        `json:"id,omitempty"`
+	Type   EventType     `json:"type"`
+	TaskID string        `json:"task_id,omitempty"`
+	Task   *DownloadTask `json:"task,omitempty"`
+	Time   time.Time     `json:"time"`
+}
+
+// Broker 將任務事件發送給所有訂閱者，並保留最近的事件供斷線重連時補送
+type Broker struct {
+	mu       sync.Mutex
+	nextID   uint64
+	history  []Event
+	subs     map[chan Event]struct{}
+	progress map[string]Event // 每個任務最後發送的進度事件，用於限制頻率
+}
+
+// NewBroker 建立事件中心
+func NewBroker() *Broker {
+	return &Broker{nextID: 1, subs: make(map[chan Event]struct{}), progress: make(map[string]Event)}
+}
+
+// Publish 發送事件，b 為 nil 時不做任何事
+// 進度事件沒有 ID 也不保留，同一任務同一階段每 progressInterval 最多發送一次，其他事件依序編號並保留在歷史記錄中
+func (b *Broker) Publish(typ EventType, task *DownloadTask) {
+	if b == nil {
+		return
+	}
+
+	ev := Event{Type: typ, TaskID: task.ID, Time: time.Now()}
+	if typ != EventDeleted {
+		snapshot := *task
+		ev.Task = &snapshot
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if typ == EventProgress {
+		last, ok := b.progress[task.ID]
+		if ok && last.Task.Stage == task.Stage && ev.Time.Sub(last.Time) < progressInterval {
+			return
+		}
+		b.progress[task.ID] = ev
+	} else {
+		delete(b.progress, task.ID)
+		ev.ID = b.nextID
+		b.nextID++
+		b.history = append(b.history, ev)
+		if len(b.history) > eventHistorySize {
+			b.history = b.history[len(b.history)-eventHistorySize:]
+		}
+	}
+
+	for ch := range b.subs {
+		// 進度事件只在緩衝未過半時發送，跟不上時直接略過，保留空間給狀態事件
+		if typ == EventProgress {
+			if len(ch) < cap(ch)/2 {
+				ch <- ev
+			}
+			continue
+		}
+		select {
+		case ch <- ev:
+		default:
+			// 訂閱者跟不上時中斷連線，客戶端以 Last-Event-ID 重新連線補送
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe 訂閱事件，回傳 lastID 之後的歷史事件、後續事件的 channel 與取消訂閱函數
+// 無法從 lastID 補送完整事件時，歷史事件的第一筆為 EventResync
+func (b *Broker) Subscribe(lastID uint64) ([]Event, <-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var backlog []Event
+	if lastID > 0 {
+		oldest := b.nextID
+		if len(b.history) > 0 {
+			oldest = b.history[0].ID
+		}
+		// 事件已不在歷史記錄中，或 ID 來自重新啟動前的服務器
+		if lastID+1 < oldest || lastID >= b.nextID {
+			backlog = append(backlog, Event{Type: EventResync, Time: time.Now()})
+		}
+		for _, ev := range b.history {
+			if ev.ID > lastID {
+				backlog = append(backlog, ev)
+			}
+		}
+	}
+
+	ch := make(chan Event, eventBufferSize)
+	b.subs[ch] = struct{}{}
+
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+	return backlog, ch, cancel
+}
+
+// publishStatus 發送狀態改變事件，已結束的任務發送 EventFinished，呼叫者需持有 tasksMutex
+func (s *Server) publishStatus(task *DownloadTask) {
+	typ := EventStatus
+	if task.Status.Finished() {
+		typ = EventFinished
+	}
+	s.events.Publish(typ, task)
+}
+
+// handleEvents 以 Server-Sent Events 推送任務事件
+// 支援 Last-Event-ID（或 ?last_event_id=）續傳，以及 ?task=<id> 只接收指定任務的事件（可重複指定）
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	lastID, err := lastEventID(r)
+	if err != nil {
+		s.sendError(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+		return
+	}
+	filter := taskFilter(r)
+
+	backlog, events, cancel := s.events.Subscribe(lastID)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	for _, ev := range backlog {
+		if filter.match(ev) {
+			writeEvent(w, ev)
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			if filter.match(ev) {
+				writeEvent(w, ev)
+				flusher.Flush()
+			}
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// lastEventID 讀取 Last-Event-ID 標頭，EventSource 首次連線無法設定標頭時可用查詢參數
+func lastEventID(r *http.Request) (uint64, error) {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("last_event_id")
+	}
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
+
+// eventFilter 要接收的任務 ID，空白表示所有任務
+type eventFilter map[string]bool
+
+func taskFilter(r *http.Request) eventFilter {
+	filter := eventFilter{}
+	for _, value := range r.URL.Query()["task"] {
+		for _, id := range strings.Split(value, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				filter[id] = true
+			}
+		}
+	}
+	return filter
+}
+
+func (f eventFilter) match(ev Event) bool {
+	return len(f) == 0 || ev.TaskID == "" || f[ev.TaskID]
+}
+
+// writeEvent 以 SSE 格式寫出事件
+func writeEvent(w http.ResponseWriter, ev Event) {
+	data, _ := json.Marshal(ev)
+	if ev.ID > 0 {
+		fmt.Fprintf(w, "id: %d\n", ev.ID)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+}
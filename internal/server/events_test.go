@@ -0,0 +1,271 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBroker_Backlog(t *testing.T) {
+	b := NewBroker()
+	task := &DownloadTask{ID: "t1", Status: StatusQueued}
+
+	b.Publish(EventCreated, task)
+	b.Publish(EventProgress, task) // 進度事件不保留
+	task.Status = StatusDownloading
+	b.Publish(EventStatus, task)
+
+	backlog, _, cancel := b.Subscribe(1)
+	defer cancel()
+
+	if len(backlog) != 1 || backlog[0].ID != 2 || backlog[0].Type != EventStatus {
+		t.Fatalf("expected only event 2 after Last-Event-ID 1, got %+v", backlog)
+	}
+	if backlog[0].Task.Status != StatusDownloading {
+		t.Errorf("expected task snapshot with status downloading, got %s", backlog[0].Task.Status)
+	}
+
+	// 沒有 Last-Event-ID 時不補送
+	backlog, _, cancel2 := b.Subscribe(0)
+	defer cancel2()
+	if len(backlog) != 0 {
+		t.Errorf("expected no backlog without Last-Event-ID, got %d", len(backlog))
+	}
+}
+
+func TestBroker_Resync(t *testing.T) {
+	b := NewBroker()
+	task := &DownloadTask{ID: "t1"}
+	for i := 0; i < eventHistorySize+10; i++ {
+		b.Publish(EventStatus, task)
+	}
+
+	// 早於歷史記錄的事件已遺失
+	backlog, _, cancel := b.Subscribe(5)
+	defer cancel()
+	if len(backlog) == 0 || backlog[0].Type != EventResync {
+		t.Fatalf("expected resync event first, got %+v", backlog[:1])
+	}
+	if len(backlog) != eventHistorySize+1 {
+		t.Errorf("expected full history after resync, got %d", len(backlog))
+	}
+
+	// 重新啟動前的事件 ID
+	backlog, _, cancel2 := b.Subscribe(99999)
+	defer cancel2()
+	if len(backlog) != 1 || backlog[0].Type != EventResync {
+		t.Errorf("expected only resync for unknown ID, got %d events", len(backlog))
+	}
+}
+
+func TestBroker_DropsSlowSubscriber(t *testing.T) {
+	b := NewBroker()
+	_, events, cancel := b.Subscribe(0)
+	defer cancel()
+
+	task := &DownloadTask{ID: "t1"}
+	for i := 0; i < eventBufferSize+1; i++ {
+		b.Publish(EventStatus, task)
+	}
+
+	count := 0
+	for range events {
+		count++
+	}
+	if count != eventBufferSize {
+		t.Errorf("expected %d buffered events before disconnect, got %d", eventBufferSize, count)
+	}
+}
+
+func TestBroker_ProgressThrottled(t *testing.T) {
+	b := NewBroker()
+	_, events, cancel := b.Subscribe(0)
+	defer cancel()
+
+	task := &DownloadTask{ID: "t1", Stage: "downloading"}
+	for i := 0; i < 10; i++ {
+		task.SegmentsDone = i
+		b.Publish(EventProgress, task)
+	}
+	// 進入新階段時立即發送
+	task.Stage = "merging"
+	b.Publish(EventProgress, task)
+	b.Publish(EventProgress, task)
+	// 狀態改變後重新計算間隔
+	b.Publish(EventFinished, task)
+	b.Publish(EventProgress, task)
+
+	var got []EventType
+	for len(events) > 0 {
+		got = append(got, (<-events).Type)
+	}
+	want := []EventType{EventProgress, EventProgress, EventFinished, EventProgress}
+	if len(got) != len(want) {
+		t.Fatalf("expected events %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected events %v, got %v", want, got)
+		}
+	}
+}
+
+func TestBroker_ProgressKeepsSlowSubscriber(t *testing.T) {
+	b := NewBroker()
+	_, events, cancel := b.Subscribe(0)
+	defer cancel()
+
+	// 進度事件不會塞滿緩衝，跟不上時略過而不中斷連線
+	for i := 0; i < eventBufferSize*2; i++ {
+		b.Publish(EventProgress, &DownloadTask{ID: fmt.Sprintf("t%d", i)})
+	}
+	if n := len(events); n != eventBufferSize/2 {
+		t.Errorf("expected %d buffered progress events, got %d", eventBufferSize/2, n)
+	}
+	b.Publish(EventFinished, &DownloadTask{ID: "t0"})
+	if n := len(events); n != eventBufferSize/2+1 {
+		t.Errorf("expected status event to be delivered, got %d buffered", n)
+	}
+}
+
+func TestEventsEndpoint(t *testing.T) {
+	s := newTestServer()
+	ts := httptest.NewServer(s.mux)
+	defer ts.Close()
+
+	dir := t.TempDir()
+	var ids []string
+	for _, url := range []string{"https://jable.tv/videos/abc-123/", "https://jable.tv/videos/abc-456/"} {
+		resp, code := s.submit(DownloadRequest{URL: url, OutputDir: dir}, "")
+		if code != http.StatusOK {
+			t.Fatalf("submit %s failed: %d %s", url, code, resp.Message)
+		}
+		ids = append(ids, resp.TaskID)
+	}
+	t1, t2 := ids[0], ids[1]
+
+	resp, err := http.Get(ts.URL + "/api/events?task=" + t1)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected text/event-stream, got %q", ct)
+	}
+
+	// 收到回應標頭時已完成訂閱，之後的事件只收到 t1 的
+	task, ok := s.queue.Pop()
+	if !ok || task.ID != t1 {
+		t.Fatalf("expected %s at the head of the queue, got %+v", t1, task)
+	}
+	if _, ok := s.startTask(task); !ok {
+		t.Fatal("expected queued task to start")
+	}
+	if _, err := s.applyAction(t2, ActionCancel); err != nil {
+		t.Fatalf("cancel failed: %v", err)
+	}
+	s.finishTask(t1, StatusFailed, "boom")
+	s.removeActiveTask(t1)
+	if _, err := s.applyAction(t1, ActionRetry); err != nil {
+		t.Fatalf("retry failed: %v", err)
+	}
+
+	r := bufio.NewReader(resp.Body)
+	want := []struct {
+		id     uint64
+		typ    EventType
+		status TaskStatus
+	}{
+		{3, EventStatus, StatusDownloading},
+		{5, EventFinished, StatusFailed},
+		{6, EventStatus, StatusQueued},
+	}
+	for _, w := range want {
+		ev := readEvent(t, r)
+		if ev.ID != w.id || ev.Type != w.typ || ev.TaskID != t1 || ev.Task.Status != w.status {
+			t.Errorf("expected event %d %s %s for %s, got %+v", w.id, w.typ, w.status, t1, ev)
+		}
+		if w.status == StatusFailed && ev.Task.Error != "boom" {
+			t.Errorf("expected error boom, got %q", ev.Task.Error)
+		}
+	}
+}
+
+func TestEventsEndpoint_LastEventID(t *testing.T) {
+	s := newTestServer()
+	ts := httptest.NewServer(s.mux)
+	defer ts.Close()
+
+	task := &DownloadTask{ID: "t1", Status: StatusQueued}
+	s.events.Publish(EventCreated, task)
+	task.Status = StatusDownloading
+	s.events.Publish(EventStatus, task)
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/events", nil)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	ev := readEvent(t, bufio.NewReader(resp.Body))
+	if ev.ID != 2 || ev.Type != EventStatus {
+		t.Errorf("expected missed event 2, got %+v", ev)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, ts.URL+"/api/events", nil)
+	req.Header.Set("Last-Event-ID", "abc")
+	resp2, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp2.Body.Close()
+	if resp2.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid Last-Event-ID, got %d", resp2.StatusCode)
+	}
+}
+
+// readEvent 讀取下一個 SSE 事件，略過心跳
+func readEvent(t *testing.T, r *bufio.Reader) Event {
+	t.Helper()
+
+	done := make(chan Event, 1)
+	go func() {
+		var data string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				close(done)
+				return
+			}
+			line = strings.TrimRight(line, "\n")
+			switch {
+			case strings.HasPrefix(line, "data: "):
+				data = strings.TrimPrefix(line, "data: ")
+			case line == "" && data != "":
+				var ev Event
+				json.Unmarshal([]byte(data), &ev)
+				done <- ev
+				return
+			}
+		}
+	}()
+
+	select {
+	case ev, ok := <-done:
+		if !ok {
+			t.Fatal("event stream closed")
+		}
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+	return Event{}
+}
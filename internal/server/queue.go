@@ -0,0 +1,96 @@
+package server
+
+import "sync"
+
+// TaskQueue 不限長度的任務隊列，工作器以 Pop 依序取出
+// 隊列只在記憶體中，排隊中的任務由 Store 保存，重新啟動時再加入隊列
+type TaskQueue struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	tasks  []*DownloadTask
+	closed bool
+}
+
+// NewTaskQueue 創建空的任務隊列
+func NewTaskQueue() *TaskQueue {
+	q := &TaskQueue{}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// Push 將任務加入隊尾，任務已在隊列中時不重複加入
+func (q *TaskQueue) Push(task *DownloadTask) {
+	q.Offer(task, 0)
+}
+
+// Offer 在隊列長度小於 limit 時加入任務，limit <= 0 表示不限制
+// 隊列已滿時回傳 false，任務已在隊列中時視為成功
+func (q *TaskQueue) Offer(task *DownloadTask, limit int) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.indexOf(task.ID) >= 0 {
+		return true
+	}
+	if limit > 0 && len(q.tasks) >= limit {
+		return false
+	}
+	q.tasks = append(q.tasks, task)
+	q.cond.Signal()
+	return true
+}
+
+// Pop 取出隊首的任務，隊列為空時等待，隊列關閉後回傳 false
+func (q *TaskQueue) Pop() (*DownloadTask, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.tasks) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return nil, false
+	}
+	task := q.tasks[0]
+	q.tasks[0] = nil
+	q.tasks = q.tasks[1:]
+	return task, true
+}
+
+// Remove 將任務移出隊列，任務不在隊列中時回傳 false
+func (q *TaskQueue) Remove(taskID string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	i := q.indexOf(taskID)
+	if i < 0 {
+		return false
+	}
+	q.tasks = append(q.tasks[:i], q.tasks[i+1:]...)
+	return true
+}
+
+// Len 回傳排隊中的任務數
+func (q *TaskQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.tasks)
+}
+
+// Close 關閉隊列，喚醒所有等待中的工作器
+func (q *TaskQueue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+// indexOf 回傳任務在隊列中的位置，呼叫者需持有 mu
+func (q *TaskQueue) indexOf(taskID string) int {
+	for i, task := range q.tasks {
+		if task.ID == taskID {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTaskQueue_FIFO(t *testing.T) {
+	q := NewTaskQueue()
+	a := &DownloadTask{ID: "a"}
+	b := &DownloadTask{ID: "b"}
+	c := &DownloadTask{ID: "c"}
+
+	q.Push(a)
+	q.Push(b)
+	q.Push(a) // 重複加入不影響順序
+	q.Push(c)
+	if q.Len() != 3 {
+		t.Fatalf("expected 3 queued tasks, got %d", q.Len())
+	}
+
+	if !q.Remove("b") || q.Remove("b") {
+		t.Error("Remove should succeed once")
+	}
+	for _, want := range []string{"a", "c"} {
+		task, ok := q.Pop()
+		if !ok || task.ID != want {
+			t.Fatalf("expected %s, got %v", want, task)
+		}
+	}
+	if q.Len() != 0 {
+		t.Errorf("expected empty queue, got %d", q.Len())
+	}
+}
+
+func TestTaskQueue_Offer(t *testing.T) {
+	q := NewTaskQueue()
+
+	if !q.Offer(&DownloadTask{ID: "a"}, 2) || !q.Offer(&DownloadTask{ID: "b"}, 2) {
+		t.Fatal("Offer should accept tasks below the limit")
+	}
+	if q.Offer(&DownloadTask{ID: "c"}, 2) {
+		t.Error("Offer should reject tasks when the queue is full")
+	}
+	if !q.Offer(&DownloadTask{ID: "c"}, 0) {
+		t.Error("limit 0 should be unlimited")
+	}
+	if q.Len() != 3 {
+		t.Errorf("expected 3 queued tasks, got %d", q.Len())
+	}
+}
+
+func TestTaskQueue_PopWaits(t *testing.T) {
+	q := NewTaskQueue()
+	got := make(chan *DownloadTask)
+	go func() {
+		task, _ := q.Pop()
+		got <- task
+	}()
+
+	select {
+	case <-got:
+		t.Fatal("Pop should wait for a task")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	q.Push(&DownloadTask{ID: "a"})
+	select {
+	case task := <-got:
+		if task.ID != "a" {
+			t.Errorf("expected a, got %s", task.ID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Pop did not return after Push")
+	}
+}
+
+func TestTaskQueue_Close(t *testing.T) {
+	q := NewTaskQueue()
+	done := make(chan bool)
+	go func() {
+		_, ok := q.Pop()
+		done <- ok
+	}()
+
+	q.Close()
+	select {
+	case ok := <-done:
+		if ok {
+			t.Error("Pop should return false after Close")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Close did not wake the waiting worker")
+	}
+}
+
+func TestDownloadEndpoint_QueueFull(t *testing.T) {
+	s := newTestServer()
+	s.maxQueue = 1
+
+	post := func(url string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/download", strings.NewReader(`{"url":"`+url+`"}`))
+		w := httptest.NewRecorder()
+		s.mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := post("https://jable.tv/videos/one/"); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	w := post("https://jable.tv/videos/two/")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 when the queue is full, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "Queue is full") {
+		t.Errorf("expected queue full message, got %s", w.Body.String())
+	}
+	if len(s.tasks) != 1 {
+		t.Errorf("rejected request should not create a task, got %d tasks", len(s.tasks))
+	}
+}
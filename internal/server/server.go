@@ -1,27 +1,56 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/jable-downloader-go/internal/config"
+	"github.com/jable-downloader-go/internal/crawler"
 	"github.com/jable-downloader-go/internal/downloader"
+	"github.com/jable-downloader-go/internal/encoder"
+	"github.com/jable-downloader-go/internal/ffmpeg"
+	"github.com/jable-downloader-go/internal/hls"
+	"github.com/jable-downloader-go/internal/hooks"
+	"github.com/jable-downloader-go/internal/merger"
+	"github.com/jable-downloader-go/pkg/utils"
 )
 
 // DownloadRequest 下載請求結構
 type DownloadRequest struct {
-	URL     string `json:"url"`
-	Convert bool   `json:"convert"`
+	URL        string `json:"url"`
+	Convert    bool   `json:"convert"`
+	EncodeMode string `json:"encode_mode,omitempty"` // none, fast, gpu, cpu，指定時優先於 convert
+	Container  string `json:"container,omitempty"`   // mp4, mkv, ts, fmp4，預設 mp4
+	Profile    string `json:"profile,omitempty"`     // 轉檔設定名稱，指定時優先於 encode_mode 與 convert
+	Quality    string `json:"quality,omitempty"`     // best, worst 或最高解析度，例如 720p
+	OutputDir  string `json:"output_dir,omitempty"`  // 下載資料夾，需為相對路徑，預設 download
+	Range      string `json:"range,omitempty"`       // 只下載一段，例如 10:00-20:00
+	Cover      *bool  `json:"cover,omitempty"`       // 下載並嵌入封面，預設 true
+	Metadata   *bool  `json:"metadata,omitempty"`    // 寫入標題、演員等標籤，預設 true
+	Sheet      bool   `json:"sheet,omitempty"`       // 產生縮圖總覽
+	Preview    string `json:"preview,omitempty"`     // 預覽短片格式: webp, mp4
+	Loudnorm   bool   `json:"loudnorm,omitempty"`    // EBU R128 響度正規化
+	Force      bool   `json:"force,omitempty"`       // 影片已下載時仍重新下載
 }
 
 // DownloadResponse 下載響應結構
 type DownloadResponse struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
-	TaskID  string `json:"task_id,omitempty"`
+	Success           bool   `json:"success"`
+	Message           string `json:"message"`
+	TaskID            string `json:"task_id,omitempty"`
+	Duplicate         bool   `json:"duplicate,omitempty"`          // task_id 為同一影片已存在的任務
+	AlreadyDownloaded bool   `json:"already_downloaded,omitempty"` // 影片已在下載資料夾中，未建立任務
+	OutputPath        string `json:"output_path,omitempty"`        // 已下載影片的路徑
 }
 
 // HealthResponse 健康檢查響應
@@ -33,72 +62,224 @@ type HealthResponse struct {
 
 // Server HTTP API 服務器
 type Server struct {
-	port         int
-	mux          *http.ServeMux
-	tasks        map[string]*DownloadTask
-	tasksMutex   sync.RWMutex
-	queue        chan *DownloadTask
-	currentTask  *DownloadTask
-	currentMutex sync.RWMutex
+	port        int
+	mux         *http.ServeMux
+	tasks       map[string]*DownloadTask
+	tasksMutex  sync.RWMutex
+	queue       *TaskQueue
+	maxQueue    int                           // 排隊中任務數上限，0 表示不限制
+	active      map[string]*DownloadTask      // 正在處理的任務
+	cancels     map[string]context.CancelFunc // 停止正在處理的任務
+	activeMutex sync.RWMutex
+	workers     int
+	limiter     crawler.Limiter // 所有任務共用的片段連線數上限
+	hooks       *hooks.Pipeline
+	store       *Store // 任務記錄，nil 表示只保存在記憶體
+	events      *Broker
+	batches     map[string]*Batch                  // 批次下載，由 tasksMutex 保護
+	expandPage  func(url string) ([]string, error) // 展開列表頁，預設 utils.GetMovieLinks
+
+	host           string   // 監聽位址
+	token          string   // API token，空字串表示不檢查
+	allowedOrigins []string // 允許的 CORS 來源
+}
+
+// Options 服務器設定
+type Options struct {
+	Workers     int    // 同時處理的任務數，預設 config.ServerWorkers
+	Connections int    // 所有任務共用的片段連線數上限，預設 config.MaxWorkers
+	TasksFile   string // 任務記錄檔，空字串表示不保存，重新啟動後任務會消失
+	MaxQueue    int    // 排隊中任務數上限，超過時新的下載請求回傳 429，0 表示不限制
+
+	Host           string   // 監聽位址，預設 config.ServerHost 只接受本機連線
+	Token          string   // 除 /api/health 外的請求需攜帶 Authorization: Bearer <token>
+	AllowedOrigins []string // 允許的 CORS 來源，nil 表示使用 config.AllowedOrigins（預設不允許跨來源請求）
 }
 
 // DownloadTask 下載任務
 type DownloadTask struct {
-	ID        string    `json:"id"`
-	URL       string    `json:"url"`
-	Status    string    `json:"status"`
-	CreatedAt time.Time `json:"created_at"`
-	Error     string    `json:"error,omitempty"`
-	Convert   bool      `json:"convert"`
+	ID        string     `json:"id"`
+	URL       string     `json:"url"`
+	BatchID   string     `json:"batch_id,omitempty"`
+	Status    TaskStatus `json:"status"`
+	CreatedAt time.Time  `json:"created_at"`
+	Error     string     `json:"error,omitempty"`
+	Convert   bool       `json:"convert"`
+	Container string     `json:"container"`
+	Profile   string     `json:"profile,omitempty"`
+	Sheet     bool       `json:"sheet,omitempty"`
+	Preview   string     `json:"preview,omitempty"`
+	Loudnorm  bool       `json:"loudnorm,omitempty"`
+	Force     bool       `json:"force,omitempty"`
+
+	EncodeMode string `json:"encode_mode,omitempty"`
+	Quality    string `json:"quality,omitempty"`
+	OutputDir  string `json:"output_dir,omitempty"`
+	Range      string `json:"range,omitempty"`
+	Cover      *bool  `json:"cover,omitempty"`    // 未設定時為 true
+	Metadata   *bool  `json:"metadata,omitempty"` // 未設定時為 true
+
+	Progress *ffmpeg.Progress `json:"progress,omitempty"` // 合成與轉檔的 FFmpeg 進度
+	Warnings []string         `json:"warnings,omitempty"` // 失敗的後處理步驟，影片本身已保留
+
+	Stage         string     `json:"stage,omitempty"` // resolving, downloading, merging, encoding
+	SegmentsDone  int        `json:"segments_done,omitempty"`
+	SegmentsTotal int        `json:"segments_total,omitempty"`
+	Bytes         int64      `json:"bytes,omitempty"`       // 已下載的位元組數
+	Speed         float64    `json:"speed,omitempty"`       // 片段下載速度 (bytes/s)
+	ETA           float64    `json:"eta,omitempty"`         // 目前階段的預估剩餘秒數
+	OutputPath    string     `json:"output_path,omitempty"` // 完成後的影片路徑，分段輸出時為資料夾
+	StartedAt     *time.Time `json:"started_at,omitempty"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
 }
 
-// NewServer 創建新的服務器實例
+// resetProgress 清除上一次處理留下的進度，重新開始處理前呼叫
+func (t *DownloadTask) resetProgress() {
+	t.Error = ""
+	t.Progress = nil
+	t.Warnings = nil
+	t.Stage = ""
+	t.SegmentsDone = 0
+	t.SegmentsTotal = 0
+	t.Bytes = 0
+	t.Speed = 0
+	t.ETA = 0
+	t.OutputPath = ""
+	t.StartedAt = nil
+	t.FinishedAt = nil
+}
+
+// finish 記錄結束時間並清除只在處理中有意義的欄位
+func (t *DownloadTask) finish() {
+	now := time.Now()
+	t.FinishedAt = &now
+	t.Speed = 0
+	t.ETA = 0
+}
+
+// NewServer 創建新的服務器實例，任務只保存在記憶體
 func NewServer(port int) *Server {
+	s, _ := NewServerWithOptions(port, Options{})
+	return s
+}
+
+// NewServerWithOptions 以指定的設定創建服務器
+// 指定 TasksFile 時會載入記錄檔，並將排隊中與中斷的任務重新加入隊列
+func NewServerWithOptions(port int, opts Options) (*Server, error) {
+	if opts.Workers <= 0 {
+		opts.Workers = config.ServerWorkers
+	}
+	if opts.Connections <= 0 {
+		opts.Connections = config.MaxWorkers
+	}
+	if opts.Host == "" {
+		opts.Host = config.ServerHost
+	}
+	if opts.AllowedOrigins == nil && config.AllowedOrigins != "" {
+		opts.AllowedOrigins = strings.Split(config.AllowedOrigins, ",")
+	}
+
 	s := &Server{
-		port:  port,
-		mux:   http.NewServeMux(),
-		tasks: make(map[string]*DownloadTask),
-		queue: make(chan *DownloadTask, 100),
+		port:       port,
+		mux:        http.NewServeMux(),
+		tasks:      make(map[string]*DownloadTask),
+		queue:      NewTaskQueue(),
+		maxQueue:   opts.MaxQueue,
+		active:     make(map[string]*DownloadTask),
+		cancels:    make(map[string]context.CancelFunc),
+		events:     NewBroker(),
+		batches:    make(map[string]*Batch),
+		expandPage: utils.GetMovieLinks,
+		workers:    opts.Workers,
+		limiter:    crawler.NewLimiter(opts.Connections),
+
+		host:           opts.Host,
+		token:          opts.Token,
+		allowedOrigins: opts.AllowedOrigins,
 	}
+
+	var pending []*DownloadTask
+	if opts.TasksFile != "" {
+		store, tasks, err := OpenStore(opts.TasksFile)
+		if err != nil {
+			return nil, err
+		}
+		s.store = store
+		pending = s.restoreTasks(tasks)
+		s.restoreBatches(store.Batches())
+	}
+
 	s.setupRoutes()
-	s.startQueueWorker()
-	return s
+	s.startQueueWorkers()
+
+	// 依建立時間加入隊列，恢復的任務不受 MaxQueue 限制
+	if len(pending) > 0 {
+		log.Printf("Resuming %d unfinished task(s) from %s", len(pending), opts.TasksFile)
+		for _, task := range pending {
+			s.queue.Push(task)
+		}
+	}
+	return s, nil
 }
 
-// startQueueWorker 啟動隊列工作器
-func (s *Server) startQueueWorker() {
-	go func() {
-		for task := range s.queue {
-			s.setCurrentTask(task)
-			s.processTask(task)
-			s.setCurrentTask(nil)
+// restoreTasks 載入記錄檔中的任務，回傳需要重新處理的任務
+// 處理到一半的任務改回排隊中，下載時會略過資料夾中已存在的片段
+func (s *Server) restoreTasks(tasks []*DownloadTask) []*DownloadTask {
+	s.tasksMutex.Lock()
+	defer s.tasksMutex.Unlock()
+
+	var pending []*DownloadTask
+	for _, task := range tasks {
+		s.tasks[task.ID] = task
+		if task.Status == StatusQueued || task.Status == StatusDownloading {
+			task.Status = StatusQueued
+			task.resetProgress()
+			s.persist(task)
+			pending = append(pending, task)
 		}
-	}()
+	}
+	return pending
 }
 
-// setupRoutes 設置路由
-func (s *Server) setupRoutes() {
-	// CORS 中間件
-	corsMiddleware := func(next http.HandlerFunc) http.HandlerFunc {
-		return func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-			
-			if r.Method == "OPTIONS" {
-				w.WriteHeader(http.StatusOK)
-				return
+// persist 寫入任務的最新狀態，呼叫者需持有 tasksMutex
+func (s *Server) persist(task *DownloadTask) {
+	if err := s.store.Put(task); err != nil {
+		log.Printf("Failed to save task %s: %v", task.ID, err)
+	}
+}
+
+// startQueueWorkers 啟動 s.workers 個隊列工作器，片段下載共用 s.limiter 的連線數
+func (s *Server) startQueueWorkers() {
+	for i := 0; i < s.workers; i++ {
+		go func() {
+			for {
+				task, ok := s.queue.Pop()
+				if !ok {
+					return // 服務器已關閉
+				}
+				ctx, ok := s.startTask(task)
+				if !ok {
+					continue // 排隊期間已暫停、取消或刪除
+				}
+				s.processTask(ctx, task)
+				s.removeActiveTask(task.ID)
 			}
-			
-			next(w, r)
-		}
+		}()
 	}
+}
 
-	// 路由
-	s.mux.HandleFunc("/api/health", corsMiddleware(s.handleHealth))
-	s.mux.HandleFunc("/api/download", corsMiddleware(s.handleDownload))
-	s.mux.HandleFunc("/api/tasks", corsMiddleware(s.handleTasks))
-	s.mux.HandleFunc("/api/tasks/clear-completed", corsMiddleware(s.handleClearCompletedTasks))
+// setupRoutes 設置路由
+func (s *Server) setupRoutes() {
+	// 健康檢查不需要 token，讓擴展可以判斷服務器是否在線
+	s.mux.HandleFunc("/api/health", s.cors(s.handleHealth))
+	s.mux.HandleFunc("/api/download", s.cors(s.requireToken(s.handleDownload)))
+	s.mux.HandleFunc("/api/tasks", s.cors(s.requireToken(s.handleTasks)))
+	s.mux.HandleFunc("/api/tasks/clear-completed", s.cors(s.requireToken(s.handleClearCompletedTasks)))
+	s.mux.HandleFunc("/api/tasks/{id}", s.cors(s.requireToken(s.handleTask)))
+	s.mux.HandleFunc("/api/tasks/{id}/{action}", s.cors(s.requireToken(s.handleTaskAction)))
+	s.mux.HandleFunc("/api/events", s.cors(s.requireToken(s.handleEvents)))
+	s.mux.HandleFunc("/api/batch", s.cors(s.requireToken(s.handleBatch)))
+	s.mux.HandleFunc("/api/batch/{id}", s.cors(s.requireToken(s.handleBatchStatus)))
 }
 
 // handleHealth 健康檢查
@@ -136,72 +317,296 @@ func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := req.validate(); err != nil {
+		s.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response, code := s.submit(req, "")
+	s.sendResponse(w, response, code)
+}
+
+// validate 檢查下載選項並正規化封裝與預覽格式，不檢查 URL
+func (req *DownloadRequest) validate() error {
+	if req.EncodeMode == "" && req.Convert {
+		req.EncodeMode = encoder.ProfileFast
+	}
+	if req.EncodeMode != "" {
+		mode, err := encoder.ParseEncodeMode(req.EncodeMode)
+		if err != nil {
+			return err
+		}
+		req.EncodeMode = strings.ToLower(strings.TrimSpace(req.EncodeMode))
+		req.Convert = mode != encoder.NoEncode
+	}
+
+	container, err := merger.ParseContainer(req.Container)
+	if err != nil {
+		return err
+	}
+	req.Container = string(container)
+
+	quality, err := downloader.ParseQuality(req.Quality)
+	if err != nil {
+		return err
+	}
+	req.Quality = quality
+
+	if req.OutputDir != "" {
+		dir := filepath.Clean(filepath.FromSlash(req.OutputDir))
+		if !filepath.IsLocal(dir) {
+			return fmt.Errorf("output_dir must be a relative path inside the server directory")
+		}
+		req.OutputDir = dir
+	}
+
+	if req.Range != "" {
+		r, err := hls.ParseTimeRange(req.Range)
+		if err != nil {
+			return err
+		}
+		req.Range = r.String()
+	}
+
+	if req.Profile != "" {
+		if err := encoder.CheckProfileRequirements(req.Profile); err != nil {
+			return err
+		}
+	}
+
+	preview, err := encoder.ParsePreviewFormat(req.Preview)
+	if err != nil {
+		return err
+	}
+	req.Preview = preview
+	return nil
+}
+
+// submit 為已驗證的請求建立任務並加入隊列，回傳響應與 HTTP 狀態碼
+// 同一影片已有未結束的任務時回傳該任務，影片已下載且未指定 force 時不建立任務並回傳 already_downloaded
+func (s *Server) submit(req DownloadRequest, batchID string) (DownloadResponse, int) {
+	d, err := downloader.NewDownloader(req.URL)
+	if err != nil {
+		return DownloadResponse{Message: err.Error()}, http.StatusBadRequest
+	}
+	d.Container = merger.Container(req.Container)
+	d.SetOutputDir(req.OutputDir)
+	if d.Downloaded() && !req.Force {
+		return DownloadResponse{
+			Success:           true,
+			Message:           fmt.Sprintf("Video %s already downloaded, set force to download again", d.DirName),
+			AlreadyDownloaded: true,
+			OutputPath:        outputPath(d),
+		}, http.StatusOK
+	}
+
 	// 創建任務
-	taskID := fmt.Sprintf("task_%d", time.Now().UnixNano())
 	task := &DownloadTask{
-		ID:        taskID,
 		URL:       req.URL,
-		Status:    "queued",
+		BatchID:   batchID,
+		Status:    StatusQueued,
 		CreatedAt: time.Now(),
 		Convert:   req.Convert,
+		Container: req.Container,
+		Profile:   req.Profile,
+		Sheet:     req.Sheet,
+		Preview:   req.Preview,
+		Loudnorm:  req.Loudnorm,
+		Force:     req.Force,
+
+		EncodeMode: req.EncodeMode,
+		Quality:    req.Quality,
+		OutputDir:  req.OutputDir,
+		Range:      req.Range,
+		Cover:      req.Cover,
+		Metadata:   req.Metadata,
 	}
 
+	// 加入隊列，持有 tasksMutex 讓工作器取出任務時已能在列表中找到
 	s.tasksMutex.Lock()
-	s.tasks[taskID] = task
-	s.tasksMutex.Unlock()
+	defer s.tasksMutex.Unlock()
 
-	// 加入隊列
-	s.queue <- task
+	if existing := s.unfinishedTask(d.DirName, ""); existing != nil {
+		return DownloadResponse{
+			Success:   true,
+			Message:   fmt.Sprintf("Task already %s", existing.Status),
+			TaskID:    existing.ID,
+			Duplicate: true,
+		}, http.StatusOK
+	}
+	task.ID = s.newTaskID()
+	if !s.queue.Offer(task, s.maxQueue) {
+		return DownloadResponse{
+			Message: fmt.Sprintf("Queue is full (%d tasks waiting), try again later", s.maxQueue),
+		}, http.StatusTooManyRequests
+	}
+	s.tasks[task.ID] = task
+	s.persist(task)
+	s.events.Publish(EventCreated, task)
 
-	// 返回響應
-	response := DownloadResponse{
+	return DownloadResponse{
 		Success: true,
 		Message: "Download task queued",
-		TaskID:  taskID,
+		TaskID:  task.ID,
+	}, http.StatusOK
+}
+
+// newTaskID 產生不重複的任務 ID，呼叫者需持有 tasksMutex
+func (s *Server) newTaskID() string {
+	for n := time.Now().UnixNano(); ; n++ {
+		id := fmt.Sprintf("task_%d", n)
+		if _, ok := s.tasks[id]; !ok {
+			return id
+		}
 	}
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+// SetHooks 設定每個任務各階段執行的 hook，需在開始處理任務前呼叫
+func (s *Server) SetHooks(p *hooks.Pipeline) {
+	s.hooks = p
+}
+
+// startTask 將排隊中的任務改為處理中，任務已不是排隊中（暫停、取消或刪除）時回傳 false
+// 暫停後立即繼續的任務，上一次處理尚未結束時也回傳 false，由 removeActiveTask 重新加入隊列
+// 回傳的 ctx 在任務被暫停或取消時取消
+func (s *Server) startTask(task *DownloadTask) (context.Context, bool) {
+	s.tasksMutex.Lock()
+	defer s.tasksMutex.Unlock()
+
+	if s.tasks[task.ID] != task || !task.Status.CanTransition(StatusDownloading) {
+		return nil, false
+	}
+	s.activeMutex.RLock()
+	_, running := s.active[task.ID]
+	s.activeMutex.RUnlock()
+	if running {
+		return nil, false
+	}
+	now := time.Now()
+	task.resetProgress()
+	task.Status = StatusDownloading
+	task.StartedAt = &now
+	s.persist(task)
+	s.publishStatus(task)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.activeMutex.Lock()
+	s.active[task.ID] = task
+	s.cancels[task.ID] = cancel
+	s.activeMutex.Unlock()
+	return ctx, true
 }
 
-// processTask 處理下載任務
-func (s *Server) processTask(task *DownloadTask) {
-	s.updateTaskStatus(task.ID, "downloading")
+// finishTask 記錄處理結果，任務在處理期間已被暫停或取消時保留該狀態
+func (s *Server) finishTask(taskID string, status TaskStatus, errMsg string) {
+	s.tasksMutex.Lock()
+	defer s.tasksMutex.Unlock()
+
+	if task, ok := s.tasks[taskID]; ok && task.Status == StatusDownloading {
+		task.Status = status
+		task.Error = errMsg
+		task.finish()
+		s.persist(task)
+		s.publishStatus(task)
+	}
+}
+
+// processTask 處理下載任務，ctx 取消時停止下載與 FFmpeg
+func (s *Server) processTask(ctx context.Context, task *DownloadTask) {
 	log.Printf("Starting download for task %s: %s", task.ID, task.URL)
 
 	// 調用 downloader 包的下載函數
 	d, err := downloader.NewDownloader(task.URL)
 	if err != nil {
-		s.updateTaskError(task.ID, err.Error())
+		s.finishTask(task.ID, StatusFailed, err.Error())
 		log.Printf("Failed to create downloader for %s: %v", task.URL, err)
 		return
 	}
 	
 	// 設置為自動模式（不詢問用戶）
 	d.AutoMode = true
+	d.Force = task.Force
 	
-	// 設置轉檔模式
-	if task.Convert {
-		d.EncodeMode = 1 // FastEncode - 僅轉換格式（推薦）
-	} else {
-		d.EncodeMode = 0 // NoEncode - 不轉檔
+	// 設置轉檔模式，舊版任務只記錄 convert
+	mode := task.EncodeMode
+	if mode == "" && task.Convert {
+		mode = encoder.ProfileFast
+	}
+	if d.EncodeMode, err = encoder.ParseEncodeMode(mode); err != nil {
+		s.finishTask(task.ID, StatusFailed, err.Error())
+		log.Printf("Invalid encode mode for task %s: %v", task.ID, err)
+		return
+	}
+	
+	if task.Container != "" {
+		d.Container = merger.Container(task.Container)
+	}
+	
+	d.Quality = task.Quality
+	d.SetOutputDir(task.OutputDir)
+	if d.Range, err = hls.ParseTimeRange(task.Range); err != nil {
+		s.finishTask(task.ID, StatusFailed, err.Error())
+		log.Printf("Invalid range for task %s: %v", task.ID, err)
+		return
+	}
+	d.NoCover = task.Cover != nil && !*task.Cover
+	d.NoMetadata = task.Metadata != nil && !*task.Metadata
+	
+	// 指定轉檔設定時覆寫 convert，設定可能已在重新啟動後從 profiles.json 移除
+	if task.Profile != "" {
+		if err := encoder.CheckProfileRequirements(task.Profile); err != nil {
+			s.finishTask(task.ID, StatusFailed, err.Error())
+			log.Printf("Invalid profile for task %s: %v", task.ID, err)
+			return
+		}
+	}
+	d.Profile = task.Profile
+	
+	d.Previews = encoder.PreviewOptions{Sheet: task.Sheet, Preview: task.Preview}
+	d.Loudness = encoder.LoudnessOptions{Enabled: task.Loudnorm}
+	
+	d.Hooks = s.hooks
+	d.TaskID = task.ID
+	d.Limiter = s.limiter
+	d.Context = ctx
+	
+	// 記錄處理階段、片段下載與 FFmpeg 進度供 /api/tasks 查詢
+	d.OnStage = func(stage string) {
+		s.updateTaskStage(task.ID, stage)
+	}
+	d.OnSegments = func(p crawler.Progress) {
+		s.updateTaskSegments(task.ID, p)
+	}
+	d.OnProgress = func(p ffmpeg.Progress) {
+		s.updateTaskProgress(task.ID, p)
 	}
 	
 	if err := d.Download(); err != nil {
-		s.updateTaskError(task.ID, err.Error())
+		if ctx.Err() != nil {
+			log.Printf("Task %s stopped", task.ID)
+			return
+		}
+		s.finishTask(task.ID, StatusFailed, err.Error())
 		log.Printf("Download failed for %s: %v", task.URL, err)
 		return
 	}
 
-	s.updateTaskStatus(task.ID, "completed")
+	s.updateTaskOutput(task.ID, outputPath(d))
+
+	if len(d.Warnings) > 0 {
+		s.updateTaskWarnings(task.ID, d.Warnings)
+		log.Printf("Post-processing warnings for task %s: %v", task.ID, d.Warnings)
+	}
+
+	s.finishTask(task.ID, StatusCompleted, "")
 	log.Printf("Download completed for task %s", task.ID)
 }
 
 // TasksResponse 任務列表響應
 type TasksResponse struct {
-	Tasks       []*DownloadTask `json:"tasks"`
-	CurrentTask string          `json:"current_task,omitempty"`
-	QueueLength int             `json:"queue_length"`
+	Tasks       []DownloadTask `json:"tasks"`
+	ActiveTasks []string       `json:"active_tasks"` // 正在處理的任務 ID
+	QueueLength int            `json:"queue_length"`
 }
 
 // handleTasks 獲取任務列表
@@ -211,66 +616,150 @@ func (s *Server) handleTasks(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 在鎖內複製任務，工作器會持續更新進度
 	s.tasksMutex.RLock()
-	tasks := make([]*DownloadTask, 0, len(s.tasks))
+	tasks := make([]DownloadTask, 0, len(s.tasks))
 	for _, task := range s.tasks {
-		tasks = append(tasks, task)
+		tasks = append(tasks, *task)
 	}
 	s.tasksMutex.RUnlock()
 
 	// 按創建時間排序（最新的在前）
-	for i := 0; i < len(tasks); i++ {
-		for j := i + 1; j < len(tasks); j++ {
-			if tasks[i].CreatedAt.Before(tasks[j].CreatedAt) {
-				tasks[i], tasks[j] = tasks[j], tasks[i]
-			}
-		}
-	}
-
-	// 獲取當前任務
-	s.currentMutex.RLock()
-	currentTaskID := ""
-	if s.currentTask != nil {
-		currentTaskID = s.currentTask.ID
-	}
-	s.currentMutex.RUnlock()
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].CreatedAt.After(tasks[j].CreatedAt)
+	})
 
 	response := TasksResponse{
 		Tasks:       tasks,
-		CurrentTask: currentTaskID,
-		QueueLength: len(s.queue),
+		ActiveTasks: s.activeTaskIDs(),
+		QueueLength: s.queue.Len(),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
-// updateTaskStatus 更新任務狀態
-func (s *Server) updateTaskStatus(taskID, status string) {
+// updateTaskProgress 更新任務的 FFmpeg 進度
+func (s *Server) updateTaskProgress(taskID string, p ffmpeg.Progress) {
 	s.tasksMutex.Lock()
 	defer s.tasksMutex.Unlock()
 	
 	if task, ok := s.tasks[taskID]; ok {
-		task.Status = status
+		task.Progress = &p
+		task.ETA = p.ETA.Seconds()
+		s.events.Publish(EventProgress, task)
 	}
 }
 
-// updateTaskError 更新任務錯誤
-func (s *Server) updateTaskError(taskID, errMsg string) {
+// updateTaskStage 記錄任務進入新的處理階段，並清除上一個階段的速度與進度
+func (s *Server) updateTaskStage(taskID, stage string) {
 	s.tasksMutex.Lock()
 	defer s.tasksMutex.Unlock()
 	
 	if task, ok := s.tasks[taskID]; ok {
-		task.Status = "failed"
-		task.Error = errMsg
+		task.Stage = stage
+		task.Progress = nil
+		task.Speed = 0
+		task.ETA = 0
+		s.persist(task)
+		s.events.Publish(EventProgress, task)
 	}
 }
 
-// setCurrentTask 設置當前處理的任務
-func (s *Server) setCurrentTask(task *DownloadTask) {
-	s.currentMutex.Lock()
-	defer s.currentMutex.Unlock()
-	s.currentTask = task
+// updateTaskSegments 更新任務的片段下載進度，頻率高所以不寫入任務記錄
+func (s *Server) updateTaskSegments(taskID string, p crawler.Progress) {
+	s.tasksMutex.Lock()
+	defer s.tasksMutex.Unlock()
+	
+	if task, ok := s.tasks[taskID]; ok {
+		task.SegmentsDone = p.Done
+		task.SegmentsTotal = p.Total
+		task.Bytes = p.Bytes
+		task.Speed = p.Speed
+		task.ETA = p.ETA
+		s.events.Publish(EventProgress, task)
+	}
+}
+
+// updateTaskOutput 記錄任務完成後的影片路徑
+func (s *Server) updateTaskOutput(taskID, path string) {
+	s.tasksMutex.Lock()
+	defer s.tasksMutex.Unlock()
+	
+	if task, ok := s.tasks[taskID]; ok {
+		task.OutputPath = path
+		s.persist(task)
+	}
+}
+
+// outputPath 回傳下載完成的影片路徑，分段輸出時回傳資料夾
+func outputPath(d *downloader.Downloader) string {
+	path := d.FolderPath
+	if outputs := merger.ExistingOutputs(d.FolderPath, d.Container); len(outputs) == 1 {
+		path = outputs[0]
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// updateTaskWarnings 記錄任務失敗的後處理步驟
+func (s *Server) updateTaskWarnings(taskID string, warnings []string) {
+	s.tasksMutex.Lock()
+	defer s.tasksMutex.Unlock()
+	
+	if task, ok := s.tasks[taskID]; ok {
+		task.Warnings = warnings
+		s.persist(task)
+	}
+}
+
+// removeActiveTask 任務處理結束，處理期間已恢復或重試的任務重新加入隊列
+func (s *Server) removeActiveTask(taskID string) {
+	s.tasksMutex.Lock()
+	defer s.tasksMutex.Unlock()
+
+	s.activeMutex.Lock()
+	delete(s.active, taskID)
+	if cancel, ok := s.cancels[taskID]; ok {
+		cancel()
+		delete(s.cancels, taskID)
+	}
+	s.activeMutex.Unlock()
+
+	if task, ok := s.tasks[taskID]; ok && task.Status == StatusQueued {
+		s.queue.Push(task)
+	}
+}
+
+// stopActiveTask 取消正在處理的任務，下載與 FFmpeg 會盡快停止
+func (s *Server) stopActiveTask(taskID string) {
+	s.activeMutex.RLock()
+	defer s.activeMutex.RUnlock()
+	if cancel, ok := s.cancels[taskID]; ok {
+		cancel()
+	}
+}
+
+// activeTaskIDs 回傳正在處理的任務 ID，依 ID 排序
+func (s *Server) activeTaskIDs() []string {
+	s.activeMutex.RLock()
+	defer s.activeMutex.RUnlock()
+
+	ids := make([]string, 0, len(s.active))
+	for id := range s.active {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// sendResponse 以指定的狀態碼發送下載響應
+func (s *Server) sendResponse(w http.ResponseWriter, response DownloadResponse, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(response)
 }
 
 // sendError 發送錯誤響應
@@ -305,22 +794,25 @@ func (s *Server) handleClearCompletedTasks(w http.ResponseWriter, r *http.Reques
 	// 計算要清除的任務數量
 	clearedCount := 0
 	
-	// 獲取當前正在處理的任務 ID
-	s.currentMutex.RLock()
-	currentTaskID := ""
-	if s.currentTask != nil {
-		currentTaskID = s.currentTask.ID
+	// 獲取正在處理的任務 ID
+	active := make(map[string]bool)
+	for _, id := range s.activeTaskIDs() {
+		active[id] = true
 	}
-	s.currentMutex.RUnlock()
 
 	// 遍歷並刪除已完成的任務（保留正在進行中的任務）
 	for taskID, task := range s.tasks {
-		// 只刪除已完成或失敗的任務，且不是當前正在處理的任務
-		if (task.Status == "completed" || task.Status == "failed") && taskID != currentTaskID {
+		// 只刪除已結束的任務，且不是正在處理的任務
+		if task.Status.Finished() && !active[taskID] {
 			delete(s.tasks, taskID)
+			if err := s.store.Delete(taskID); err != nil {
+				log.Printf("Failed to delete task %s: %v", taskID, err)
+			}
+			s.events.Publish(EventDeleted, task)
 			clearedCount++
 		}
 	}
+	s.pruneBatches()
 
 	response := ClearCompletedResponse{
 		Success:      true,
@@ -336,12 +828,29 @@ func (s *Server) handleClearCompletedTasks(w http.ResponseWriter, r *http.Reques
 
 // Start 啟動服務器
 func (s *Server) Start() error {
-	addr := fmt.Sprintf(":%d", s.port)
-	log.Printf("🚀 API Server starting on http://localhost%s", addr)
-	log.Printf("📝 Health check: http://localhost%s/api/health", addr)
-	log.Printf("📥 Download API: http://localhost%s/api/download", addr)
-	log.Printf("📋 Tasks API: http://localhost%s/api/tasks", addr)
-	log.Printf("🗑️  Clear completed: http://localhost%s/api/tasks/clear-completed", addr)
+	addr := net.JoinHostPort(s.host, strconv.Itoa(s.port))
+	base := "http://" + addr
+	log.Printf("🚀 API Server starting on %s (%d workers, %d connections)", base, s.workers, cap(s.limiter))
+	log.Printf("📝 Health check: %s/api/health", base)
+	log.Printf("📥 Download API: %s/api/download", base)
+	log.Printf("📋 Tasks API: %s/api/tasks", base)
+	log.Printf("🗑️  Clear completed: %s/api/tasks/clear-completed", base)
+	log.Printf("📡 Events (SSE): %s/api/events", base)
+	log.Printf("📦 Batch API: %s/api/batch", base)
+	if len(s.allowedOrigins) == 0 {
+		log.Printf("🌐 No allowed origins, start with --allowed-origins chrome-extension://<id> to use the browser extension")
+	} else {
+		log.Printf("🌐 Allowed origins: %s", strings.Join(s.allowedOrigins, ", "))
+	}
+	if s.token == "" && !isLoopback(s.host) {
+		log.Printf("⚠️  Listening on %s without --token, anyone on the network can enqueue downloads", s.host)
+	}
 	
 	return http.ListenAndServe(addr, s.mux)
 }
+
+// Close 停止隊列工作器並關閉任務記錄檔
+func (s *Server) Close() error {
+	s.queue.Close()
+	return s.store.Close()
+}
@@ -2,26 +2,39 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/jable-downloader-go/internal/config"
+	"github.com/jable-downloader-go/internal/crawler"
+	"github.com/jable-downloader-go/internal/ffmpeg"
 )
 
 // newTestServer 創建一個測試用 Server，但不啟動 HTTP listener
 func newTestServer() *Server {
 	s := &Server{
-		port:  0, // not used in tests
-		mux:   http.NewServeMux(),
-		tasks: make(map[string]*DownloadTask),
-		queue: make(chan *DownloadTask, 100),
+		port:    0, // not used in tests
+		mux:     http.NewServeMux(),
+		tasks:   make(map[string]*DownloadTask),
+		queue:   NewTaskQueue(),
+		active:  make(map[string]*DownloadTask),
+		cancels: make(map[string]context.CancelFunc),
+		events:  NewBroker(),
+		batches: make(map[string]*Batch),
+
+		allowedOrigins: []string{"chrome-extension://abc123"},
 	}
 	s.setupRoutes()
 	// Don't start queue worker in tests to avoid goroutine leaks
-	// (queue worker will block forever on empty channel)
+	// (queue worker will block forever on empty queue)
 	return s
 }
 
@@ -74,13 +87,14 @@ func TestHealthEndpoint_OPTIONS(t *testing.T) {
 
 	// OPTIONS is handled by CORS middleware and returns 200
 	req := httptest.NewRequest(http.MethodOptions, "/api/health", nil)
+	req.Header.Set("Origin", "chrome-extension://abc123")
 	w := httptest.NewRecorder()
 	s.mux.ServeHTTP(w, req)
 	if w.Code != http.StatusOK {
 		t.Errorf("expected 200 for OPTIONS (CORS preflight), got %d", w.Code)
 	}
-	if origin := w.Header().Get("Access-Control-Allow-Origin"); origin != "*" {
-		t.Errorf("expected Access-Control-Allow-Origin: *, got %q", origin)
+	if origin := w.Header().Get("Access-Control-Allow-Origin"); origin != "chrome-extension://abc123" {
+		t.Errorf("expected Access-Control-Allow-Origin: chrome-extension://abc123, got %q", origin)
 	}
 }
 
@@ -158,6 +172,192 @@ func TestDownloadEndpoint_WithConvert(t *testing.T) {
 	}
 }
 
+func TestDownloadEndpoint_Container(t *testing.T) {
+	s := newTestServer()
+
+	body := `{"url":"https://jable.tv/videos/test-789/","container":"mkv"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/download", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	s.mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+
+	var resp DownloadResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+
+	s.tasksMutex.RLock()
+	task := s.tasks[resp.TaskID]
+	s.tasksMutex.RUnlock()
+
+	if task.Container != "mkv" {
+		t.Errorf("expected Container=mkv, got %q", task.Container)
+	}
+}
+
+func TestDownloadEndpoint_InvalidContainer(t *testing.T) {
+	s := newTestServer()
+
+	body := `{"url":"https://jable.tv/videos/test-789/","container":"avi"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/download", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	s.mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+}
+
+func TestDownloadEndpoint_Profile(t *testing.T) {
+	s := newTestServer()
+
+	body := `{"url":"https://jable.tv/videos/test-789/","profile":"cpu"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/download", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	s.mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+
+	var resp DownloadResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+
+	s.tasksMutex.RLock()
+	task := s.tasks[resp.TaskID]
+	s.tasksMutex.RUnlock()
+
+	if task.Profile != "cpu" {
+		t.Errorf("expected Profile=cpu, got %q", task.Profile)
+	}
+}
+
+func TestDownloadEndpoint_UnknownProfile(t *testing.T) {
+	s := newTestServer()
+
+	body := `{"url":"https://jable.tv/videos/test-789/","profile":"no-such-profile"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/download", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	s.mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+}
+
+func TestDownloadEndpoint_InvalidPreview(t *testing.T) {
+	s := newTestServer()
+
+	body := `{"url":"https://jable.tv/videos/test-789/","sheet":true,"preview":"gif"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/download", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	s.mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+}
+
+func TestDownloadEndpoint_Options(t *testing.T) {
+	s := newTestServer()
+
+	body := `{"url":"https://jable.tv/videos/opt-001/","encode_mode":"GPU","quality":"720","output_dir":"library/jable/","range":"1:00-90","cover":false,"metadata":false}`
+	req := httptest.NewRequest(http.MethodPost, "/api/download", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	s.mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp DownloadResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+
+	s.tasksMutex.RLock()
+	task := s.tasks[resp.TaskID]
+	s.tasksMutex.RUnlock()
+
+	if task.EncodeMode != "gpu" || !task.Convert {
+		t.Errorf("expected encode mode gpu with convert, got %q, %v", task.EncodeMode, task.Convert)
+	}
+	if task.Quality != "720p" {
+		t.Errorf("expected Quality=720p, got %q", task.Quality)
+	}
+	if task.OutputDir != filepath.Join("library", "jable") {
+		t.Errorf("expected cleaned output dir, got %q", task.OutputDir)
+	}
+	if task.Range != "1m0s-1m30s" {
+		t.Errorf("expected normalized range, got %q", task.Range)
+	}
+	if task.Cover == nil || *task.Cover || task.Metadata == nil || *task.Metadata {
+		t.Errorf("expected cover and metadata disabled, got %v, %v", task.Cover, task.Metadata)
+	}
+}
+
+func TestDownloadEndpoint_DefaultOptions(t *testing.T) {
+	s := newTestServer()
+
+	body := `{"url":"https://jable.tv/videos/opt-002/","convert":true}`
+	req := httptest.NewRequest(http.MethodPost, "/api/download", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	s.mux.ServeHTTP(w, req)
+
+	var resp DownloadResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+
+	s.tasksMutex.RLock()
+	task := s.tasks[resp.TaskID]
+	s.tasksMutex.RUnlock()
+
+	if task == nil {
+		t.Fatalf("expected task, got %d: %s", w.Code, w.Body.String())
+	}
+	if task.EncodeMode != "fast" || task.Quality != "best" {
+		t.Errorf("expected fast/best defaults, got %q/%q", task.EncodeMode, task.Quality)
+	}
+	if task.OutputDir != "" || task.Range != "" || task.Cover != nil || task.Metadata != nil {
+		t.Errorf("expected unset options, got %+v", task)
+	}
+}
+
+func TestDownloadEndpoint_InvalidOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"encode mode", `{"url":"https://jable.tv/videos/test-789/","encode_mode":"hevc"}`},
+		{"quality", `{"url":"https://jable.tv/videos/test-789/","quality":"hd"}`},
+		{"absolute output dir", `{"url":"https://jable.tv/videos/test-789/","output_dir":"/etc"}`},
+		{"parent output dir", `{"url":"https://jable.tv/videos/test-789/","output_dir":"../outside"}`},
+		{"range", `{"url":"https://jable.tv/videos/test-789/","range":"20:00-10:00"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer()
+			req := httptest.NewRequest(http.MethodPost, "/api/download", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			s.mux.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected 400, got %d", w.Code)
+			}
+			if len(s.tasks) != 0 {
+				t.Errorf("expected no task, got %d", len(s.tasks))
+			}
+		})
+	}
+}
+
 func TestDownloadEndpoint_MissingURL(t *testing.T) {
 	s := newTestServer()
 
@@ -228,8 +428,8 @@ func TestTasksEndpoint_Empty(t *testing.T) {
 	if len(resp.Tasks) != 0 {
 		t.Errorf("expected 0 tasks, got %d", len(resp.Tasks))
 	}
-	if resp.CurrentTask != "" {
-		t.Errorf("expected empty current_task, got %q", resp.CurrentTask)
+	if len(resp.ActiveTasks) != 0 {
+		t.Errorf("expected no active_tasks, got %v", resp.ActiveTasks)
 	}
 }
 
@@ -272,6 +472,30 @@ func TestTasksEndpoint_WithTasks(t *testing.T) {
 	}
 }
 
+// 以 go test -race 執行時檢查列表與進度更新沒有資料競爭
+func TestTasksEndpoint_ConcurrentProgress(t *testing.T) {
+	s := newTestServer()
+	s.tasks["t1"] = &DownloadTask{ID: "t1", Status: StatusDownloading}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			s.updateTaskSegments("t1", crawler.Progress{Done: i, Total: 100})
+			s.updateTaskProgress("t1", ffmpeg.Progress{Percent: float64(i)})
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api/tasks", nil)
+		w := httptest.NewRecorder()
+		s.mux.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", w.Code)
+		}
+	}
+	<-done
+}
+
 func TestTasksEndpoint_MethodNotAllowed(t *testing.T) {
 	s := newTestServer()
 
@@ -357,17 +581,18 @@ func TestClearCompletedTasks_Post(t *testing.T) {
 func TestClearCompletedTasks_WithCurrentTask(t *testing.T) {
 	s := newTestServer()
 
-	// Set current task
-	s.currentMutex.Lock()
-	s.currentTask = &DownloadTask{ID: "current", URL: "https://jable.tv/current/"}
-	s.currentMutex.Unlock()
-
 	s.tasksMutex.Lock()
-	s.tasks["current"] = &DownloadTask{ID: "current", URL: "https://jable.tv/current/", Status: "downloading"}
+	s.tasks["current"] = &DownloadTask{ID: "current", URL: "https://jable.tv/current/", Status: "queued"}
 	s.tasks["old_completed"] = &DownloadTask{ID: "old_completed", URL: "https://jable.tv/done/", Status: "completed"}
 	s.tasks["old_failed"] = &DownloadTask{ID: "old_failed", URL: "https://jable.tv/fail/", Status: "failed"}
 	s.tasksMutex.Unlock()
 
+	// 由工作器開始處理
+	if _, ok := s.startTask(s.tasks["current"]); !ok {
+		t.Fatal("expected current task to start")
+	}
+	defer s.removeActiveTask("current")
+
 	req := httptest.NewRequest(http.MethodDelete, "/api/tasks/clear-completed", nil)
 	w := httptest.NewRecorder()
 
@@ -437,11 +662,12 @@ func TestCORSHeaders(t *testing.T) {
 
 	// Test CORS headers on health endpoint
 	req := httptest.NewRequest(http.MethodGet, "/api/health", nil)
+	req.Header.Set("Origin", "chrome-extension://abc123")
 	w := httptest.NewRecorder()
 	s.mux.ServeHTTP(w, req)
 
-	if origin := w.Header().Get("Access-Control-Allow-Origin"); origin != "*" {
-		t.Errorf("expected Access-Control-Allow-Origin: *, got %q", origin)
+	if origin := w.Header().Get("Access-Control-Allow-Origin"); origin != "chrome-extension://abc123" {
+		t.Errorf("expected Access-Control-Allow-Origin: chrome-extension://abc123, got %q", origin)
 	}
 	if methods := w.Header().Get("Access-Control-Allow-Methods"); methods == "" {
 		t.Error("expected Access-Control-Allow-Methods header")
@@ -461,8 +687,11 @@ func TestCORSPreflight(t *testing.T) {
 	if w.Code != http.StatusOK {
 		t.Errorf("expected 200 for OPTIONS preflight, got %d", w.Code)
 	}
-	if origin := w.Header().Get("Access-Control-Allow-Origin"); origin != "*" {
-		t.Errorf("expected Access-Control-Allow-Origin: *, got %q", origin)
+	if origin := w.Header().Get("Access-Control-Allow-Origin"); origin != "chrome-extension://abc123" {
+		t.Errorf("expected Access-Control-Allow-Origin: chrome-extension://abc123, got %q", origin)
+	}
+	if headers := w.Header().Get("Access-Control-Allow-Headers"); !strings.Contains(headers, "Authorization") {
+		t.Errorf("expected Authorization in Access-Control-Allow-Headers, got %q", headers)
 	}
 }
 
@@ -505,38 +734,54 @@ func TestTaskLifecycle(t *testing.T) {
 		t.Error("task not found in tasks list")
 	}
 
-	// 3. Update task status manually (simulating queue worker)
-	s.updateTaskStatus(taskID, "downloading")
+	// 3. Take the task from the queue like a worker
+	task, ok := s.queue.Pop()
+	if !ok || task.ID != taskID {
+		t.Fatalf("expected task %s in queue, got %+v", taskID, task)
+	}
+	if _, ok := s.startTask(task); !ok {
+		t.Fatal("expected queued task to start")
+	}
+	defer s.removeActiveTask(taskID)
 	s.tasksMutex.RLock()
-	if s.tasks[taskID].Status != "downloading" {
-		t.Errorf("expected 'downloading', got %q", s.tasks[taskID].Status)
+	if s.tasks[taskID].Status != "downloading" || s.tasks[taskID].StartedAt == nil {
+		t.Errorf("expected 'downloading' with start time, got %+v", s.tasks[taskID])
 	}
 	s.tasksMutex.RUnlock()
 
 	// 4. Mark as completed
-	s.updateTaskStatus(taskID, "completed")
+	s.finishTask(taskID, StatusCompleted, "")
 	s.tasksMutex.RLock()
-	if s.tasks[taskID].Status != "completed" {
-		t.Errorf("expected 'completed', got %q", s.tasks[taskID].Status)
+	if s.tasks[taskID].Status != "completed" || s.tasks[taskID].FinishedAt == nil {
+		t.Errorf("expected 'completed' with finish time, got %+v", s.tasks[taskID])
 	}
 	s.tasksMutex.RUnlock()
+
+	// 已結束的任務不能再開始
+	if _, ok := s.startTask(task); ok {
+		t.Error("completed task should not start again")
+	}
 }
 
-func TestUpdateTaskStatus_NonExistent(t *testing.T) {
+func TestFinishTask_NonExistent(t *testing.T) {
 	s := newTestServer()
 
 	// Should not panic
-	s.updateTaskStatus("nonexistent", "completed")
+	s.finishTask("nonexistent", StatusCompleted, "")
 }
 
-func TestUpdateTaskError(t *testing.T) {
+func TestFinishTask_Failed(t *testing.T) {
 	s := newTestServer()
 
 	s.tasksMutex.Lock()
-	s.tasks["err_task"] = &DownloadTask{ID: "err_task", Status: "downloading"}
+	s.tasks["err_task"] = &DownloadTask{ID: "err_task", Status: "queued"}
 	s.tasksMutex.Unlock()
 
-	s.updateTaskError("err_task", "something went wrong")
+	if _, ok := s.startTask(s.tasks["err_task"]); !ok {
+		t.Fatal("expected queued task to start")
+	}
+	defer s.removeActiveTask("err_task")
+	s.finishTask("err_task", StatusFailed, "something went wrong")
 
 	s.tasksMutex.RLock()
 	task := s.tasks["err_task"]
@@ -550,25 +795,99 @@ func TestUpdateTaskError(t *testing.T) {
 	}
 }
 
-func TestSetCurrentTask(t *testing.T) {
+func TestProcessTask_InvalidOptions(t *testing.T) {
+	s := newTestServer()
+
+	// 記錄檔中的任務未經 API 驗證，無效的選項在開始下載前就失敗
+	tasks := map[string]*DownloadTask{
+		"mode":    {ID: "mode", URL: "https://jable.tv/videos/abc-001/", Status: "queued", EncodeMode: "bogus"},
+		"range":   {ID: "range", URL: "https://jable.tv/videos/abc-002/", Status: "queued", Range: "abc"},
+		"profile": {ID: "profile", URL: "https://jable.tv/videos/abc-003/", Status: "queued", Profile: "nope"},
+	}
+	for id, task := range tasks {
+		s.tasks[id] = task
+		ctx, ok := s.startTask(task)
+		if !ok {
+			t.Fatalf("expected task %s to start", id)
+		}
+		s.processTask(ctx, task)
+		s.removeActiveTask(id)
+
+		if task.Status != StatusFailed || task.Error == "" {
+			t.Errorf("%s: expected failed task with error, got %+v", id, task)
+		}
+	}
+}
+
+func TestFinishTask_KeepsPausedStatus(t *testing.T) {
 	s := newTestServer()
 
-	task := &DownloadTask{ID: "current", Status: "downloading"}
-	s.setCurrentTask(task)
+	s.tasksMutex.Lock()
+	s.tasks["t1"] = &DownloadTask{ID: "t1", Status: "queued"}
+	s.tasksMutex.Unlock()
 
-	s.currentMutex.RLock()
-	if s.currentTask != task {
-		t.Error("currentTask should be set")
+	ctx, ok := s.startTask(s.tasks["t1"])
+	if !ok {
+		t.Fatal("expected queued task to start")
+	}
+	defer s.removeActiveTask("t1")
+	if _, err := s.applyAction("t1", ActionPause); err != nil {
+		t.Fatalf("pause failed: %v", err)
+	}
+	if ctx.Err() == nil {
+		t.Error("expected pausing to cancel the running task")
 	}
-	s.currentMutex.RUnlock()
 
-	// Set to nil
-	s.setCurrentTask(nil)
-	s.currentMutex.RLock()
-	if s.currentTask != nil {
-		t.Error("currentTask should be nil")
+	// 工作器在暫停後才回報失敗，狀態維持暫停
+	s.finishTask("t1", StatusFailed, "context canceled")
+	if task := s.tasks["t1"]; task.Status != StatusPaused || task.Error != "" {
+		t.Errorf("expected paused task to stay paused, got %+v", task)
+	}
+}
+
+func TestUpdateTaskProgress(t *testing.T) {
+	s := newTestServer()
+	s.tasks["task_1"] = &DownloadTask{ID: "task_1", Status: "downloading"}
+
+	s.updateTaskProgress("task_1", ffmpeg.Progress{Stage: "merging", Percent: 42})
+	s.updateTaskProgress("missing", ffmpeg.Progress{Percent: 10})
+
+	p := s.tasks["task_1"].Progress
+	if p == nil || p.Stage != "merging" || p.Percent != 42 {
+		t.Errorf("unexpected progress: %+v", p)
+	}
+}
+
+func TestActiveTasks(t *testing.T) {
+	s := newTestServer()
+
+	for _, id := range []string{"b", "a"} {
+		s.tasks[id] = &DownloadTask{ID: id, Status: "queued"}
+		if _, ok := s.startTask(s.tasks[id]); !ok {
+			t.Fatalf("expected task %s to start", id)
+		}
+	}
+
+	ids := s.activeTaskIDs()
+	if len(ids) != 2 || ids[0] != "a" || ids[1] != "b" {
+		t.Errorf("expected active tasks [a b], got %v", ids)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/tasks", nil)
+	w := httptest.NewRecorder()
+	s.mux.ServeHTTP(w, req)
+
+	var resp TasksResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if len(resp.ActiveTasks) != 2 {
+		t.Errorf("expected 2 active_tasks, got %v", resp.ActiveTasks)
+	}
+
+	s.removeActiveTask("a")
+	s.removeActiveTask("b")
+	if ids := s.activeTaskIDs(); len(ids) != 0 {
+		t.Errorf("expected no active tasks, got %v", ids)
 	}
-	s.currentMutex.RUnlock()
 }
 
 func TestSendError(t *testing.T) {
@@ -606,8 +925,43 @@ func TestNewServer(t *testing.T) {
 	if s.tasks == nil {
 		t.Error("tasks map should not be nil")
 	}
-	if cap(s.queue) != 100 {
-		t.Errorf("expected queue cap 100, got %d", cap(s.queue))
+	if s.queue == nil || s.queue.Len() != 0 {
+		t.Error("queue should be empty")
+	}
+	if s.workers != config.ServerWorkers {
+		t.Errorf("expected %d workers, got %d", config.ServerWorkers, s.workers)
+	}
+	if cap(s.limiter) != config.MaxWorkers {
+		t.Errorf("expected %d connections, got %d", config.MaxWorkers, cap(s.limiter))
+	}
+}
+
+func TestNewServerWithOptions(t *testing.T) {
+	s, err := NewServerWithOptions(9999, Options{Workers: 3, Connections: 12})
+	if err != nil {
+		t.Fatalf("NewServerWithOptions failed: %v", err)
+	}
+	if s.workers != 3 {
+		t.Errorf("expected 3 workers, got %d", s.workers)
+	}
+	if cap(s.limiter) != 12 {
+		t.Errorf("expected 12 connections, got %d", cap(s.limiter))
+	}
+}
+
+func TestNewServerWithOptions_NoOriginsByDefault(t *testing.T) {
+	s, err := NewServerWithOptions(0, Options{TasksFile: filepath.Join(t.TempDir(), "tasks.json")})
+	if err != nil {
+		t.Fatalf("NewServerWithOptions failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/health", nil)
+	req.Header.Set("Origin", "chrome-extension://abc123")
+	w := httptest.NewRecorder()
+	s.mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for extension origin by default, got %d", w.Code)
 	}
 }
 
@@ -651,3 +1005,124 @@ func TestLargeTaskQueue(t *testing.T) {
 		t.Logf("Got %d unique URLs out of %d submitted (expected due to nanosecond collisions)", len(urlSet), uniqueTasks)
 	}
 }
+
+func TestRestoreTasks(t *testing.T) {
+	s := newTestServer()
+
+	tasks := []*DownloadTask{
+		{ID: "queued", Status: "queued"},
+		{ID: "interrupted", Status: "downloading", Progress: &ffmpeg.Progress{Stage: "merging"},
+			Stage: "merging", SegmentsDone: 480, SegmentsTotal: 480, Bytes: 1 << 20, Speed: 1000, ETA: 12},
+		{ID: "done", Status: "completed"},
+		{ID: "failed", Status: "failed", Error: "boom"},
+	}
+
+	pending := s.restoreTasks(tasks)
+	if len(pending) != 2 || pending[0].ID != "queued" || pending[1].ID != "interrupted" {
+		t.Fatalf("expected queued and interrupted tasks to be resumed, got %v", pending)
+	}
+	if r := pending[1]; r.Status != "queued" || r.Progress != nil || r.Stage != "" || r.SegmentsDone != 0 ||
+		r.SegmentsTotal != 0 || r.Bytes != 0 || r.Speed != 0 || r.ETA != 0 || r.StartedAt != nil {
+		t.Errorf("interrupted task should be reset to queued, got %+v", r)
+	}
+	if len(s.tasks) != 4 {
+		t.Errorf("expected all 4 tasks restored, got %d", len(s.tasks))
+	}
+}
+
+func TestDownloadEndpoint_Duplicate(t *testing.T) {
+	s := newTestServer()
+
+	post := func(body string) DownloadResponse {
+		req := httptest.NewRequest(http.MethodPost, "/api/download", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		s.mux.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp DownloadResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		return resp
+	}
+
+	first := post(`{"url":"https://jable.tv/videos/dup-001/"}`)
+	for _, url := range []string{
+		"https://jable.tv/videos/dup-001",
+		"https://jable.tv/videos/DUP-001/?lang=en",
+		"https://en.jable.tv/videos/dup-001/#player",
+	} {
+		resp := post(`{"url":"` + url + `"}`)
+		if !resp.Duplicate || resp.TaskID != first.TaskID {
+			t.Errorf("%s: expected existing task %s, got %+v", url, first.TaskID, resp)
+		}
+	}
+	if len(s.tasks) != 1 || s.queue.Len() != 1 {
+		t.Errorf("expected a single queued task, got %d tasks, queue %d", len(s.tasks), s.queue.Len())
+	}
+
+	// 任務結束後可以再次下載
+	s.tasks[first.TaskID].Status = StatusFailed
+	if resp := post(`{"url":"https://jable.tv/videos/dup-001/"}`); resp.Duplicate || resp.TaskID == first.TaskID {
+		t.Errorf("expected a new task after the first one finished, got %+v", resp)
+	}
+}
+
+func TestDownloadEndpoint_AlreadyDownloaded(t *testing.T) {
+	t.Chdir(t.TempDir())
+	folder := filepath.Join("download", "have-001")
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(folder, "have-001.mp4"), []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/download", strings.NewReader(`{"url":"https://jable.tv/videos/have-001/"}`))
+	w := httptest.NewRecorder()
+	s.mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for a downloaded video, got %d", w.Code)
+	}
+	var resp DownloadResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if !resp.Success || !resp.AlreadyDownloaded || resp.TaskID != "" || filepath.Base(resp.OutputPath) != "have-001.mp4" {
+		t.Errorf("expected already_downloaded response with output path, got %+v", resp)
+	}
+	if len(s.tasks) != 0 {
+		t.Errorf("expected no task, got %d", len(s.tasks))
+	}
+
+	// 其他封裝格式尚未下載
+	req = httptest.NewRequest(http.MethodPost, "/api/download", strings.NewReader(`{"url":"https://jable.tv/videos/have-001/","container":"mkv"}`))
+	w = httptest.NewRecorder()
+	s.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200 for a different container, got %d", w.Code)
+	}
+	s.tasks = make(map[string]*DownloadTask)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/download", strings.NewReader(`{"url":"https://jable.tv/videos/have-001/","force":true}`))
+	w = httptest.NewRecorder()
+	s.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 with force, got %d", w.Code)
+	}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if task := s.tasks[resp.TaskID]; task == nil || !task.Force {
+		t.Errorf("expected forced task, got %+v", task)
+	}
+}
+
+func TestDownloadEndpoint_InvalidURL(t *testing.T) {
+	s := newTestServer()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/download", strings.NewReader(`{"url":"not-a-url"}`))
+	w := httptest.NewRecorder()
+	s.mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid URL, got %d", w.Code)
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+// TaskStatus 任務狀態
+type TaskStatus string
+
+const (
+	StatusQueued      TaskStatus = "queued"      // 等待處理
+	StatusDownloading TaskStatus = "downloading" // 處理中，包含下載、合成與轉檔
+	StatusPaused      TaskStatus = "paused"      // 已暫停，恢復後略過已下載的片段繼續
+	StatusCancelled   TaskStatus = "cancelled"   // 已取消，可重試
+	StatusCompleted   TaskStatus = "completed"   // 已完成
+	StatusFailed      TaskStatus = "failed"      // 失敗，可重試
+)
+
+// transitions 每個狀態允許轉換到的狀態
+var transitions = map[TaskStatus][]TaskStatus{
+	StatusQueued:      {StatusDownloading, StatusPaused, StatusCancelled},
+	StatusDownloading: {StatusCompleted, StatusFailed, StatusPaused, StatusCancelled},
+	StatusPaused:      {StatusQueued, StatusCancelled},
+	StatusCancelled:   {StatusQueued},
+	StatusFailed:      {StatusQueued},
+	StatusCompleted:   nil,
+}
+
+// CanTransition 是否可以從 s 轉換到 to
+func (s TaskStatus) CanTransition(to TaskStatus) bool {
+	for _, next := range transitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Finished 任務是否已結束（完成、失敗或取消）
+func (s TaskStatus) Finished() bool {
+	return s == StatusCompleted || s == StatusFailed || s == StatusCancelled
+}
+
+// TaskAction 使用者對任務的操作
+type TaskAction string
+
+const (
+	ActionCancel TaskAction = "cancel" // 排隊中、處理中或暫停 → 取消
+	ActionPause  TaskAction = "pause"  // 排隊中或處理中 → 暫停
+	ActionResume TaskAction = "resume" // 暫停 → 排隊中
+	ActionRetry  TaskAction = "retry"  // 失敗或取消 → 排隊中
+)
+
+// Target 回傳操作後的狀態，from 不允許此操作時回傳 false
+func (a TaskAction) Target(from TaskStatus) (TaskStatus, bool) {
+	var to TaskStatus
+	switch a {
+	case ActionCancel:
+		to = StatusCancelled
+	case ActionPause:
+		to = StatusPaused
+	case ActionResume:
+		if from != StatusPaused {
+			return "", false
+		}
+		to = StatusQueued
+	case ActionRetry:
+		if from != StatusFailed && from != StatusCancelled {
+			return "", false
+		}
+		to = StatusQueued
+	default:
+		return "", false
+	}
+	return to, from.CanTransition(to)
+}
@@ -0,0 +1,52 @@
+package server
+
+import "testing"
+
+func TestTaskStatus_CanTransition(t *testing.T) {
+	tests := []struct {
+		from, to TaskStatus
+		want     bool
+	}{
+		{StatusQueued, StatusDownloading, true},
+		{StatusQueued, StatusPaused, true},
+		{StatusDownloading, StatusCompleted, true},
+		{StatusDownloading, StatusCancelled, true},
+		{StatusPaused, StatusQueued, true},
+		{StatusFailed, StatusQueued, true},
+		{StatusCompleted, StatusQueued, false},
+		{StatusPaused, StatusDownloading, false},
+		{StatusCancelled, StatusPaused, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.from.CanTransition(tt.to); got != tt.want {
+			t.Errorf("%s -> %s: expected %v, got %v", tt.from, tt.to, tt.want, got)
+		}
+	}
+}
+
+func TestTaskAction_Target(t *testing.T) {
+	tests := []struct {
+		action TaskAction
+		from   TaskStatus
+		want   TaskStatus
+		ok     bool
+	}{
+		{ActionPause, StatusDownloading, StatusPaused, true},
+		{ActionCancel, StatusPaused, StatusCancelled, true},
+		{ActionResume, StatusPaused, StatusQueued, true},
+		{ActionRetry, StatusFailed, StatusQueued, true},
+		{ActionRetry, StatusCancelled, StatusQueued, true},
+		{ActionResume, StatusFailed, "", false},
+		{ActionRetry, StatusPaused, "", false},
+		{ActionCancel, StatusCompleted, StatusCancelled, false},
+		{TaskAction("restart"), StatusFailed, "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := tt.action.Target(tt.from)
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("%s from %s: expected (%q, %v), got (%q, %v)", tt.action, tt.from, tt.want, tt.ok, got, ok)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Store 以 write-ahead JSON log 保存任務，每次變更附加一行記錄
+// 開啟時重播記錄取得最新狀態，並壓縮成每個任務一行
+type Store struct {
+	path    string
+	file    *os.File
+	mu      sync.Mutex
+	batches []*Batch // 開啟時載入的批次
+}
+
+// storeRecord 記錄檔中的一行，Task 為新增或更新，Delete 為刪除的任務 ID，Batch 為新增或更新的批次
+type storeRecord struct {
+	Task   *DownloadTask `json:"task,omitempty"`
+	Delete string        `json:"delete,omitempty"`
+	Batch  *Batch        `json:"batch,omitempty"`
+}
+
+// OpenStore 開啟任務記錄檔並回傳其中的任務（依建立時間排序），檔案不存在時建立新檔
+// 批次可由 Batches 取得，壓縮時移除任務都已刪除的批次（從未建立任務的批次保留）
+func OpenStore(path string) (*Store, []*DownloadTask, error) {
+	tasks, batches, err := replayStore(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	list := make([]*DownloadTask, 0, len(tasks))
+	for _, task := range tasks {
+		list = append(list, task)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+
+	var batchList []*Batch
+	for _, batch := range batches {
+		if batch.keep(tasks) {
+			batchList = append(batchList, batch)
+		}
+	}
+	sort.Slice(batchList, func(i, j int) bool {
+		return batchList[i].CreatedAt.Before(batchList[j].CreatedAt)
+	})
+
+	if err := compactStore(path, list, batchList); err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("無法開啟任務記錄檔: %v", err)
+	}
+	return &Store{path: path, file: file, batches: batchList}, list, nil
+}
+
+// Batches 回傳開啟時載入的批次（依建立時間排序），s 為 nil 時回傳 nil
+func (s *Store) Batches() []*Batch {
+	if s == nil {
+		return nil
+	}
+	return s.batches
+}
+
+// replayStore 依序套用記錄檔中的每一行，無法解析的行（例如寫入中斷）會被略過
+func replayStore(path string) (map[string]*DownloadTask, map[string]*Batch, error) {
+	tasks := make(map[string]*DownloadTask)
+	batches := make(map[string]*Batch)
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return tasks, batches, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("無法讀取任務記錄檔: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec storeRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			log.Printf("略過無法解析的任務記錄 %s:%d: %v", path, line, err)
+			continue
+		}
+		if rec.Delete != "" {
+			delete(tasks, rec.Delete)
+		}
+		if rec.Task != nil && rec.Task.ID != "" {
+			tasks[rec.Task.ID] = rec.Task
+		}
+		if rec.Batch != nil && rec.Batch.ID != "" {
+			batches[rec.Batch.ID] = rec.Batch
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("無法讀取任務記錄檔: %v", err)
+	}
+	return tasks, batches, nil
+}
+
+// compactStore 將目前的任務與批次寫入暫存檔後取代記錄檔
+func compactStore(path string, tasks []*DownloadTask, batches []*Batch) error {
+	tempPath := path + ".tmp"
+	file, err := os.Create(tempPath)
+	if err != nil {
+		return fmt.Errorf("無法寫入任務記錄檔: %v", err)
+	}
+
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	records := make([]storeRecord, 0, len(tasks)+len(batches))
+	for _, task := range tasks {
+		records = append(records, storeRecord{Task: task})
+	}
+	for _, batch := range batches {
+		records = append(records, storeRecord{Batch: batch})
+	}
+	for _, rec := range records {
+		if err := enc.Encode(rec); err != nil {
+			file.Close()
+			os.Remove(tempPath)
+			return fmt.Errorf("無法寫入任務記錄檔: %v", err)
+		}
+	}
+	if err := w.Flush(); err == nil {
+		err = file.Sync()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("無法寫入任務記錄檔: %v", err)
+	}
+	return os.Rename(tempPath, path)
+}
+
+// Put 記錄任務的最新狀態，s 為 nil 時不做任何事
+func (s *Store) Put(task *DownloadTask) error {
+	if s == nil {
+		return nil
+	}
+	return s.append(storeRecord{Task: task})
+}
+
+// Delete 記錄刪除任務，s 為 nil 時不做任何事
+func (s *Store) Delete(taskID string) error {
+	if s == nil {
+		return nil
+	}
+	return s.append(storeRecord{Delete: taskID})
+}
+
+// PutBatch 記錄批次的最新狀態，s 為 nil 時不做任何事
+func (s *Store) PutBatch(batch *Batch) error {
+	if s == nil {
+		return nil
+	}
+	return s.append(storeRecord{Batch: batch})
+}
+
+func (s *Store) append(rec storeRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("無法寫入任務記錄: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("無法寫入任務記錄: %v", err)
+	}
+	return s.file.Sync()
+}
+
+// Close 關閉記錄檔
+func (s *Store) Close() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
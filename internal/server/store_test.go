@@ -0,0 +1,151 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStore_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.jsonl")
+
+	store, tasks, err := OpenStore(path)
+	if err != nil {
+		t.Fatalf("OpenStore failed: %v", err)
+	}
+	if len(tasks) != 0 {
+		t.Fatalf("expected no tasks, got %d", len(tasks))
+	}
+
+	now := time.Now()
+	a := &DownloadTask{ID: "a", URL: "https://jable.tv/videos/a/", Status: "queued", CreatedAt: now}
+	b := &DownloadTask{ID: "b", URL: "https://jable.tv/videos/b/", Status: "queued", CreatedAt: now.Add(time.Second)}
+	c := &DownloadTask{ID: "c", URL: "https://jable.tv/videos/c/", Status: "queued", CreatedAt: now.Add(2 * time.Second)}
+	for _, task := range []*DownloadTask{c, a, b} {
+		if err := store.Put(task); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	a.Status = "completed"
+	store.Put(a)
+	store.Delete("c")
+	store.Close()
+
+	store, tasks, err = OpenStore(path)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer store.Close()
+
+	if len(tasks) != 2 || tasks[0].ID != "a" || tasks[1].ID != "b" {
+		t.Fatalf("expected tasks [a b] sorted by creation time, got %+v", tasks)
+	}
+	if tasks[0].Status != "completed" {
+		t.Errorf("expected latest status completed, got %q", tasks[0].Status)
+	}
+}
+
+func TestStore_SkipsTruncatedLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.jsonl")
+	data := `{"task":{"id":"a","url":"https://jable.tv/videos/a/","status":"downloading"}}
+{"task":{"id":"b","url":"https://jab`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store, tasks, err := OpenStore(path)
+	if err != nil {
+		t.Fatalf("OpenStore failed: %v", err)
+	}
+	defer store.Close()
+
+	if len(tasks) != 1 || tasks[0].ID != "a" {
+		t.Fatalf("expected only task a, got %+v", tasks)
+	}
+
+	// 開啟時壓縮記錄檔，中斷的行會被移除
+	content, _ := os.ReadFile(path)
+	if want := `{"task":{"id":"a"`; len(content) == 0 || string(content[:len(want)]) != want {
+		t.Errorf("unexpected compacted log: %s", content)
+	}
+}
+
+func TestStore_Nil(t *testing.T) {
+	var s *Store
+	if err := s.Put(&DownloadTask{ID: "a"}); err != nil {
+		t.Errorf("nil store Put should be a no-op, got %v", err)
+	}
+	if err := s.Delete("a"); err != nil {
+		t.Errorf("nil store Delete should be a no-op, got %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("nil store Close should be a no-op, got %v", err)
+	}
+}
+
+func TestNewServerWithOptions_TasksFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.jsonl")
+	data := `{"task":{"id":"paused","url":"https://jable.tv/videos/paused/","status":"paused"}}
+`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewServerWithOptions(0, Options{TasksFile: path})
+	if err != nil {
+		t.Fatalf("NewServerWithOptions failed: %v", err)
+	}
+
+	if task, ok := s.tasks["paused"]; !ok || task.Status != "paused" {
+		t.Fatalf("expected paused task to be restored, got %+v", s.tasks)
+	}
+
+	if _, err := s.applyAction("paused", ActionCancel); err != nil {
+		t.Fatalf("cancel failed: %v", err)
+	}
+	s.Close()
+
+	store, tasks, err := OpenStore(path)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	store.Close()
+	if len(tasks) != 1 || tasks[0].Status != "cancelled" || tasks[0].FinishedAt == nil {
+		t.Errorf("expected persisted status cancelled, got %+v", tasks)
+	}
+}
+
+func TestStore_Batches(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.jsonl")
+
+	store, _, err := OpenStore(path)
+	if err != nil {
+		t.Fatalf("OpenStore failed: %v", err)
+	}
+	now := time.Now()
+	store.Put(&DownloadTask{ID: "a", Status: "queued", CreatedAt: now})
+	store.PutBatch(&Batch{ID: "keep", CreatedAt: now, TaskIDs: []string{"a"}})
+	store.PutBatch(&Batch{ID: "empty", CreatedAt: now, TaskIDs: []string{"gone"}})
+	store.PutBatch(&Batch{ID: "expanding", CreatedAt: now.Add(time.Second), Expanding: true})
+	store.PutBatch(&Batch{ID: "skipped", CreatedAt: now.Add(2 * time.Second), Skipped: []BatchSkip{{URL: "x", Reason: "invalid"}}})
+	store.Close()
+
+	store, _, err = OpenStore(path)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer store.Close()
+
+	// 任務都已刪除的批次在壓縮時移除，沒有建立任務的批次保留 skipped
+	batches := store.Batches()
+	if len(batches) != 3 || batches[0].ID != "keep" || batches[1].ID != "expanding" || batches[2].ID != "skipped" {
+		t.Fatalf("expected batches [keep expanding skipped], got %+v", batches)
+	}
+	if len(batches[2].Skipped) != 1 {
+		t.Errorf("expected skipped list to be kept, got %+v", batches[2])
+	}
+	if len(batches[0].TaskIDs) != 1 || batches[0].TaskIDs[0] != "a" {
+		t.Errorf("unexpected task IDs: %v", batches[0].TaskIDs)
+	}
+}
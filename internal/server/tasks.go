@@ -0,0 +1,171 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/jable-downloader-go/internal/downloader"
+)
+
+var errTaskNotFound = errors.New("Task not found")
+
+// handleTask GET 取得單一任務，DELETE 刪除任務（處理中的任務會先停止）
+func (s *Server) handleTask(w http.ResponseWriter, r *http.Request) {
+	taskID := r.PathValue("id")
+
+	switch r.Method {
+	case http.MethodGet:
+		s.tasksMutex.RLock()
+		task, ok := s.tasks[taskID]
+		var snapshot DownloadTask
+		if ok {
+			snapshot = *task
+		}
+		s.tasksMutex.RUnlock()
+
+		if !ok {
+			s.sendError(w, errTaskNotFound.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(snapshot)
+
+	case http.MethodDelete:
+		if err := s.deleteTask(taskID); err != nil {
+			s.sendError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		s.sendSuccess(w, "Task deleted", taskID)
+		log.Printf("Deleted task %s", taskID)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleTaskAction POST /api/tasks/{id}/cancel|pause|resume|retry
+func (s *Server) handleTaskAction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	taskID := r.PathValue("id")
+	action := TaskAction(r.PathValue("action"))
+
+	status, err := s.applyAction(taskID, action)
+	switch {
+	case errors.Is(err, errTaskNotFound):
+		s.sendError(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		s.sendError(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	s.sendSuccess(w, fmt.Sprintf("Task %s", status), taskID)
+	log.Printf("Task %s: %s -> %s", taskID, action, status)
+}
+
+// applyAction 依操作轉換任務狀態
+// 暫停或取消處理中的任務時停止下載與 FFmpeg，恢復或重試時重新加入隊列
+func (s *Server) applyAction(taskID string, action TaskAction) (TaskStatus, error) {
+	switch action {
+	case ActionCancel, ActionPause, ActionResume, ActionRetry:
+	default:
+		return "", fmt.Errorf("Unknown action: %s", action)
+	}
+
+	s.tasksMutex.Lock()
+	task, ok := s.tasks[taskID]
+	if !ok {
+		s.tasksMutex.Unlock()
+		return "", errTaskNotFound
+	}
+
+	to, ok := action.Target(task.Status)
+	if !ok {
+		from := task.Status
+		s.tasksMutex.Unlock()
+		return "", fmt.Errorf("Cannot %s a %s task", action, from)
+	}
+	if to == StatusQueued {
+		code, _ := downloader.VideoCode(task.URL)
+		if other := s.unfinishedTask(code, taskID); other != nil {
+			s.tasksMutex.Unlock()
+			return "", fmt.Errorf("Task %s for the same video is already %s", other.ID, other.Status)
+		}
+	}
+
+	task.Status = to
+	switch {
+	case to == StatusQueued:
+		task.resetProgress()
+	case to.Finished():
+		task.finish()
+	}
+	s.persist(task)
+	s.publishStatus(task)
+	s.tasksMutex.Unlock()
+
+	if to == StatusQueued {
+		s.queue.Push(task)
+	} else {
+		s.queue.Remove(taskID)
+		s.stopActiveTask(taskID)
+	}
+	return to, nil
+}
+
+// unfinishedTask 回傳同一番號尚未結束（排隊中、處理中或暫停）的任務，略過 exceptID
+// 番號不分大小寫，呼叫者需持有 tasksMutex
+func (s *Server) unfinishedTask(code, exceptID string) *DownloadTask {
+	if code == "" {
+		return nil
+	}
+	for id, task := range s.tasks {
+		if id == exceptID || task.Status.Finished() {
+			continue
+		}
+		if other, err := downloader.VideoCode(task.URL); err == nil && strings.EqualFold(other, code) {
+			return task
+		}
+	}
+	return nil
+}
+
+// deleteTask 刪除任務，處理中的任務會先停止
+func (s *Server) deleteTask(taskID string) error {
+	s.tasksMutex.Lock()
+	defer s.tasksMutex.Unlock()
+
+	task, ok := s.tasks[taskID]
+	if !ok {
+		return errTaskNotFound
+	}
+	delete(s.tasks, taskID)
+	s.queue.Remove(taskID)
+	s.pruneBatches()
+	s.events.Publish(EventDeleted, task)
+	if err := s.store.Delete(taskID); err != nil {
+		log.Printf("Failed to delete task %s: %v", taskID, err)
+	}
+	s.stopActiveTask(taskID)
+	return nil
+}
+
+// sendSuccess 發送成功響應
+func (s *Server) sendSuccess(w http.ResponseWriter, message, taskID string) {
+	response := DownloadResponse{
+		Success: true,
+		Message: message,
+		TaskID:  taskID,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,256 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jable-downloader-go/internal/crawler"
+	"github.com/jable-downloader-go/internal/ffmpeg"
+)
+
+func TestTaskEndpoint_Get(t *testing.T) {
+	s := newTestServer()
+	s.tasks["t1"] = &DownloadTask{ID: "t1", URL: "https://jable.tv/videos/t1/", Status: StatusQueued}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/tasks/t1", nil)
+	w := httptest.NewRecorder()
+	s.mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var task DownloadTask
+	json.NewDecoder(w.Body).Decode(&task)
+	if task.ID != "t1" || task.Status != StatusQueued {
+		t.Errorf("unexpected task: %+v", task)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/tasks/missing", nil)
+	w = httptest.NewRecorder()
+	s.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestTaskEndpoint_Delete(t *testing.T) {
+	s := newTestServer()
+	task := &DownloadTask{ID: "t1", Status: StatusQueued}
+	s.tasks["t1"] = task
+	ctx, ok := s.startTask(task)
+	if !ok {
+		t.Fatal("startTask should start a queued task")
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/tasks/t1", nil)
+	w := httptest.NewRecorder()
+	s.mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if _, ok := s.tasks["t1"]; ok {
+		t.Error("task should be deleted")
+	}
+	if ctx.Err() == nil {
+		t.Error("deleting a running task should cancel it")
+	}
+}
+
+func TestTaskAction_PauseQueued(t *testing.T) {
+	s := newTestServer()
+	task := &DownloadTask{ID: "t1", Status: StatusQueued}
+	s.tasks["t1"] = task
+	s.queue.Push(task)
+
+	w := postAction(s, "t1", "pause")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if task.Status != StatusPaused {
+		t.Errorf("expected paused, got %s", task.Status)
+	}
+	if s.queue.Len() != 0 {
+		t.Errorf("paused task should leave the queue, got queue %d", s.queue.Len())
+	}
+
+	// 仍在隊列中的暫停任務不會被處理
+	if _, ok := s.startTask(task); ok {
+		t.Error("paused task should not start")
+	}
+
+	w = postAction(s, "t1", "resume")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if task.Status != StatusQueued || s.queue.Len() != 1 {
+		t.Errorf("expected task re-queued, got status %s, queue %d", task.Status, s.queue.Len())
+	}
+}
+
+func TestTaskAction_CancelRunning(t *testing.T) {
+	s := newTestServer()
+	task := &DownloadTask{ID: "t1", Status: StatusQueued}
+	s.tasks["t1"] = task
+	ctx, _ := s.startTask(task)
+
+	w := postAction(s, "t1", "cancel")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if ctx.Err() == nil {
+		t.Error("cancel should stop the running task")
+	}
+
+	// 工作器結束時不會覆寫取消狀態
+	s.finishTask("t1", StatusFailed, "context canceled")
+	if task.Status != StatusCancelled || task.Error != "" {
+		t.Errorf("expected cancelled task, got %s %q", task.Status, task.Error)
+	}
+}
+
+func TestTaskAction_ResumeBeforeRunStops(t *testing.T) {
+	s := newTestServer()
+	task := &DownloadTask{ID: "t1", Status: StatusQueued}
+	s.tasks["t1"] = task
+	oldCtx, _ := s.startTask(task)
+
+	if _, err := s.applyAction("t1", ActionPause); err != nil {
+		t.Fatalf("pause failed: %v", err)
+	}
+	if _, err := s.applyAction("t1", ActionResume); err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+
+	// 上一次處理尚未結束，其他工作器不能開始同一個任務
+	popped, _ := s.queue.Pop()
+	if _, ok := s.startTask(popped); ok {
+		t.Fatal("task should not start while the previous run is still active")
+	}
+	if task.Status != StatusQueued {
+		t.Errorf("expected task to stay queued, got %s", task.Status)
+	}
+
+	// 上一次處理結束後重新加入隊列，新的處理不受影響
+	if oldCtx.Err() == nil {
+		t.Error("pause should cancel the previous run")
+	}
+	s.removeActiveTask("t1")
+	popped, ok := s.queue.Pop()
+	if !ok || popped != task {
+		t.Fatalf("expected task re-queued after the previous run, got %+v", popped)
+	}
+	ctx, ok := s.startTask(popped)
+	if !ok {
+		t.Fatal("expected task to start after the previous run")
+	}
+	defer s.removeActiveTask("t1")
+	if ctx.Err() != nil || task.Status != StatusDownloading {
+		t.Errorf("expected a live run, got status %s, ctx err %v", task.Status, ctx.Err())
+	}
+}
+
+func TestTaskAction_Retry(t *testing.T) {
+	s := newTestServer()
+	task := &DownloadTask{ID: "t1", Status: StatusFailed, Error: "boom", Warnings: []string{"x"}}
+	s.tasks["t1"] = task
+
+	w := postAction(s, "t1", "retry")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if task.Status != StatusQueued || task.Error != "" || task.Warnings != nil {
+		t.Errorf("retry should reset the task, got %+v", task)
+	}
+	if s.queue.Len() != 1 {
+		t.Errorf("expected task re-queued, got queue %d", s.queue.Len())
+	}
+}
+
+func TestTaskAction_Invalid(t *testing.T) {
+	s := newTestServer()
+	s.tasks["done"] = &DownloadTask{ID: "done", Status: StatusCompleted}
+
+	if w := postAction(s, "done", "pause"); w.Code != http.StatusConflict {
+		t.Errorf("expected 409 for pausing a completed task, got %d", w.Code)
+	}
+	if w := postAction(s, "done", "restart"); w.Code != http.StatusConflict {
+		t.Errorf("expected 409 for unknown action, got %d", w.Code)
+	}
+	if w := postAction(s, "missing", "cancel"); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown task, got %d", w.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/tasks/done/cancel", nil)
+	w := httptest.NewRecorder()
+	s.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", w.Code)
+	}
+}
+
+func postAction(s *Server, taskID, action string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/tasks/"+taskID+"/"+action, nil)
+	w := httptest.NewRecorder()
+	s.mux.ServeHTTP(w, req)
+	return w
+}
+
+func TestTaskProgressFields(t *testing.T) {
+	s := newTestServer()
+	task := &DownloadTask{ID: "t1", Status: StatusQueued}
+	s.tasks["t1"] = task
+
+	if _, ok := s.startTask(task); !ok {
+		t.Fatal("startTask should start a queued task")
+	}
+	if task.StartedAt == nil || task.FinishedAt != nil {
+		t.Errorf("expected started_at set and finished_at empty, got %v %v", task.StartedAt, task.FinishedAt)
+	}
+
+	s.updateTaskStage("t1", "downloading")
+	s.updateTaskSegments("t1", crawler.Progress{Done: 5, Total: 20, Bytes: 5000, Speed: 1000, ETA: 15})
+	if task.Stage != "downloading" || task.SegmentsDone != 5 || task.SegmentsTotal != 20 || task.Bytes != 5000 || task.Speed != 1000 || task.ETA != 15 {
+		t.Errorf("unexpected download progress: %+v", task)
+	}
+
+	// 進入下一個階段時清除片段下載速度
+	s.updateTaskStage("t1", "merging")
+	if task.Stage != "merging" || task.Speed != 0 || task.ETA != 0 {
+		t.Errorf("expected speed reset on stage change, got %+v", task)
+	}
+	s.updateTaskProgress("t1", ffmpeg.Progress{Stage: "merging", Percent: 50, ETA: 4 * time.Second})
+	if task.ETA != 4 {
+		t.Errorf("expected FFmpeg ETA 4s, got %v", task.ETA)
+	}
+
+	s.updateTaskOutput("t1", "/download/t1/t1.mp4")
+	s.finishTask("t1", StatusCompleted, "")
+	if task.FinishedAt == nil || task.OutputPath != "/download/t1/t1.mp4" || task.SegmentsDone != 5 {
+		t.Errorf("unexpected finished task: %+v", task)
+	}
+
+	// 重試時清除上一次的進度
+	task.Status = StatusFailed
+	postAction(s, "t1", "retry")
+	if task.Stage != "" || task.SegmentsDone != 0 || task.StartedAt != nil || task.FinishedAt != nil {
+		t.Errorf("retry should reset progress, got %+v", task)
+	}
+}
+
+func TestTaskAction_RetryDuplicate(t *testing.T) {
+	s := newTestServer()
+	s.tasks["old"] = &DownloadTask{ID: "old", URL: "https://jable.tv/videos/abc-123/", Status: StatusFailed}
+	s.tasks["new"] = &DownloadTask{ID: "new", URL: "https://jable.tv/videos/abc-123", Status: StatusDownloading}
+
+	w := postAction(s, "old", "retry")
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected 409 when the same video is already running, got %d", w.Code)
+	}
+	if s.tasks["old"].Status != StatusFailed {
+		t.Errorf("expected task to stay failed, got %s", s.tasks["old"].Status)
+	}
+}
@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// VideoInfo 從影片頁面解析出的資訊，用於寫入影片標籤
+type VideoInfo struct {
+	Title     string   `json:"title,omitempty"`
+	Actresses []string `json:"actresses,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	Date      string   `json:"date,omitempty"` // 上市日期，例如 2020-05-01
+}
+
+var datePattern = regexp.MustCompile(`\d{4}-\d{2}-\d{2}`)
+
+// ParseVideoInfo 解析影片頁面的標題、演員、標籤與上市日期
+func ParseVideoInfo(htmlContent string) (*VideoInfo, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlContent))
+	if err != nil {
+		return nil, err
+	}
+
+	info := &VideoInfo{}
+
+	info.Title = strings.TrimSpace(doc.Find(".header-left h4").First().Text())
+	if info.Title == "" {
+		info.Title, _ = doc.Find(`meta[property="og:title"]`).Attr("content")
+		info.Title = strings.TrimSpace(info.Title)
+	}
+
+	// 演員名稱放在頭像的 title 屬性，沒有頭像時使用文字
+	doc.Find(".models a.model").Each(func(i int, s *goquery.Selection) {
+		name, ok := s.Find("[title]").First().Attr("title")
+		if !ok {
+			name = s.Text()
+		}
+		info.Actresses = appendUnique(info.Actresses, strings.TrimSpace(name))
+	})
+
+	doc.Find(".tags a").Each(func(i int, s *goquery.Selection) {
+		info.Tags = appendUnique(info.Tags, strings.TrimSpace(s.Text()))
+	})
+
+	doc.Find(".header-left h6").EachWithBreak(func(i int, s *goquery.Selection) bool {
+		info.Date = datePattern.FindString(s.Text())
+		return info.Date == ""
+	})
+
+	return info, nil
+}
+
+// Metadata 轉為 FFmpeg 的 -metadata 標籤，sourceURL 寫入 comment
+func (v *VideoInfo) Metadata(sourceURL string) map[string]string {
+	metadata := make(map[string]string)
+	set := func(key, value string) {
+		if value != "" {
+			metadata[key] = value
+		}
+	}
+
+	if v != nil {
+		set("title", v.Title)
+		set("artist", strings.Join(v.Actresses, ", "))
+		set("genre", strings.Join(v.Tags, ", "))
+		set("date", v.Date)
+	}
+	set("comment", sourceURL)
+	return metadata
+}
+
+func appendUnique(list []string, value string) []string {
+	if value == "" {
+		return list
+	}
+	for _, v := range list {
+		if v == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
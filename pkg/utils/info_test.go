@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+const sampleVideoPage = `<html><head>
+<meta property="og:title" content="IPX-486 og title">
+</head><body>
+<div class="header-left">
+  <h4>IPX-486 測試影片標題</h4>
+  <h6><span class="mr-3">上市於 2020-05-01</span><span>觀看 12345</span></h6>
+</div>
+<div class="models">
+  <a class="model" href="https://jable.tv/models/a/"><img class="avatar" title="相澤南" src="a.jpg"></a>
+  <a class="model" href="https://jable.tv/models/b/"><span class="placeholder" title="桃乃木香奈">桃</span></a>
+  <a class="model" href="https://jable.tv/models/a/"><img title="相澤南" src="a.jpg"></a>
+</div>
+<h5 class="tags">
+  <a href="/categories/a/">角色劇情</a>
+  <a href="/tags/b/">制服</a>
+</h5>
+</body></html>`
+
+func TestParseVideoInfo(t *testing.T) {
+	info, err := ParseVideoInfo(sampleVideoPage)
+	if err != nil {
+		t.Fatalf("ParseVideoInfo failed: %v", err)
+	}
+
+	want := &VideoInfo{
+		Title:     "IPX-486 測試影片標題",
+		Actresses: []string{"相澤南", "桃乃木香奈"},
+		Tags:      []string{"角色劇情", "制服"},
+		Date:      "2020-05-01",
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("ParseVideoInfo() = %+v, want %+v", info, want)
+	}
+}
+
+func TestParseVideoInfo_OGTitleFallback(t *testing.T) {
+	info, _ := ParseVideoInfo(`<meta property="og:title" content=" IPX-486 og title ">`)
+	if info.Title != "IPX-486 og title" {
+		t.Errorf("expected og:title fallback, got %q", info.Title)
+	}
+}
+
+func TestVideoInfoMetadata(t *testing.T) {
+	info := &VideoInfo{Title: "T", Actresses: []string{"A", "B"}, Tags: []string{"x"}, Date: "2020-05-01"}
+
+	got := info.Metadata("https://jable.tv/videos/ipx-486/")
+	want := map[string]string{
+		"title":   "T",
+		"artist":  "A, B",
+		"genre":   "x",
+		"date":    "2020-05-01",
+		"comment": "https://jable.tv/videos/ipx-486/",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Metadata() = %v, want %v", got, want)
+	}
+
+	// 沒有影片資訊時只寫入來源網址
+	var empty *VideoInfo
+	if got := empty.Metadata("u"); !reflect.DeepEqual(got, map[string]string{"comment": "u"}) {
+		t.Errorf("nil Metadata() = %v", got)
+	}
+}
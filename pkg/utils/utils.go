@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -127,14 +128,68 @@ func FileExists(path string) bool {
 	return err == nil
 }
 
-func DeleteFiles(folderPath string, except string) error {
-	files, err := os.ReadDir(folderPath)
+// ParseSize 解析檔案大小，例如 "3900M"、"4G"、"1048576"（K/M/G 以 1024 為單位）
+func ParseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	s = strings.TrimSuffix(s, "B")
+	if s == "" {
+		return 0, errors.New("大小不可為空")
+	}
+	
+	multiplier := int64(1)
+	switch s[len(s)-1] {
+	case 'K':
+		multiplier = 1 << 10
+	case 'M':
+		multiplier = 1 << 20
+	case 'G':
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		s = s[:len(s)-1]
+	}
+	
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("無效的大小: %s", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// CopyFile 複製檔案，目的檔已存在時覆寫
+func CopyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	
+	out, err := os.Create(dst)
 	if err != nil {
 		return err
 	}
 	
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// DeleteFiles 刪除資料夾內除 except 以外的所有檔案
+func DeleteFiles(folderPath string, except ...string) error {
+	files, err := os.ReadDir(folderPath)
+	if err != nil {
+		return err
+	}
+
+	keep := make(map[string]bool, len(except))
+	for _, name := range except {
+		keep[name] = true
+	}
+
 	for _, file := range files {
-		if file.Name() != except && !file.IsDir() {
+		if !keep[file.Name()] && !file.IsDir() {
 			os.Remove(filepath.Join(folderPath, file.Name()))
 		}
 	}
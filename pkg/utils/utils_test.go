@@ -71,6 +71,29 @@ func TestDeleteFiles_Except(t *testing.T) {
 	}
 }
 
+func TestDeleteFiles_MultipleExcept(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, f := range []string{"abc-123.mp4", "abc-123.jpg", "seg1.mp4", "segments.json"} {
+		os.WriteFile(filepath.Join(dir, f), []byte("data"), 0644)
+	}
+
+	if err := DeleteFiles(dir, "abc-123.mp4", "abc-123.jpg"); err != nil {
+		t.Fatalf("DeleteFiles failed: %v", err)
+	}
+
+	for _, f := range []string{"abc-123.mp4", "abc-123.jpg"} {
+		if _, err := os.Stat(filepath.Join(dir, f)); os.IsNotExist(err) {
+			t.Errorf("%s should still exist", f)
+		}
+	}
+	for _, f := range []string{"seg1.mp4", "segments.json"} {
+		if _, err := os.Stat(filepath.Join(dir, f)); err == nil {
+			t.Errorf("%s should have been deleted", f)
+		}
+	}
+}
+
 func TestDeleteFiles_AllDeleted(t *testing.T) {
 	dir := t.TempDir()
 	os.WriteFile(filepath.Join(dir, "seg1.ts"), []byte("data"), 0644)
@@ -324,3 +347,46 @@ func TestGetRandomRecommendation_MultipleURLs(t *testing.T) {
 		}
 	}
 }
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"1048576", 1048576, false},
+		{"512K", 512 << 10, false},
+		{"3900M", 3900 << 20, false},
+		{"4g", 4 << 30, false},
+		{"1.5GB", 3 << 29, false},
+		{"", 0, true},
+		{"abc", 0, true},
+		{"-1M", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseSize(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSize(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSize(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCopyFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "abc-123.jpg")
+	dst := filepath.Join(dir, "abc-123-part1.jpg")
+	os.WriteFile(src, []byte("jpeg"), 0644)
+
+	if err := CopyFile(src, dst); err != nil {
+		t.Fatalf("CopyFile failed: %v", err)
+	}
+	if got, _ := os.ReadFile(dst); string(got) != "jpeg" {
+		t.Errorf("expected copied content 'jpeg', got %q", got)
+	}
+}